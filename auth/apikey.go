@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix is prepended to all generated API keys.
+const APIKeyPrefix = "rk_"
+
+// GenerateAPIKey generates a new random API key and the short prefix used to identify it.
+func GenerateAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	key = fmt.Sprintf("%s_%s", prefix, base64.RawURLEncoding.EncodeToString(secret))
+	return
+}
+
+// HashAPIKey hashes an API key for storage. Keys are high entropy, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey checks whether a credential looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,143 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestEncodeBech32(t *testing.T) {
+	if encoded, _ := auth.EncodeBech32("a", nil); encoded != "a12uel5l" {
+		t.Fatalf("got unexpected bech32 encoding: %s", encoded)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	privKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %+v", err)
+	}
+	pubKey := privKey.PubKey().SerializeCompressed()
+	address, err := auth.PubKeyAddress(pubKey)
+	if err != nil {
+		t.Fatalf("failed to derive address: %+v", err)
+	}
+	message := []byte("GET\n/referrals/api/v1/campaigns/1/signups\n1700000000")
+	hash := sha256.Sum256(message)
+	signature := ecdsa.SignCompact(privKey, hash[:], true)[1:]
+	pubKeyB64 := base64.StdEncoding.EncodeToString(pubKey)
+	signatureB64 := base64.StdEncoding.EncodeToString(signature)
+	if err := auth.VerifySignature(address, pubKeyB64, signatureB64, message); err != nil {
+		t.Fatalf("failed to verify signature: %+v", err)
+	}
+	if err := auth.VerifySignature(address, pubKeyB64, signatureB64, []byte("tampered")); err == nil {
+		t.Fatalf("expected invalid signature error")
+	}
+	if err := auth.VerifySignature("tp1other", pubKeyB64, signatureB64, message); err == nil {
+		t.Fatalf("expected address mismatch error")
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	first, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %+v", err)
+	}
+	keys := []domain.SigningKey{first}
+	keySet := auth.NewKeySet(func() []domain.SigningKey { return keys })
+	address := "tp1session000000000000000000000000000000000"
+	token, jti, _, err := keySet.Sign(address, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to sign access token: %+v", err)
+	}
+	// Rotate keys; tokens signed by the retiring key must still verify.
+	second, _ := auth.GenerateSigningKey()
+	retireAt := time.Now().Add(time.Minute)
+	first.RetiredAt = &retireAt
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+	keys = []domain.SigningKey{first, second}
+	keySet.Reload()
+	claims, err := keySet.Verify(token)
+	if err != nil {
+		t.Fatalf("failed to verify access token: %+v", err)
+	}
+	if claims.Subject != address || claims.ID != jti {
+		t.Fatalf("got unexpected access token claims: %+v", claims)
+	}
+	if len(keySet.JWKS()["keys"].([]map[string]string)) != 2 {
+		t.Fatalf("expected both keys in key set")
+	}
+	if _, err := keySet.Verify(token + "x"); err == nil {
+		t.Fatalf("expected invalid access token error")
+	}
+	// Keys retiring before a token expires don't sign it, and retired keys don't verify.
+	retiredAt := time.Now().Add(-time.Second)
+	first.RetiredAt, second.RetiredAt = &retiredAt, &retireAt
+	keys = []domain.SigningKey{first, second}
+	keySet.Reload()
+	if _, _, _, err := keySet.Sign(address, time.Hour); err == nil {
+		t.Fatalf("expected no signing key to outlive the token")
+	}
+	if _, err := keySet.Verify(token); err == nil {
+		t.Fatalf("expected retired signing key not to verify")
+	}
+}
+
+func TestKeyCipher(t *testing.T) {
+	if _, err := auth.NewKeyCipher("short"); err == nil {
+		t.Fatalf("expected short key encryption key error")
+	}
+	keyCipher, _ := auth.NewKeyCipher("0123456789abcdef0123456789abcdef")
+	key, _ := auth.GenerateSigningKey()
+	sealed, err := keyCipher.Seal(key.ID, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to seal signing key: %+v", err)
+	}
+	if opened, err := keyCipher.Open(key.ID, sealed); err != nil || string(opened) != string(key.PrivateKey) {
+		t.Fatalf("failed to open signing key: %+v", err)
+	}
+	if _, err := keyCipher.Open("other", sealed); err == nil {
+		t.Fatalf("expected signing key sealed for another ID not to open")
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	if auth.HashRefreshToken("token") == auth.HashAPIKey("token") {
+		t.Fatalf("expected refresh token hashes to differ from api key hashes")
+	}
+}
+
+func TestReferralTokens(t *testing.T) {
+	if _, err := auth.NewReferralTokens("short", time.Hour); err == nil {
+		t.Fatalf("expected short secret error")
+	}
+	tokens, err := auth.NewReferralTokens("0123456789abcdef0123456789abcdef", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create referral tokens: %+v", err)
+	}
+	token, err := tokens.Sign(7, "visitor")
+	if err != nil {
+		t.Fatalf("failed to sign referral token: %+v", err)
+	}
+	referral, err := tokens.Verify(token)
+	if err != nil {
+		t.Fatalf("failed to verify referral token: %+v", err)
+	}
+	if referral.CampaignID != 7 || referral.VisitorID != "visitor" || referral.Nonce == "" {
+		t.Fatalf("got unexpected referral token: %+v", referral)
+	}
+	if _, err := tokens.Verify(token + "x"); err == nil {
+		t.Fatalf("expected invalid referral token error")
+	}
+	expired, _ := auth.NewReferralTokens("0123456789abcdef0123456789abcdef", -time.Minute)
+	token, _ = expired.Sign(7, "visitor")
+	if _, err := expired.Verify(token); err == nil {
+		t.Fatalf("expected expired referral token error")
+	}
+}
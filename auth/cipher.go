@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// KeyCipher encrypts signing keys for storage with a key encryption key.
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher creates a signing key cipher. The secret is hashed into an AES-256-GCM key.
+func NewKeyCipher(secret string) (*KeyCipher, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("key encryption key must be at least 32 characters")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyCipher{aead}, nil
+}
+
+// Seal encrypts a private key, binding it to its key ID so stored keys can't be swapped.
+func (self *KeyCipher) Seal(id string, privateKey []byte) ([]byte, error) {
+	nonce := make([]byte, self.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return self.aead.Seal(nonce, nonce, privateKey, []byte(id)), nil
+}
+
+// Open decrypts a private key sealed for a key ID.
+func (self *KeyCipher) Open(id string, sealed []byte) ([]byte, error) {
+	size := self.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("sealed signing key %s is too short", id)
+	}
+	privateKey, err := self.aead.Open(nil, sealed[:size], sealed[size:], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt signing key %s: %s", id, err.Error())
+	}
+	return privateKey, nil
+}
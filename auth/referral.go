@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReferralToken is a signed referral passed through redirect URLs in place of a cookie.
+type ReferralToken struct {
+	CampaignID uint64
+	VisitorID  string
+	Nonce      string
+	ExpiresAt  time.Time
+}
+
+// ReferralTokens signs and verifies referral tokens with an HMAC secret.
+type ReferralTokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewReferralTokens creates a referral token signer. Tokens expire after a ttl.
+func NewReferralTokens(secret string, ttl time.Duration) (*ReferralTokens, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("referral token secret must be at least 32 characters")
+	}
+	return &ReferralTokens{[]byte(secret), ttl}, nil
+}
+
+// Sign creates a signed referral token for a campaign click.
+func (self *ReferralTokens) Sign(campaignID uint64, visitorID string) (string, error) {
+	nonce, err := RandomToken(12)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(self.ttl).Unix()
+	payload := fmt.Sprintf("%d.%s.%d.%s", campaignID, visitorID, expiresAt, nonce)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + self.mac(encoded), nil
+}
+
+// Verify checks the signature and expiry of a referral token. Callers must consume the
+// token nonce to prevent replays.
+func (self *ReferralTokens) Verify(token string) (referral ReferralToken, err error) {
+	encoded, mac, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(self.mac(encoded))) {
+		err = fmt.Errorf("invalid referral token signature")
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		err = fmt.Errorf("invalid referral token encoding")
+		return
+	}
+	parts := strings.Split(string(payload), ".")
+	if len(parts) != 4 {
+		err = fmt.Errorf("invalid referral token payload")
+		return
+	}
+	if referral.CampaignID, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		err = fmt.Errorf("invalid referral token campaign")
+		return
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid referral token expiry")
+		return
+	}
+	referral.VisitorID = parts[1]
+	referral.ExpiresAt = time.Unix(expiresAt, 0)
+	referral.Nonce = parts[3]
+	if time.Now().After(referral.ExpiresAt) {
+		err = fmt.Errorf("referral token expired")
+	}
+	return
+}
+
+// Compute the base64 encoded HMAC of a token payload.
+func (self *ReferralTokens) mac(encoded string) string {
+	hasher := hmac.New(sha256.New, self.secret)
+	hasher.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+}
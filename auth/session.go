@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenIssuer is the issuer claim for session access tokens.
+const TokenIssuer = "referrals"
+
+// ChallengeMessage formats the message an address signs to start a session.
+func ChallengeMessage(address, nonce string, expiresAt time.Time) string {
+	return fmt.Sprintf(
+		"Sign in to referrals\naddress: %s\nnonce: %s\nexpires: %s",
+		address, nonce, expiresAt.UTC().Format(time.RFC3339),
+	)
+}
+
+// RandomToken generates a random url safe token with n bytes of entropy.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken hashes a session refresh token for storage. Hashes are domain separated
+// from API key hashes, so one kind of credential can't be looked up as the other.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte("referrals refresh token\x00" + token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSigningKey generates a new Ed25519 key for signing access tokens.
+func GenerateSigningKey() (domain.SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return domain.SigningKey{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return domain.SigningKey{}, err
+	}
+	return domain.SigningKey{ID: hex.EncodeToString(id), PrivateKey: privateKey, CreatedAt: time.Now()}, nil
+}
+
+// AccessClaims are the claims for session access tokens.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+}
+
+// KeySet signs and verifies session access tokens with a rotating set of keys.
+// The newest active key signs; keys scheduled to retire still verify until they do.
+type KeySet struct {
+	mu         sync.RWMutex
+	keys       []domain.SigningKey
+	loader     func() []domain.SigningKey
+	reloadedAt time.Time
+}
+
+// keyReloadInterval limits how often unknown key IDs trigger a reload.
+var keyReloadInterval = 10 * time.Second
+
+// NewKeySet creates a key set that loads keys on startup and when an unknown key ID is seen.
+func NewKeySet(loader func() []domain.SigningKey) *KeySet {
+	keySet := &KeySet{loader: loader}
+	keySet.Reload()
+	return keySet
+}
+
+// Reload reloads signing keys, so keys rotated by other instances are picked up.
+func (self *KeySet) Reload() {
+	keys := self.loader()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	self.mu.Lock()
+	self.keys = keys
+	self.reloadedAt = time.Now()
+	self.mu.Unlock()
+}
+
+// Sign issues an access token for an address, returning the token, its ID and expiry.
+// Keys are reloaded when none of the cached keys can sign, as when they were retired by a
+// rotation on another instance.
+func (self *KeySet) Sign(address string, ttl time.Duration) (string, string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	key, ok := self.signingKey(expiresAt)
+	if !ok && self.canReload() {
+		self.Reload()
+		key, ok = self.signingKey(expiresAt)
+	}
+	if !ok {
+		return "", "", time.Time{}, fmt.Errorf("no signing keys available")
+	}
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, AccessClaims{jwt.RegisteredClaims{
+		Issuer:    TokenIssuer,
+		Subject:   address,
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(ed25519.PrivateKey(key.PrivateKey))
+	return signed, jti, expiresAt, err
+}
+
+// Verify parses and verifies an access token.
+func (self *KeySet) Verify(token string) (AccessClaims, error) {
+	var claims AccessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		publicKey, ok := self.publicKey(kid)
+		if !ok && self.canReload() {
+			self.Reload()
+			publicKey, ok = self.publicKey(kid)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+		return publicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return claims, fmt.Errorf("invalid access token: %s", err.Error())
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys used to verify access tokens as a JSON web key set.
+func (self *KeySet) JWKS() map[string]any {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	keys := make([]map[string]string, len(self.keys))
+	for i, key := range self.keys {
+		publicKey := ed25519.PrivateKey(key.PrivateKey).Public().(ed25519.PublicKey)
+		keys[i] = map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"alg": jwt.SigningMethodEdDSA.Alg(),
+			"use": "sig",
+			"kid": key.ID,
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}
+	}
+	return map[string]any{"keys": keys}
+}
+
+// Pick the newest key that stays active until a token expires. Keys retiring sooner could
+// sign tokens that stop verifying before they expire.
+func (self *KeySet) signingKey(expiresAt time.Time) (domain.SigningKey, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for i := len(self.keys) - 1; i >= 0; i-- {
+		key := self.keys[i]
+		if key.RetiredAt == nil || key.RetiredAt.After(expiresAt) {
+			return key, true
+		}
+	}
+	return domain.SigningKey{}, false
+}
+
+// Check whether keys were last reloaded long enough ago to reload again.
+func (self *KeySet) canReload() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return time.Since(self.reloadedAt) > keyReloadInterval
+}
+
+// Lookup the public key for a key ID. Retired keys no longer verify.
+func (self *KeySet) publicKey(kid string) (ed25519.PublicKey, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	now := time.Now()
+	for _, key := range self.keys {
+		if key.ID == kid && (key.RetiredAt == nil || key.RetiredAt.After(now)) {
+			return ed25519.PrivateKey(key.PrivateKey).Public().(ed25519.PublicKey), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// PubKeyAddress derives the blockchain address for a compressed secp256k1 public key.
+func PubKeyAddress(pubKey []byte) (string, error) {
+	if _, err := secp256k1.ParsePubKey(pubKey); err != nil {
+		return "", fmt.Errorf("invalid public key: %s", err.Error())
+	}
+	sha := sha256.Sum256(pubKey)
+	hasher := ripemd160.New()
+	hasher.Write(sha[:])
+	return EncodeBech32(domain.AddressPrefix, hasher.Sum(nil))
+}
+
+// VerifySignature verifies that a message was signed by the key for an address. The public key
+// is base64 encoded compressed secp256k1 and the signature is a base64 encoded 64 byte r||s
+// ECDSA signature over the sha256 hash of the message.
+func VerifySignature(address, pubKeyB64, signatureB64 string, message []byte) error {
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(pubKeyB64)
+	if err != nil {
+		return fmt.Errorf("invalid public key encoding")
+	}
+	derived, err := PubKeyAddress(pubKeyBytes)
+	if err != nil {
+		return err
+	}
+	if derived != address {
+		return fmt.Errorf("public key does not match address: %s", address)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil || len(sig) != 64 {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || r.IsZero() || s.IsZero() {
+		return fmt.Errorf("invalid signature")
+	}
+	pubKey, _ := secp256k1.ParsePubKey(pubKeyBytes)
+	hash := sha256.Sum256(message)
+	if !ecdsa.NewSignature(&r, &s).Verify(hash[:], pubKey) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
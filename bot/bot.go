@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Reasons a request is classified as a bot
+const (
+	ReasonHead          = "head"
+	ReasonPrefetch      = "prefetch"
+	ReasonUserAgent     = "user_agent"
+	ReasonMissingHeader = "missing_header"
+)
+
+// Rules are the patterns used to classify bot requests.
+type Rules struct {
+	// UserAgents are case insensitive user agent fragments of known bots.
+	UserAgents []string `json:"userAgents"`
+	// RequiredHeaders are headers every real browser sends.
+	RequiredHeaders []string `json:"requiredHeaders"`
+	// PrefetchHeaders map headers to case insensitive value fragments marking prefetches
+	// and previews.
+	PrefetchHeaders map[string]string `json:"prefetchHeaders"`
+	// FilterHead classifies HEAD requests as bots.
+	FilterHead bool `json:"filterHead"`
+}
+
+// DefaultRules are the default bot classification rules.
+var DefaultRules = Rules{
+	UserAgents: []string{
+		"bot", "crawl", "spider", "slurp", "scanner", "preview", "headless",
+		"curl/", "wget/", "python-", "go-http-client", "java/", "okhttp", "libwww",
+		"facebookexternalhit", "whatsapp", "skypeuripreview", "embedly",
+	},
+	RequiredHeaders: []string{"User-Agent", "Accept"},
+	PrefetchHeaders: map[string]string{
+		"Purpose":     "prefetch",
+		"Sec-Purpose": "prefetch",
+		"X-Purpose":   "preview",
+		"X-Moz":       "prefetch",
+	},
+	FilterHead: true,
+}
+
+// LoadRules reads bot classification rules from a JSON file. Fields set in the file replace
+// the default rules; fields missing from it keep their defaults.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+	var file struct {
+		UserAgents      *[]string          `json:"userAgents"`
+		RequiredHeaders *[]string          `json:"requiredHeaders"`
+		PrefetchHeaders *map[string]string `json:"prefetchHeaders"`
+		FilterHead      *bool              `json:"filterHead"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return Rules{}, fmt.Errorf("invalid bot rules %s: %s", path, err.Error())
+	}
+	rules := DefaultRules
+	if file.UserAgents != nil {
+		rules.UserAgents = *file.UserAgents
+	}
+	if file.RequiredHeaders != nil {
+		rules.RequiredHeaders = *file.RequiredHeaders
+	}
+	if file.PrefetchHeaders != nil {
+		rules.PrefetchHeaders = *file.PrefetchHeaders
+	}
+	if file.FilterHead != nil {
+		rules.FilterHead = *file.FilterHead
+	}
+	return rules, nil
+}
+
+// Classifier classifies requests from bots, crawlers and link scanners.
+type Classifier struct {
+	rules Rules
+}
+
+// NewClassifier creates a new bot classifier.
+func NewClassifier(rules Rules) Classifier {
+	userAgents := make([]string, len(rules.UserAgents))
+	for i, userAgent := range rules.UserAgents {
+		userAgents[i] = strings.ToLower(userAgent)
+	}
+	rules.UserAgents = userAgents
+	return Classifier{rules}
+}
+
+// Classify checks whether a request is from a bot, returning the reason it was classified
+// as one.
+func (self Classifier) Classify(r *http.Request) (reason string, ok bool) {
+	if self.rules.FilterHead && r.Method == http.MethodHead {
+		return ReasonHead, true
+	}
+	for header, value := range self.rules.PrefetchHeaders {
+		found := strings.ToLower(r.Header.Get(header))
+		if found != "" && strings.Contains(found, strings.ToLower(value)) {
+			return ReasonPrefetch, true
+		}
+	}
+	for _, header := range self.rules.RequiredHeaders {
+		if r.Header.Get(header) == "" {
+			return ReasonMissingHeader, true
+		}
+	}
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, fragment := range self.rules.UserAgents {
+		if strings.Contains(userAgent, fragment) {
+			return ReasonUserAgent, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,113 @@
+package bot_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/bot"
+)
+
+// Create a request with browser headers.
+func browserRequest(method string) *http.Request {
+	r := httptest.NewRequest(method, "/referrals/1/signup", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) Safari/605.1.15")
+	r.Header.Set("Accept", "text/html")
+	return r
+}
+
+func TestClassify(t *testing.T) {
+	classifier := bot.NewClassifier(bot.DefaultRules)
+	if reason, ok := classifier.Classify(browserRequest(http.MethodGet)); ok {
+		t.Fatalf("expected browser request, got bot: %s", reason)
+	}
+	head := browserRequest(http.MethodHead)
+	prefetch := browserRequest(http.MethodGet)
+	prefetch.Header.Set("Sec-Purpose", "prefetch;prerender")
+	missing := browserRequest(http.MethodGet)
+	missing.Header.Del("Accept")
+	crawler := browserRequest(http.MethodGet)
+	crawler.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1)")
+	for expected, r := range map[string]*http.Request{
+		bot.ReasonHead:          head,
+		bot.ReasonPrefetch:      prefetch,
+		bot.ReasonMissingHeader: missing,
+		bot.ReasonUserAgent:     crawler,
+	} {
+		if reason, ok := classifier.Classify(r); !ok || reason != expected {
+			t.Fatalf("expected bot reason %s, got: %s", expected, reason)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.json")
+	if err := os.WriteFile(path, []byte(`{"userAgents": ["Safari"]}`), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %+v", err)
+	}
+	rules, err := bot.LoadRules(path)
+	if err != nil {
+		t.Fatalf("failed to load rules: %+v", err)
+	}
+	// User agents are replaced, and the other rules keep their defaults.
+	classifier := bot.NewClassifier(rules)
+	if reason, ok := classifier.Classify(browserRequest(http.MethodGet)); !ok || reason != bot.ReasonUserAgent {
+		t.Fatalf("expected user agent bot reason, got: %s", reason)
+	}
+	if reason, ok := classifier.Classify(browserRequest(http.MethodHead)); !ok || reason != bot.ReasonHead {
+		t.Fatalf("expected head bot reason, got: %s", reason)
+	}
+	if err := os.WriteFile(path, []byte(`{"userAgent": ["Safari"]}`), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %+v", err)
+	}
+	if _, err := bot.LoadRules(path); err == nil {
+		t.Fatalf("expected unknown field error")
+	}
+}
+
+func TestHitCounter(t *testing.T) {
+	var recorded []map[uint64]uint64
+	record := func(hits map[uint64]uint64) error {
+		recorded = append(recorded, hits)
+		return nil
+	}
+	counter := bot.NewHitCounter(record, time.Hour)
+	for range 3 {
+		counter.Count(1, bot.ReasonHead)
+	}
+	counter.Count(2, bot.ReasonUserAgent)
+	if len(recorded) != 0 {
+		t.Fatalf("expected hits to be recorded in batches, got: %+v", recorded)
+	}
+	if err := counter.Close(); err != nil {
+		t.Fatalf("failed to close hit counter: %+v", err)
+	}
+	if len(recorded) != 1 || recorded[0][1] != 3 || recorded[0][2] != 1 {
+		t.Fatalf("expected one batch of hits on close, got: %+v", recorded)
+	}
+}
+
+func TestHitCounterRetry(t *testing.T) {
+	fail := true
+	var recorded map[uint64]uint64
+	counter := bot.NewHitCounter(func(hits map[uint64]uint64) error {
+		if fail {
+			return errors.New("database is locked")
+		}
+		recorded = hits
+		return nil
+	}, time.Hour)
+	counter.Count(1, bot.ReasonHead)
+	if err := counter.Flush(); err == nil {
+		t.Fatalf("expected flush error")
+	}
+	fail = false
+	counter.Count(1, bot.ReasonHead)
+	if err := counter.Close(); err != nil || recorded[1] != 2 {
+		t.Fatalf("expected failed hits to be kept for the next flush, got: %+v %+v", recorded, err)
+	}
+}
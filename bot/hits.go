@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HitCounter counts filtered bot hits per campaign in memory and records them in batches, so
+// bot traffic doesn't cost a database write and a log line per hit.
+type HitCounter struct {
+	mu      sync.Mutex
+	hits    map[uint64]uint64
+	reasons map[string]uint64
+	record  func(hits map[uint64]uint64) error
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewHitCounter creates a hit counter that records counted hits every interval.
+func NewHitCounter(record func(hits map[uint64]uint64) error, interval time.Duration) *HitCounter {
+	counter := &HitCounter{
+		hits:    make(map[uint64]uint64),
+		reasons: make(map[string]uint64),
+		record:  record,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go counter.run(interval)
+	return counter
+}
+
+// Count counts a filtered bot hit on a campaign with the reason it was filtered.
+func (self *HitCounter) Count(campaignID uint64, reason string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.hits[campaignID]++
+	self.reasons[reason]++
+}
+
+// Flush records the hits counted so far, logging a summary of their reasons. Hits that fail
+// to record are kept for the next flush.
+func (self *HitCounter) Flush() error {
+	self.mu.Lock()
+	hits, reasons := self.hits, self.reasons
+	self.hits, self.reasons = make(map[uint64]uint64), make(map[string]uint64)
+	self.mu.Unlock()
+	if len(hits) == 0 {
+		return nil
+	}
+	if err := self.record(hits); err != nil {
+		self.mu.Lock()
+		for campaignID, count := range hits {
+			self.hits[campaignID] += count
+		}
+		for reason, count := range reasons {
+			self.reasons[reason] += count
+		}
+		self.mu.Unlock()
+		return fmt.Errorf("failed to record filtered bot hits: %s", err.Error())
+	}
+	log.Printf("filtered bot hits on %d campaigns: %s", len(hits), summary(reasons))
+	return nil
+}
+
+// Close stops recording hits periodically and records any remaining hits.
+func (self *HitCounter) Close() error {
+	self.once.Do(func() { close(self.done) })
+	<-self.stopped
+	return self.Flush()
+}
+
+// Periodically record counted hits until closed.
+func (self *HitCounter) run(interval time.Duration) {
+	defer close(self.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			if err := self.Flush(); err != nil {
+				log.Print(err.Error())
+			}
+		}
+	}
+}
+
+// Summarize hit counts by reason, eg "head=2 user_agent=5".
+func summary(reasons map[string]uint64) string {
+	keys := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		keys = append(keys, reason)
+	}
+	slices.Sort(keys)
+	for i, reason := range keys {
+		keys[i] = fmt.Sprintf("%s=%d", reason, reasons[reason])
+	}
+	return strings.Join(keys, " ")
+}
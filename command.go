@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/database"
+	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/importer"
+	"gorm.io/gorm"
+)
+
+// Run a command line sub-command.
+func runCommand(name string, args []string) {
+	switch name {
+	case "import":
+		runImport(args)
+	case "keys":
+		runKeys(args)
+	case "migrate":
+		runMigrate(args)
+	default:
+		log.Fatalf("unknown command: %s", name)
+	}
+}
+
+// Connect to the database configured with env vars or the CONFIG_FILE env var.
+func connect() (*gorm.DB, *gorm.DB, error) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return database.ConnectAndMigrate(cfg.Database)
+}
+
+// Bulk import campaigns and signups from CSV or JSONL files.
+// Usage: referrals import [-format csv|jsonl] [-chunk 500] file...
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "import file format: csv or jsonl (default: file extension)")
+	chunkSize := flags.Int("chunk", importer.DefaultChunkSize, "number of records per transaction")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalf("usage: referrals import [-format csv|jsonl] [-chunk n] file...")
+	}
+	_, writeDB, err := connect()
+	if err != nil {
+		log.Fatalf("unable to connnect to db: %+v", err)
+	}
+	bulkImporter := importer.NewImporter(repo.NewImportRepo(writeDB), *chunkSize)
+	encoder := json.NewEncoder(os.Stdout)
+	failed := false
+	for _, path := range flags.Args() {
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = strings.TrimPrefix(filepath.Ext(path), ".")
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("unable to open import file: %+v", err)
+		}
+		report, err := bulkImporter.Import(file, fileFormat)
+		file.Close()
+		if err != nil {
+			log.Printf("import %s failed: %+v", path, err)
+			failed = true
+		}
+		for _, importErr := range report.Errors {
+			log.Printf("%s:%d: %s", path, importErr.Line, importErr.Error)
+		}
+		failed = failed || len(report.Errors) > 0
+		encoder.Encode(map[string]any{"file": path, "campaigns": report.Campaigns, "signups": report.Signups, "errors": len(report.Errors)})
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Mint or revoke API keys. The first admin key must be minted from the command line.
+// Usage: referrals keys mint [-name admin] [-scopes admin] | referrals keys revoke id
+func runKeys(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("usage: referrals keys mint|revoke")
+	}
+	readDB, writeDB, err := connect()
+	if err != nil {
+		log.Fatalf("unable to connnect to db: %+v", err)
+	}
+	apiKeyRepo := repo.NewAPIKeyRepo(readDB, writeDB)
+	switch args[0] {
+	case "mint":
+		flags := flag.NewFlagSet("keys mint", flag.ExitOnError)
+		name := flags.String("name", "admin", "api key name")
+		scopeList := flags.String("scopes", domain.ScopeAdmin, "comma separated api key scopes")
+		flags.Parse(args[1:])
+		scopes, err := domain.ValidateScopes(strings.Split(*scopeList, ","))
+		if err != nil {
+			log.Fatalf("invalid scopes: %+v", err)
+		}
+		apiKey, key, err := apiKeyRepo.CreateAPIKey(*name, scopes)
+		if err != nil {
+			log.Fatalf("unable to mint api key: %+v", err)
+		}
+		log.Printf("minted api key %d (%s) with scopes: %s", apiKey.ID, apiKey.Prefix, strings.Join(scopes, ","))
+		fmt.Println(key)
+	case "revoke":
+		if len(args) < 2 {
+			log.Fatalf("usage: referrals keys revoke id")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			log.Fatalf("invalid api key id: %s", args[1])
+		}
+		if _, err := apiKeyRepo.RevokeAPIKey(id); err != nil {
+			log.Fatalf("unable to revoke api key: %+v", err)
+		}
+		log.Printf("revoked api key %d", id)
+	default:
+		log.Fatalf("unknown keys command: %s", args[0])
+	}
+}
+
+// Apply, roll back or show schema migrations. The database is closed, checkpointing the
+// WAL, before exiting on errors.
+// Usage: referrals migrate up [-steps n] | down [-steps 1] | status
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("usage: referrals migrate up|down|status")
+	}
+	cfg, err := config.Load(nil)
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err != nil {
+		log.Fatalf("invalid config:\n%s", err)
+	}
+	dsn := cfg.Database.DSN
+	if !database.IsPostgres(dsn) {
+		dsn = database.ImmediateDSN(dsn)
+	}
+	db, err := database.Connect(dsn, 1)
+	if err != nil {
+		log.Fatalf("unable to connnect to db: %+v", err)
+	}
+	err = migrate(db, args[0], args[1:])
+	if closeErr := database.Close(db, db, cfg.Database.Replicated); closeErr != nil {
+		log.Printf("unable to close db: %+v", closeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Run a migrate sub-command on a database.
+func migrate(db *gorm.DB, command string, args []string) error {
+	flags := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+	switch command {
+	case "up":
+		steps := flags.Int("steps", 0, "number of migrations to apply (default: all)")
+		flags.Parse(args)
+		applied, err := database.MigrateUp(db, *steps)
+		for _, migration := range applied {
+			log.Printf("applied migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to migrate up: %+v", err)
+		}
+		if len(applied) == 0 {
+			log.Printf("schema is up to date")
+		}
+	case "down":
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		flags.Parse(args)
+		rolledBack, err := database.MigrateDown(db, *steps)
+		for _, migration := range rolledBack {
+			log.Printf("rolled back migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to migrate down: %+v", err)
+		}
+	case "status":
+		statuses, err := database.GetMigrationStatus(db)
+		if err != nil {
+			return fmt.Errorf("unable to get migration status: %+v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		for _, status := range statuses {
+			encoder.Encode(status)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the referral server configuration, loaded once at startup.
+type Config struct {
+	Server      Server            `yaml:"server"`
+	Database    Database          `yaml:"database"`
+	Signup      Signup            `yaml:"signup"`
+	Redirect    Redirect          `yaml:"redirect"`
+	Session     Session           `yaml:"session"`
+	Review      Review            `yaml:"review"`
+	Fraud       Fraud             `yaml:"fraud"`
+	Paging      Paging            `yaml:"paging"`
+	Maintenance Maintenance       `yaml:"maintenance"`
+	RateLimits  map[string]string `yaml:"rateLimits"`
+	// File is the YAML file the config was loaded from, if any.
+	File string `yaml:"-"`
+}
+
+// Server is http server configuration. LegacyErrors sends {"error": "..."} error responses
+// instead of problem+json, for clients that haven't migrated yet. TrustedProxies are the
+// proxy IPs or CIDRs whose X-Forwarded-For headers are believed; none are by default.
+type Server struct {
+	Port            int           `yaml:"port"`
+	BaseURL         string        `yaml:"baseUrl"`
+	DisableColor    bool          `yaml:"disableColor"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	LegacyErrors    bool          `yaml:"legacyErrors"`
+	TrustedProxies  []string      `yaml:"trustedProxies"`
+}
+
+// RateLimitNames are the route groups that can be rate limited.
+var RateLimitNames = []string{"redirect", "signup", "write", "signed"}
+
+// Database is sqlite or PostgreSQL database configuration, picked by the DSN scheme.
+// Replicated sqlite databases are managed by litestream, which the app leaves in control of
+// resetting the WAL. Migrate is the startup migration mode.
+type Database struct {
+	DSN        string `yaml:"dsn"`
+	ReadConns  int    `yaml:"readConns"`
+	Replicated bool   `yaml:"replicated"`
+	Migrate    string `yaml:"migrate"`
+}
+
+// Startup migration modes
+const (
+	// MigrateAuto applies pending migrations at startup.
+	MigrateAuto = "auto"
+	// MigrateVerify refuses to start with pending migrations, which must be applied with
+	// the migrate command.
+	MigrateVerify = "verify"
+)
+
+// Signup is the default signup redirect and referral cookie configuration.
+type Signup struct {
+	URL          string        `yaml:"url"`
+	CookiePath   string        `yaml:"cookiePath"`
+	CookieDomain string        `yaml:"cookieDomain"`
+	CookieMaxAge time.Duration `yaml:"cookieMaxAge"`
+}
+
+// Redirect is referral redirect and attribution configuration.
+type Redirect struct {
+	Attribution       string        `yaml:"attribution"`
+	Allowlist         []string      `yaml:"allowlist"`
+	DeepLinkSchemes   []string      `yaml:"deepLinkSchemes"`
+	PassthroughParams []string      `yaml:"passthroughParams"`
+	PreviewTemplate   string        `yaml:"previewTemplate"`
+	BotRules          string        `yaml:"botRules"`
+	TokenSecret       string        `yaml:"tokenSecret"`
+	TokenTTL          time.Duration `yaml:"tokenTtl"`
+}
+
+// Session is wallet signature session configuration. KeyEncryptionKey encrypts the stored
+// access token signing keys.
+type Session struct {
+	ChallengeTTL     time.Duration `yaml:"challengeTtl"`
+	AccessTokenTTL   time.Duration `yaml:"accessTokenTtl"`
+	RefreshTokenTTL  time.Duration `yaml:"refreshTokenTtl"`
+	KeyEncryptionKey string        `yaml:"keyEncryptionKey"`
+}
+
+// Review is signup review queue configuration.
+type Review struct {
+	ClaimTTL time.Duration `yaml:"claimTtl"`
+}
+
+// Fraud is signup fraud scoring configuration. HashSecret keys the HMAC client IPs and user
+// agents are stored hashed with; changing it resets shared IP and fingerprint counts.
+type Fraud struct {
+	HashSecret string `yaml:"hashSecret"`
+}
+
+// Paging bounds page sizes for list endpoints.
+type Paging struct {
+	DefaultLimit int `yaml:"defaultLimit"`
+	MaxLimit     int `yaml:"maxLimit"`
+}
+
+// Maintenance schedules database maintenance tasks. A zero interval disables a task.
+type Maintenance struct {
+	CheckpointInterval time.Duration `yaml:"checkpointInterval"`
+	WALRestartMB       int64         `yaml:"walRestartMb"`
+	OptimizeInterval   time.Duration `yaml:"optimizeInterval"`
+	AnalyzeInterval    time.Duration `yaml:"analyzeInterval"`
+	IntegrityInterval  time.Duration `yaml:"integrityInterval"`
+	PurgeInterval      time.Duration `yaml:"purgeInterval"`
+	// TouchRetention is how long recorded referral clicks are kept. It must cover the
+	// signup cookie max age, which bounds the clicks used for attribution.
+	TouchRetention time.Duration `yaml:"touchRetention"`
+}
+
+// Default returns the default configuration. The database DSN, signup URL, key encryption
+// key and fraud hash secret have no defaults and must be provided.
+func Default() Config {
+	return Config{
+		Server:   Server{Port: 8080, ShutdownTimeout: 30 * time.Second},
+		Database: Database{ReadConns: max(4, runtime.NumCPU()), Migrate: MigrateAuto},
+		Signup: Signup{
+			CookiePath:   "/",
+			CookieMaxAge: 30 * 24 * time.Hour,
+		},
+		Redirect: Redirect{
+			Attribution:       domain.AttributionLast,
+			PassthroughParams: []string{"utm_*"},
+			TokenTTL:          24 * time.Hour,
+		},
+		Session: Session{
+			ChallengeTTL:    5 * time.Minute,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Review: Review{ClaimTTL: 30 * time.Minute},
+		Paging: Paging{DefaultLimit: 10, MaxLimit: 1000},
+		Maintenance: Maintenance{
+			CheckpointInterval: time.Minute,
+			WALRestartMB:       64,
+			OptimizeInterval:   time.Hour,
+			AnalyzeInterval:    24 * time.Hour,
+			IntegrityInterval:  24 * time.Hour,
+			PurgeInterval:      time.Hour,
+			TouchRetention:     90 * 24 * time.Hour,
+		},
+		RateLimits: map[string]string{
+			"redirect": "5/s:20",
+			"signup":   "2/s:10",
+			"write":    "10/s:20",
+			"signed":   "10/s:20",
+		},
+	}
+}
+
+// Load configuration from defaults, an optional YAML file, env vars and command line flags,
+// in increasing order of precedence. The YAML file is set with the -config flag or the
+// CONFIG_FILE env var. Load doesn't validate the configuration; see Validate.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	flags := flag.NewFlagSet("referrals", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	port := flags.Int("port", 0, "http server port")
+	dsn := flags.String("dsn", "", "database DSN: a sqlite file or postgres:// URL")
+	baseURL := flags.String("base-url", "", "public base URL for referral links")
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	if cfg.File = *path; *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "dsn":
+			cfg.Database.DSN = *dsn
+		case "base-url":
+			cfg.Server.BaseURL = *baseURL
+		}
+	})
+	return cfg, nil
+}
+
+// Load configuration from a YAML file over the current values.
+func (self *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(self); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %s", path, err.Error())
+	}
+	return nil
+}
+
+// Load configuration from env vars over the current values.
+func (self *Config) loadEnv() error {
+	env := envLoader{}
+	env.int("PORT", &self.Server.Port)
+	env.string("BASE_URL", &self.Server.BaseURL)
+	env.bool("DISABLE_COLOR", &self.Server.DisableColor)
+	env.duration("SHUTDOWN_TIMEOUT", &self.Server.ShutdownTimeout)
+	env.bool("LEGACY_ERRORS", &self.Server.LegacyErrors)
+	env.list("TRUSTED_PROXIES", &self.Server.TrustedProxies)
+	env.string("DB_DSN", &self.Database.DSN)
+	env.int("DB_READ_CONNS", &self.Database.ReadConns)
+	env.bool("DB_REPLICATED", &self.Database.Replicated)
+	env.string("DB_MIGRATE", &self.Database.Migrate)
+	env.string("SIGNUP_URL", &self.Signup.URL)
+	env.string("SIGNUP_COOKIE_PATH", &self.Signup.CookiePath)
+	env.string("SIGNUP_COOKIE_DOMAIN", &self.Signup.CookieDomain)
+	env.duration("SIGNUP_COOKIE_MAX_AGE", &self.Signup.CookieMaxAge)
+	env.string("ATTRIBUTION_MODE", &self.Redirect.Attribution)
+	env.list("REDIRECT_ALLOWLIST", &self.Redirect.Allowlist)
+	env.list("DEEP_LINK_SCHEMES", &self.Redirect.DeepLinkSchemes)
+	env.list("PASSTHROUGH_PARAMS", &self.Redirect.PassthroughParams)
+	env.string("PREVIEW_TEMPLATE", &self.Redirect.PreviewTemplate)
+	env.string("BOT_RULES", &self.Redirect.BotRules)
+	env.string("REFERRAL_TOKEN_SECRET", &self.Redirect.TokenSecret)
+	env.duration("REFERRAL_TOKEN_TTL", &self.Redirect.TokenTTL)
+	env.duration("CHALLENGE_TTL", &self.Session.ChallengeTTL)
+	env.duration("ACCESS_TOKEN_TTL", &self.Session.AccessTokenTTL)
+	env.duration("REFRESH_TOKEN_TTL", &self.Session.RefreshTokenTTL)
+	env.string("KEY_ENCRYPTION_KEY", &self.Session.KeyEncryptionKey)
+	env.duration("REVIEW_CLAIM_TTL", &self.Review.ClaimTTL)
+	env.string("FRAUD_HASH_SECRET", &self.Fraud.HashSecret)
+	env.int("PAGE_DEFAULT_LIMIT", &self.Paging.DefaultLimit)
+	env.int("PAGE_MAX_LIMIT", &self.Paging.MaxLimit)
+	env.duration("CHECKPOINT_INTERVAL", &self.Maintenance.CheckpointInterval)
+	env.duration("OPTIMIZE_INTERVAL", &self.Maintenance.OptimizeInterval)
+	env.duration("ANALYZE_INTERVAL", &self.Maintenance.AnalyzeInterval)
+	env.duration("INTEGRITY_CHECK_INTERVAL", &self.Maintenance.IntegrityInterval)
+	env.duration("PURGE_INTERVAL", &self.Maintenance.PurgeInterval)
+	env.duration("TOUCH_RETENTION", &self.Maintenance.TouchRetention)
+	if value, ok := os.LookupEnv("RATE_LIMITS"); ok {
+		for _, entry := range strings.Split(value, ",") {
+			name, limit, found := strings.Cut(strings.TrimSpace(entry), "=")
+			if !found {
+				env.errs = append(env.errs, fmt.Errorf("RATE_LIMITS: invalid entry: %s", entry))
+				continue
+			}
+			if self.RateLimits == nil {
+				self.RateLimits = make(map[string]string)
+			}
+			self.RateLimits[strings.TrimSpace(name)] = strings.TrimSpace(limit)
+		}
+	}
+	return errors.Join(env.errs...)
+}
+
+// Validate the configuration, returning every problem found.
+func (self Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(self.Server.Port > 0 && self.Server.Port < 65536, "server.port: must be between 1 and 65535")
+	check(isHTTPURL(self.Server.BaseURL), "server.baseUrl: must be an http(s) URL")
+	check(self.Server.ShutdownTimeout > 0, "server.shutdownTimeout: must be positive")
+	for _, proxy := range self.Server.TrustedProxies {
+		check(isIPOrCIDR(proxy), "server.trustedProxies: invalid IP or CIDR: %s", proxy)
+	}
+	if err := self.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(isHTTPURL(self.Signup.URL), "signup.url: must be an http(s) URL")
+	check(strings.HasPrefix(self.Signup.CookiePath, "/"), "signup.cookiePath: must start with /")
+	check(!strings.ContainsAny(self.Signup.CookieDomain, "/:; "), "signup.cookieDomain: must be a domain")
+	check(self.Signup.CookieMaxAge >= time.Minute, "signup.cookieMaxAge: must be at least 1m")
+	_, err := domain.ValidateAttribution(self.Redirect.Attribution)
+	check(err == nil, "redirect.attribution: must be one of %s", strings.Join(domain.AttributionModes, ", "))
+	for _, host := range self.Redirect.Allowlist {
+		check(host != "" && !strings.ContainsAny(host, "/: ") && !strings.Contains(strings.TrimPrefix(host, "*."), "*"),
+			"redirect.allowlist: invalid host: %s", host)
+	}
+	for _, scheme := range self.Redirect.DeepLinkSchemes {
+		check(isAppScheme(scheme), "redirect.deepLinkSchemes: invalid app scheme: %s", scheme)
+	}
+	for _, param := range self.Redirect.PassthroughParams {
+		check(param != "" && !strings.ContainsAny(param, "&= "), "redirect.passthroughParams: invalid param: %s", param)
+	}
+	check(isFile(self.Redirect.PreviewTemplate), "redirect.previewTemplate: file not found: %s", self.Redirect.PreviewTemplate)
+	check(isFile(self.Redirect.BotRules), "redirect.botRules: file not found: %s", self.Redirect.BotRules)
+	check(self.Redirect.TokenSecret == "" || len(self.Redirect.TokenSecret) >= 32,
+		"redirect.tokenSecret: must be at least 32 characters")
+	check(self.Redirect.TokenTTL > 0, "redirect.tokenTtl: must be positive")
+	check(self.Session.ChallengeTTL > 0, "session.challengeTtl: must be positive")
+	check(self.Session.AccessTokenTTL > 0, "session.accessTokenTtl: must be positive")
+	check(self.Session.RefreshTokenTTL > self.Session.AccessTokenTTL,
+		"session.refreshTokenTtl: must be longer than the access token ttl")
+	check(len(self.Session.KeyEncryptionKey) >= 32,
+		"session.keyEncryptionKey: must be at least 32 characters")
+	check(self.Review.ClaimTTL > 0, "review.claimTtl: must be positive")
+	check(len(self.Fraud.HashSecret) >= 32, "fraud.hashSecret: must be at least 32 characters")
+	check(self.Paging.DefaultLimit > 0, "paging.defaultLimit: must be positive")
+	check(self.Paging.MaxLimit >= self.Paging.DefaultLimit && self.Paging.MaxLimit <= 10000,
+		"paging.maxLimit: must be between the default limit and 10000")
+	maintenance := self.Maintenance
+	check(maintenance.CheckpointInterval >= 0 && maintenance.OptimizeInterval >= 0 &&
+		maintenance.AnalyzeInterval >= 0 && maintenance.IntegrityInterval >= 0 &&
+		maintenance.PurgeInterval >= 0,
+		"maintenance: intervals must not be negative")
+	check(maintenance.WALRestartMB > 0, "maintenance.walRestartMb: must be positive")
+	check(maintenance.TouchRetention >= self.Signup.CookieMaxAge,
+		"maintenance.touchRetention: must be at least the signup cookie max age")
+	if _, err := self.Limits(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate the database configuration.
+func (self Database) Validate() error {
+	var errs []error
+	if self.DSN == "" {
+		errs = append(errs, fmt.Errorf("database.dsn: required"))
+	}
+	if self.ReadConns < 1 || self.ReadConns > 256 {
+		errs = append(errs, fmt.Errorf("database.readConns: must be between 1 and 256"))
+	}
+	if self.Migrate != MigrateAuto && self.Migrate != MigrateVerify {
+		errs = append(errs, fmt.Errorf("database.migrate: must be %s or %s", MigrateAuto, MigrateVerify))
+	}
+	return errors.Join(errs...)
+}
+
+// Limits parses the configured rate limits.
+func (self Config) Limits() (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit, len(self.RateLimits))
+	var errs []error
+	for name, value := range self.RateLimits {
+		if !slices.Contains(RateLimitNames, name) {
+			errs = append(errs, fmt.Errorf("rateLimits.%s: unknown rate limit, must be one of: %s",
+				name, strings.Join(RateLimitNames, ", ")))
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rateLimits.%s: %s", name, err.Error()))
+			continue
+		}
+		limits[name] = limit
+	}
+	return limits, errors.Join(errs...)
+}
+
+// Check whether a value is an absolute http(s) URL.
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Check whether a value is a custom app URL scheme. Web and script schemes aren't app schemes.
+func isAppScheme(value string) bool {
+	parsed, err := url.Parse(value + ":")
+	if err != nil || !strings.EqualFold(parsed.Scheme, value) {
+		return false
+	}
+	return !slices.Contains([]string{"http", "https", "javascript", "data", "vbscript", "file", "blob"}, parsed.Scheme)
+}
+
+// Check whether a value is an IP address or CIDR range.
+func isIPOrCIDR(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
+
+// Check whether an optional file path exists.
+func isFile(path string) bool {
+	if path == "" {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Reload applies the reloadable sections of a new config (signup, redirect and rate limits)
+// over this config. Other sections need a restart; the names of any that changed are
+// returned so they can be reported.
+func (self Config) Reload(next Config) (Config, []string) {
+	var ignored []string
+	if !reflect.DeepEqual(self.Server, next.Server) {
+		ignored = append(ignored, "server")
+	}
+	if self.Database != next.Database {
+		ignored = append(ignored, "database")
+	}
+	if self.Session != next.Session {
+		ignored = append(ignored, "session")
+	}
+	if self.Review != next.Review {
+		ignored = append(ignored, "review")
+	}
+	if self.Fraud != next.Fraud {
+		ignored = append(ignored, "fraud")
+	}
+	if self.Paging != next.Paging {
+		ignored = append(ignored, "paging")
+	}
+	if self.Maintenance != next.Maintenance {
+		ignored = append(ignored, "maintenance")
+	}
+	self.Signup = next.Signup
+	self.Redirect = next.Redirect
+	self.RateLimits = next.RateLimits
+	self.File = next.File
+	return self, ignored
+}
+
+// Redacted returns the config keyed by YAML field names, with secrets redacted, for display.
+func (self Config) Redacted() (map[string]any, error) {
+	if self.Redirect.TokenSecret != "" {
+		self.Redirect.TokenSecret = redacted
+	}
+	if self.Session.KeyEncryptionKey != "" {
+		self.Session.KeyEncryptionKey = redacted
+	}
+	if self.Fraud.HashSecret != "" {
+		self.Fraud.HashSecret = redacted
+	}
+	self.Database.DSN = redactDSN(self.Database.DSN)
+	data, err := yaml.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	err = yaml.Unmarshal(data, &values)
+	return values, err
+}
+
+// redacted replaces secret values
+const redacted = "[redacted]"
+
+// Redact passwords in URL or key/value DSNs.
+func redactDSN(dsn string) string {
+	if parsed, err := url.Parse(dsn); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+			return parsed.String()
+		}
+	}
+	fields := strings.Fields(dsn)
+	for i, field := range fields {
+		if key, _, ok := strings.Cut(field, "="); ok && strings.EqualFold(key, "password") {
+			fields[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envLoader reads typed values from env vars, collecting parse errors.
+type envLoader struct {
+	errs []error
+}
+
+// Read a string env var.
+func (self *envLoader) string(name string, dest *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*dest = value
+	}
+}
+
+// Read an int env var.
+func (self *envLoader) int(name string, dest *int) {
+	if value, ok := os.LookupEnv(name); ok {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			self.errs = append(self.errs, fmt.Errorf("%s: expected int, got: %s", name, value))
+			return
+		}
+		*dest = i
+	}
+}
+
+// Read a bool env var. Set but empty means true.
+func (self *envLoader) bool(name string, dest *bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		if value == "" {
+			*dest = true
+			return
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			self.errs = append(self.errs, fmt.Errorf("%s: expected bool, got: %s", name, value))
+			return
+		}
+		*dest = b
+	}
+}
+
+// Read a duration env var.
+func (self *envLoader) duration(name string, dest *time.Duration) {
+	if value, ok := os.LookupEnv(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			self.errs = append(self.errs, fmt.Errorf("%s: expected duration, got: %s", name, value))
+			return
+		}
+		*dest = d
+	}
+}
+
+// Read a comma separated list env var.
+func (self *envLoader) list(name string, dest *[]string) {
+	if value, ok := os.LookupEnv(name); ok {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*dest = list
+	}
+}
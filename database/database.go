@@ -1,39 +1,63 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"runtime"
+	"strings"
 
-	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/config"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// ConnectAndMigrate connects to a database and runs migrations using project models.
-func ConnectAndMigrate() (*gorm.DB, *gorm.DB, error) {
-	dsn := dsnEnvLookup()
-	writeDB, err := Connect(dsn, 1)
+// ConnectAndMigrate connects to a database and migrates its schema in the configured mode.
+// Reads use a pool of the configured size. Writes use a single connection for sqlite, with
+// immediate transactions, and a pool of the same size for PostgreSQL.
+func ConnectAndMigrate(cfg config.Database) (*gorm.DB, *gorm.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	writeDSN, writeConns := ImmediateDSN(cfg.DSN), 1
+	if IsPostgres(cfg.DSN) {
+		writeDSN, writeConns = cfg.DSN, cfg.ReadConns
+	}
+	writeDB, err := Connect(writeDSN, writeConns)
 	if err != nil {
 		return nil, nil, err
 	}
-	readDB, err := Connect(dsn, max(4, runtime.NumCPU()))
+	readDB, err := Connect(cfg.DSN, cfg.ReadConns)
 	if err != nil {
+		closeDB(writeDB)
 		return nil, nil, err
 	}
-	if err := RunMigrations(writeDB); err != nil {
+	if err := Migrate(writeDB, cfg.Migrate); err != nil {
+		closeDB(readDB)
+		closeDB(writeDB)
 		return nil, nil, err
 	}
 	return readDB, writeDB, nil
 }
 
-// Connect to a sqlite3 database.
+// Connect to a database. DSNs with a postgres:// or postgresql:// scheme connect to
+// PostgreSQL, anything else to a sqlite3 database.
 func Connect(dsn string, maxConns int) (*gorm.DB, error) {
 	config := &gorm.Config{
-		Logger: logger.Discard, //Default.LogMode(logger.Info),
+		Logger:         logger.Discard, //Default.LogMode(logger.Info),
+		TranslateError: true,
+	}
+	if IsPostgres(dsn) {
+		db, err := gorm.Open(postgres.Open(dsn), config)
+		if err != nil {
+			return nil, err
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.SetMaxOpenConns(maxConns)
+		}
+		return db, nil
 	}
 	db, err := gorm.Open(sqlite.Open(dsn), config)
 	if err != nil {
@@ -48,9 +72,90 @@ func Connect(dsn string, maxConns int) (*gorm.DB, error) {
 	return db, nil
 }
 
-// Run migrations on a database using project models.
-func RunMigrations(db *gorm.DB) error {
-	return db.AutoMigrate(&model.Campaign{}, &model.Signup{})
+// IsPostgres checks whether a DSN is for a PostgreSQL database.
+func IsPostgres(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// ImmediateDSN makes transactions on a sqlite DSN take the write lock when they begin, so
+// check-then-insert transactions can't be interleaved with writers in other processes, and
+// waiting for the lock uses the busy timeout instead of failing mid transaction. DSNs that
+// set a transaction lock mode are left as is.
+func ImmediateDSN(dsn string) string {
+	if strings.Contains(dsn, "_txlock=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_txlock=immediate"
+	}
+	return dsn + "?_txlock=immediate"
+}
+
+// Check whether a connection is to a sqlite database.
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// WAL checkpoint modes
+const (
+	CheckpointPassive  = "PASSIVE"
+	CheckpointRestart  = "RESTART"
+	CheckpointTruncate = "TRUNCATE"
+)
+
+// CheckpointResult is the outcome of a WAL checkpoint.
+type CheckpointResult struct {
+	Busy         bool `json:"busy"`
+	LogFrames    int  `json:"logFrames"`
+	Checkpointed int  `json:"checkpointed"`
+}
+
+// Checkpoint copies WAL frames into the database file. PASSIVE checkpoints never block;
+// RESTART and TRUNCATE wait for readers so the WAL can be reset.
+func Checkpoint(db *gorm.DB, mode string) (result CheckpointResult, err error) {
+	var busy int
+	row := db.Raw(fmt.Sprintf("PRAGMA wal_checkpoint(%s);", mode)).Row()
+	if err = row.Scan(&busy, &result.LogFrames, &result.Checkpointed); err == nil {
+		result.Busy = busy != 0
+	}
+	return
+}
+
+// Close checkpoints the WAL and closes database connections. The read pool is closed first
+// so open read transactions don't hold back the checkpoint. Replicated databases only get a
+// passive checkpoint, leaving litestream in control of resetting the WAL; others have the
+// WAL truncated. PostgreSQL connections are just closed.
+func Close(readDB, writeDB *gorm.DB, replicated bool) error {
+	var errs []error
+	if sqlDB, err := readDB.DB(); err == nil && readDB != writeDB {
+		errs = append(errs, sqlDB.Close())
+	}
+	mode := CheckpointTruncate
+	if replicated {
+		mode = CheckpointPassive
+	}
+	if isSQLite(writeDB) {
+		result, err := Checkpoint(writeDB, mode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("wal checkpoint: %s", err.Error()))
+		} else if result.Busy {
+			log.Printf("wal checkpoint %s was busy: %d of %d frames checkpointed",
+				mode, result.Checkpointed, result.LogFrames)
+		}
+	}
+	if sqlDB, err := writeDB.DB(); err == nil {
+		errs = append(errs, sqlDB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Close a database connection pool, logging failures, when connecting or migrating fails.
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("unable to close database: %+v", err)
+		}
+	}
 }
 
 // Optimize a sqlite database for production.
@@ -71,12 +176,3 @@ func setPragmas(db *gorm.DB) error {
 	}
 	return nil
 }
-
-// Lookup db dsn param from env var
-func dsnEnvLookup() string {
-	dsn, ok := os.LookupEnv("DB_DSN")
-	if !ok {
-		log.Panicf("DB_DSN not defined")
-	}
-	return dsn
-}
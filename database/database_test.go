@@ -0,0 +1,251 @@
+package database_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/database"
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// The schema GORM AutoMigrate created before versioned migrations, with a campaign signup.
+const baselineSchema = "" +
+	"CREATE TABLE `campaigns` (`id` integer PRIMARY KEY AUTOINCREMENT,`address` text NOT NULL," +
+	"`name` text,`created_at` integer,`updated_at` integer);" +
+	"CREATE INDEX `idx_campaigns_address` ON `campaigns`(`address`);" +
+	"CREATE TABLE `signups` (`id` integer PRIMARY KEY AUTOINCREMENT,`campaign_id` integer NOT NULL," +
+	"`address` text NOT NULL,`status` text,`created_at` integer,`updated_at` integer," +
+	"CONSTRAINT `fk_signups_campaign` FOREIGN KEY (`campaign_id`) REFERENCES `campaigns`(`id`));" +
+	"CREATE UNIQUE INDEX `idx_signups_address` ON `signups`(`address`);" +
+	"CREATE INDEX `idx_signups_campaign_id` ON `signups`(`campaign_id`);" +
+	"INSERT INTO `campaigns` (`address`, `name`, `created_at`, `updated_at`) " +
+	"VALUES ('tp1baseline0referer000000000000000000000000', 'Baseline', 1, 1);" +
+	"INSERT INTO `signups` (`campaign_id`, `address`, `status`, `created_at`, `updated_at`) " +
+	"VALUES (1, 'tp1baseline0referee000000000000000000000000', 'pending', 1, 1);"
+
+// Check that a database has every column the models use.
+func checkModelColumns(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	models := []any{
+		&model.Campaign{}, &model.Touch{}, &model.Signup{}, &model.SignupEvent{}, &model.APIKey{},
+		&model.Challenge{}, &model.RefreshToken{}, &model.RevokedToken{}, &model.SigningKey{}, &model.UsedNonce{},
+	}
+	for _, value := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(value); err != nil {
+			t.Fatalf("failed to parse model: %+v", err)
+		}
+		for _, field := range stmt.Schema.DBNames {
+			if !db.Migrator().HasColumn(value, field) {
+				t.Fatalf("migrations are missing column %s.%s", stmt.Schema.Table, field)
+			}
+		}
+	}
+}
+
+func TestMaintainer(t *testing.T) {
+	db, err := database.Connect("file:maintainer?mode=memory&cache=shared", 1)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("unable to migrate: %+v", err)
+	}
+	maintainer := database.NewMaintainer(db, db, config.Default().Maintenance, false)
+	for _, name := range []string{database.TaskOptimize, database.TaskAnalyze, database.TaskIntegrity} {
+		if task, err := maintainer.RunMaintenanceTask(name); err != nil || task.Runs != 1 {
+			t.Fatalf("failed to run maintenance task %s: %+v %+v", name, task, err)
+		}
+	}
+	if _, err := maintainer.RunMaintenanceTask("vacuum"); err == nil {
+		t.Fatalf("expected unknown maintenance task error")
+	}
+	if tasks := maintainer.GetMaintenanceTasks(); len(tasks) != 5 {
+		t.Fatalf("got unexpected maintenance tasks: %+v", tasks)
+	}
+	if metrics := maintainer.GetMaintenanceMetrics(); metrics["analyze.runs"] != 1 || metrics["analyze.failures"] != 0 {
+		t.Fatalf("got unexpected maintenance metrics: %+v", metrics)
+	}
+	// Purges delete expired rows and keep live ones.
+	now := time.Now()
+	db.Create(&model.UsedNonce{Nonce: "expired", ExpiresAt: model.NewTime(now.Add(-time.Minute))})
+	db.Create(&model.UsedNonce{Nonce: "live", ExpiresAt: model.NewTime(now.Add(time.Minute))})
+	db.Create(&model.RevokedToken{JTI: "expired", ExpiresAt: model.NewTime(now.Add(-time.Minute))})
+	db.Create(&model.Challenge{Nonce: "expired", Address: "address", ExpiresAt: model.NewTime(now.Add(-time.Minute))})
+	db.Create(&model.Touch{VisitorID: "old", CampaignID: 1, CreatedAt: model.NewTime(now.Add(-100 * 24 * time.Hour))})
+	db.Create(&model.Touch{VisitorID: "new", CampaignID: 1})
+	if _, err := maintainer.RunMaintenanceTask(database.TaskPurge); err != nil {
+		t.Fatalf("failed to purge: %+v", err)
+	}
+	for table, expected := range map[string]int64{"used_nonces": 1, "revoked_tokens": 0, "challenges": 0, "touches": 1} {
+		var count int64
+		if db.Table(table).Count(&count); count != expected {
+			t.Fatalf("expected %d %s after purge, got: %d", expected, table, count)
+		}
+	}
+	if metrics := maintainer.GetMaintenanceMetrics(); metrics["purge.touches"] != 1 {
+		t.Fatalf("got unexpected purge metrics: %+v", metrics)
+	}
+	replicated := database.NewMaintainer(db, db, config.Default().Maintenance, true)
+	if _, err := replicated.RunMaintenanceTask(database.TaskCheckpoint); err == nil {
+		t.Fatalf("expected checkpoints to be disabled for replicated databases")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := database.Connect("file:migrations?mode=memory&cache=shared", 1)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	applied, err := database.MigrateUp(db, 0)
+	if err != nil || len(applied) == 0 {
+		t.Fatalf("failed to migrate up: %+v %+v", applied, err)
+	}
+	checkModelColumns(t, db)
+	if pending, err := database.PendingMigrations(db); err != nil || len(pending) != 0 {
+		t.Fatalf("got unexpected pending migrations: %+v %+v", pending, err)
+	}
+	// The baseline can't be rolled back, so nothing is rolled back when steps reach it.
+	if rolledBack, err := database.MigrateDown(db, len(applied)); err == nil || len(rolledBack) != 0 {
+		t.Fatalf("expected baseline rollback to be refused, got: %+v %+v", rolledBack, err)
+	}
+	if _, err := database.MigrateDown(db, len(applied)-1); err != nil {
+		t.Fatalf("failed to migrate down: %+v", err)
+	}
+	if db.Migrator().HasTable(&model.Touch{}) || db.Migrator().HasColumn(&model.Campaign{}, "filtered_hits") {
+		t.Fatalf("expected migrations after the baseline to be rolled back")
+	}
+	if !db.Migrator().HasTable(&model.Campaign{}) || !db.Migrator().HasTable(&model.Signup{}) {
+		t.Fatalf("expected baseline tables to be kept")
+	}
+	if _, err := database.MigrateUp(db, 0); err != nil {
+		t.Fatalf("failed to migrate up again: %+v", err)
+	}
+	// Refuse to migrate a schema ahead of the binary.
+	db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', 0)")
+	if err := database.Migrate(db, config.MigrateAuto); !errors.Is(err, database.ErrSchemaAhead) {
+		t.Fatalf("expected schema ahead error, got: %+v", err)
+	}
+	statuses, err := database.GetMigrationStatus(db)
+	if err != nil || !statuses[len(statuses)-1].Unknown {
+		t.Fatalf("got unexpected migration status: %+v %+v", statuses, err)
+	}
+}
+
+func TestBaselineMigration(t *testing.T) {
+	db, err := database.Connect("file:baseline?mode=memory&cache=shared", 1)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	if err := db.Exec(baselineSchema).Error; err != nil {
+		t.Fatalf("failed to create baseline schema: %+v", err)
+	}
+	if err := database.Migrate(db, config.MigrateAuto); err != nil {
+		t.Fatalf("failed to migrate baseline schema: %+v", err)
+	}
+	checkModelColumns(t, db)
+	campaignRepo := repo.NewCampaignRepo(db, db)
+	campaign, err := campaignRepo.GetCampaign(1)
+	if err != nil || campaign.Name != "Baseline" || campaign.FilteredHits != 0 {
+		t.Fatalf("failed to get baseline campaign: %+v %+v", campaign, err)
+	}
+	if err := repo.NewTouchRepo(db, db).RecordFilteredHits(map[uint64]uint64{campaign.ID: 1}); err != nil {
+		t.Fatalf("failed to record filtered hits: %+v", err)
+	}
+	signupRepo := repo.NewSignupRepo(db, db)
+	meta := domain.SignupMeta{Risk: domain.Risk{Score: 10, IPHash: "ip"}, VisitorID: "visitor"}
+	signup, err := signupRepo.CreateSignup(campaign.ID, "tp1baseline0referee000000000000000000000001", meta)
+	if err != nil || signup.RiskScore != 10 {
+		t.Fatalf("failed to create signup on baseline schema: %+v %+v", signup, err)
+	}
+	if next, signups := signupRepo.GetSignups(campaign.ID, 0, 10); len(signups) != 2 || next != signup.ID {
+		t.Fatalf("got unexpected baseline signups: %d %+v", next, signups)
+	}
+}
+
+func TestImmediateTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "immediate.db")
+	cfg := config.Database{DSN: path, ReadConns: 1, Migrate: config.MigrateAuto}
+	readDB, writeDB, err := database.ConnectAndMigrate(cfg)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	defer database.Close(readDB, writeDB, false)
+	other, err := sql.Open("sqlite3", path+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatalf("unable to open other connection: %+v", err)
+	}
+	defer other.Close()
+	// Write transactions hold the write lock from the start, before any statement runs.
+	writeDB.Transaction(func(tx *gorm.DB) error {
+		if _, err := other.Exec("BEGIN IMMEDIATE"); err == nil {
+			t.Fatalf("expected write lock to be held by the write transaction")
+		}
+		return nil
+	})
+	if _, err := other.Exec("BEGIN IMMEDIATE; ROLLBACK;"); err != nil {
+		t.Fatalf("expected write lock to be released after the transaction: %+v", err)
+	}
+}
+
+// Get the size of a database's WAL file, or -1 when there isn't one.
+func walSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path + "-wal")
+	if errors.Is(err, os.ErrNotExist) {
+		return -1
+	}
+	if err != nil {
+		t.Fatalf("unable to stat wal: %+v", err)
+	}
+	return info.Size()
+}
+
+func TestCheckpointAndClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.db")
+	cfg := config.Database{DSN: path, ReadConns: 2, Migrate: config.MigrateAuto}
+	readDB, writeDB, err := database.ConnectAndMigrate(cfg)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	campaignRepo := repo.NewCampaignRepo(readDB, writeDB)
+	if _, err := campaignRepo.CreateCampaign("tp1checkpoint0referer0000000000000000000000", "First", domain.CampaignOptions{}); err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	// Frames written after an open read transaction started can't be checkpointed until it ends.
+	reader := readDB.Begin()
+	var count int64
+	reader.Model(&model.Campaign{}).Count(&count)
+	if _, err := campaignRepo.CreateCampaign("tp1checkpoint0referer0000000000000000000000", "Second", domain.CampaignOptions{}); err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	result, err := database.Checkpoint(writeDB, database.CheckpointPassive)
+	if err != nil || result.LogFrames == 0 || result.Checkpointed >= result.LogFrames {
+		t.Fatalf("expected open read transaction to hold back checkpoint: %+v %+v", result, err)
+	}
+	size := walSize(t, path)
+	if size <= 0 {
+		t.Fatalf("expected passive checkpoint to leave the wal in place, got size: %d", size)
+	}
+	reader.Rollback()
+	// Close closes the read pool before truncating the WAL, then closes the write connection.
+	if err := database.Close(readDB, writeDB, false); err != nil {
+		t.Fatalf("failed to close database: %+v", err)
+	}
+	if size := walSize(t, path); size > 0 {
+		t.Fatalf("expected wal to be truncated on close, got size: %d", size)
+	}
+	for _, db := range []*gorm.DB{readDB, writeDB} {
+		if sqlDB, _ := db.DB(); sqlDB.Ping() == nil {
+			t.Fatalf("expected database connections to be closed")
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// Maintenance task names
+const (
+	TaskCheckpoint = "checkpoint"
+	TaskOptimize   = "optimize"
+	TaskAnalyze    = "analyze"
+	TaskIntegrity  = "integrity"
+	TaskPurge      = "purge"
+)
+
+// maintenanceTask is a database maintenance task run on an interval.
+type maintenanceTask struct {
+	interval time.Duration
+	run      func() (string, error)
+}
+
+// Maintainer runs scheduled database maintenance: WAL checkpoints based on WAL size, query
+// planner optimization, statistics updates, integrity checks and purges of expired rows.
+type Maintainer struct {
+	readDB  *gorm.DB
+	writeDB *gorm.DB
+	cfg     config.Maintenance
+	tasks   map[string]maintenanceTask
+	mu      sync.Mutex
+	status  map[string]domain.MaintenanceTask
+	metrics map[string]int64
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewMaintainer creates a maintenance scheduler. WAL checkpoints are skipped for replicated
+// databases, where litestream manages the WAL. PostgreSQL databases only get ANALYZE runs and
+// purges, leaving the rest to autovacuum.
+func NewMaintainer(readDB, writeDB *gorm.DB, cfg config.Maintenance, replicated bool) *Maintainer {
+	self := &Maintainer{
+		readDB:  readDB,
+		writeDB: writeDB,
+		cfg:     cfg,
+		status:  make(map[string]domain.MaintenanceTask),
+		metrics: make(map[string]int64),
+		done:    make(chan struct{}),
+	}
+	self.tasks = map[string]maintenanceTask{
+		TaskAnalyze: {cfg.AnalyzeInterval, self.analyze},
+		TaskPurge:   {cfg.PurgeInterval, self.purge},
+	}
+	if isSQLite(writeDB) {
+		self.tasks[TaskOptimize] = maintenanceTask{cfg.OptimizeInterval, self.optimize}
+		self.tasks[TaskIntegrity] = maintenanceTask{cfg.IntegrityInterval, self.integrity}
+		if !replicated {
+			self.tasks[TaskCheckpoint] = maintenanceTask{cfg.CheckpointInterval, self.checkpoint}
+		}
+	}
+	for name, task := range self.tasks {
+		self.status[name] = domain.MaintenanceTask{Name: name, Interval: task.interval.String()}
+	}
+	return self
+}
+
+// Start running tasks on their intervals. Tasks with a zero interval only run on demand.
+func (self *Maintainer) Start() {
+	for name, task := range self.tasks {
+		if task.interval <= 0 {
+			continue
+		}
+		self.wg.Add(1)
+		go self.schedule(name, task.interval)
+	}
+}
+
+// Stop scheduling tasks, waiting for any running task to finish.
+func (self *Maintainer) Stop() {
+	close(self.done)
+	self.wg.Wait()
+}
+
+// RunMaintenanceTask runs a task by name now.
+func (self *Maintainer) RunMaintenanceTask(name string) (domain.MaintenanceTask, error) {
+	task, ok := self.tasks[name]
+	if !ok {
+		return domain.MaintenanceTask{}, domain.NewError(domain.ErrNotFound, "maintenance task not found: %s", name)
+	}
+	start := time.Now()
+	result, err := task.run()
+	return self.record(name, start, result, err), err
+}
+
+// GetMaintenanceTasks gets the status of all maintenance tasks.
+func (self *Maintainer) GetMaintenanceTasks() []domain.MaintenanceTask {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	tasks := make([]domain.MaintenanceTask, 0, len(self.status))
+	for _, status := range self.status {
+		tasks = append(tasks, status)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+// GetMaintenanceMetrics gets task run and failure counters and the last measured WAL size.
+func (self *Maintainer) GetMaintenanceMetrics() map[string]int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return maps.Clone(self.metrics)
+}
+
+// Run a task on an interval until stopped.
+func (self *Maintainer) schedule(name string, interval time.Duration) {
+	defer self.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			if _, err := self.RunMaintenanceTask(name); err != nil {
+				log.Printf("maintenance task %s failed: %s", name, err.Error())
+			}
+		}
+	}
+}
+
+// Record the outcome of a task run in its status and metrics.
+func (self *Maintainer) record(name string, start time.Time, result string, err error) domain.MaintenanceTask {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	status := self.status[name]
+	status.Runs++
+	status.LastRunAt = &start
+	status.LastDurationMs = time.Since(start).Milliseconds()
+	status.LastResult, status.LastError = result, ""
+	self.metrics[name+".runs"]++
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+		self.metrics[name+".failures"]++
+	}
+	self.status[name] = status
+	return status
+}
+
+// Checkpoint the WAL passively, restarting it when it has grown past the configured size.
+func (self *Maintainer) checkpoint() (string, error) {
+	result, err := Checkpoint(self.writeDB, CheckpointPassive)
+	if err != nil {
+		return "", err
+	}
+	var pageSize int64
+	if err := self.writeDB.Raw("PRAGMA page_size;").Row().Scan(&pageSize); err != nil {
+		return "", err
+	}
+	walBytes := int64(result.LogFrames) * pageSize
+	self.mu.Lock()
+	self.metrics["checkpoint.walBytes"] = walBytes
+	self.mu.Unlock()
+	mode := CheckpointPassive
+	if walBytes >= self.cfg.WALRestartMB<<20 {
+		mode = CheckpointRestart
+		if result, err = Checkpoint(self.writeDB, mode); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s: %d of %d frames checkpointed, busy=%t",
+		mode, result.Checkpointed, result.LogFrames, result.Busy), nil
+}
+
+// Let sqlite update query planner statistics it thinks are stale.
+func (self *Maintainer) optimize() (string, error) {
+	return "ok", self.writeDB.Exec("PRAGMA optimize;").Error
+}
+
+// Update query planner statistics for all tables and indexes.
+func (self *Maintainer) analyze() (string, error) {
+	return "ok", self.writeDB.Exec("ANALYZE;").Error
+}
+
+// Check the database for corruption.
+func (self *Maintainer) integrity() (string, error) {
+	var rows []string
+	if err := self.readDB.Raw("PRAGMA quick_check;").Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 1 && rows[0] == "ok" {
+		return "ok", nil
+	}
+	return "", fmt.Errorf("quick_check found %d problems: %v", len(rows), rows)
+}
+
+// Delete rows that are no longer needed: used token nonces, challenges and revoked token IDs
+// past their expiry, and referral clicks older than the touch retention.
+func (self *Maintainer) purge() (string, error) {
+	now := time.Now()
+	stmts := []struct {
+		table  string
+		column string
+		before time.Time
+	}{
+		{"used_nonces", "expires_at", now},
+		{"challenges", "expires_at", now},
+		{"revoked_tokens", "expires_at", now},
+		{"touches", "created_at", now.Add(-self.cfg.TouchRetention)},
+	}
+	counts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		sql := fmt.Sprintf("DELETE FROM %s WHERE %s < ?;", stmt.table, stmt.column)
+		result := self.writeDB.Exec(sql, stmt.before.Unix())
+		if result.Error != nil {
+			return "", fmt.Errorf("purge %s: %w", stmt.table, result.Error)
+		}
+		counts[i] = fmt.Sprintf("%s=%d", stmt.table, result.RowsAffected)
+		self.mu.Lock()
+		self.metrics["purge."+stmt.table] += result.RowsAffected
+		self.mu.Unlock()
+	}
+	return "deleted " + strings.Join(counts, " "), nil
+}
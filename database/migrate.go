@@ -0,0 +1,289 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/config"
+	"gorm.io/gorm"
+)
+
+// Versioned migrations, one directory per dialect, named VERSION_NAME.up.sql and
+// VERSION_NAME.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaAhead is returned when a database has migrations applied that this binary
+// doesn't know about, which usually means an older release is running against a newer schema.
+var ErrSchemaAhead = errors.New("database schema is ahead of this binary")
+
+// migrationLockID is the PostgreSQL advisory lock key held while applying migrations.
+const migrationLockID = 7263015
+
+// baselineVersion is the migration that adopts the schema GORM AutoMigrate created before
+// versioned migrations. It's never rolled back, since adopted databases keep their data in it.
+const baselineVersion = 1
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is the state of a migration in a database.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+	// Unknown is set for applied migrations that this binary doesn't have.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// appliedMigration is a row in the schema_migrations table.
+type appliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt int64
+}
+
+// Migrate brings a database schema up to date at startup. In verify mode pending migrations
+// are an error instead of being applied. A schema ahead of the binary is always an error.
+func Migrate(db *gorm.DB, mode string) error {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if mode == config.MigrateVerify {
+		return fmt.Errorf("%d pending migrations, starting with %04d_%s: run `referrals migrate up`",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	_, err = MigrateUp(db, 0)
+	return err
+}
+
+// RunMigrations applies all pending migrations to a database.
+func RunMigrations(db *gorm.DB) error {
+	_, err := MigrateUp(db, 0)
+	return err
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them when steps is zero.
+// Each migration is applied in its own transaction.
+func MigrateUp(db *gorm.DB, steps int) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	for i, migration := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Another instance may have applied the migration since pending migrations were read.
+			if applied, err := lockMigration(tx, migration.Version); err != nil || applied {
+				return err
+			}
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().Unix()).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %04d_%s: %s", migration.Version, migration.Name, err.Error())
+		}
+	}
+	return pending, nil
+}
+
+// MigrateDown rolls back up to steps applied migrations, latest first. Rolling back the
+// baseline migration is refused, so no steps are rolled back when steps would reach it.
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaAhead(migrations, applied); err != nil {
+		return nil, err
+	}
+	var rollbacks []Migration
+	for i := len(migrations) - 1; i >= 0 && len(rollbacks) < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; !ok {
+			continue
+		}
+		if migrations[i].Version <= baselineVersion {
+			return nil, fmt.Errorf("migration %04d_%s is the baseline and can't be rolled back",
+				migrations[i].Version, migrations[i].Name)
+		}
+		rollbacks = append(rollbacks, migrations[i])
+	}
+	for i, migration := range rollbacks {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return rollbacks[:i], fmt.Errorf("migration %04d_%s: %s", migration.Version, migration.Name, err.Error())
+		}
+	}
+	return rollbacks, nil
+}
+
+// PendingMigrations gets the migrations not yet applied to a database, returning
+// ErrSchemaAhead if the database has migrations this binary doesn't know about.
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaAhead(migrations, applied); err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// GetMigrationStatus gets the state of all known and applied migrations in version order.
+func GetMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, applied, err := loadMigrationState(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := time.Unix(row.AppliedAt, 0)
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			appliedAt := time.Unix(row.AppliedAt, 0)
+			statuses = append(statuses, MigrationStatus{version, row.Name, &appliedAt, true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Load the migrations for a database dialect and the migrations applied to the database,
+// creating the schema_migrations table if needed.
+func loadMigrationState(db *gorm.DB) ([]Migration, map[int]appliedMigration, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at integer NOT NULL
+	)`).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows []appliedMigration
+	if err := db.Raw("SELECT version, name, applied_at FROM schema_migrations").Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return migrations, applied, nil
+}
+
+// Lock migrations for the rest of a transaction and check whether a migration has been
+// applied. sqlite write transactions are already exclusive; PostgreSQL instances sharing a
+// database take an advisory lock.
+func lockMigration(tx *gorm.DB, version int) (bool, error) {
+	if !isSQLite(tx) {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return false, err
+		}
+	}
+	var count int64
+	err := tx.Raw("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", version).Scan(&count).Error
+	return count > 0, err
+}
+
+// Check for applied migrations newer than the latest known migration.
+func checkSchemaAhead(migrations []Migration, applied map[int]appliedMigration) error {
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("%w: migration %d applied, latest known is %d", ErrSchemaAhead, version, latest)
+		}
+	}
+	return nil
+}
+
+// Load the embedded migrations for a database dialect in version order.
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s databases", dialect)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionStr, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || !found || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names: %s, %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing an up or down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
@@ -0,0 +1,22 @@
+-- Baseline schema, matching the sqlite baseline.
+
+CREATE TABLE campaigns (
+  id bigserial PRIMARY KEY,
+  address text NOT NULL,
+  name text,
+  created_at bigint,
+  updated_at bigint
+);
+CREATE INDEX idx_campaigns_address ON campaigns (address);
+
+CREATE TABLE signups (
+  id bigserial PRIMARY KEY,
+  campaign_id bigint NOT NULL,
+  address text NOT NULL,
+  status text,
+  created_at bigint,
+  updated_at bigint,
+  CONSTRAINT fk_signups_campaign FOREIGN KEY (campaign_id) REFERENCES campaigns (id)
+);
+CREATE UNIQUE INDEX idx_signups_address ON signups (address);
+CREATE INDEX idx_signups_campaign_id ON signups (campaign_id);
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS used_nonces;
+DROP TABLE IF EXISTS signing_keys;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS challenges;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS signup_events;
+DROP TABLE IF EXISTS touches;
+DROP INDEX IF EXISTS idx_signups_created_at;
+DROP INDEX IF EXISTS idx_signups_visitor_id;
+DROP INDEX IF EXISTS idx_signups_fingerprint;
+DROP INDEX IF EXISTS idx_signups_ip_hash;
+ALTER TABLE signups DROP COLUMN risk_score;
+ALTER TABLE signups DROP COLUMN risk_reasons;
+ALTER TABLE signups DROP COLUMN ip_hash;
+ALTER TABLE signups DROP COLUMN fingerprint;
+ALTER TABLE signups DROP COLUMN visitor_id;
+ALTER TABLE signups DROP COLUMN params;
+ALTER TABLE signups DROP COLUMN claimed_by;
+ALTER TABLE signups DROP COLUMN claimed_at;
+ALTER TABLE campaigns DROP COLUMN attribution;
+ALTER TABLE campaigns DROP COLUMN utm;
+ALTER TABLE campaigns DROP COLUMN destination;
+ALTER TABLE campaigns DROP COLUMN ios_url;
+ALTER TABLE campaigns DROP COLUMN android_url;
+ALTER TABLE campaigns DROP COLUMN deep_link;
+ALTER TABLE campaigns DROP COLUMN description;
+ALTER TABLE campaigns DROP COLUMN image_url;
+ALTER TABLE campaigns DROP COLUMN filtered_hits;
@@ -0,0 +1,3 @@
+-- The baseline can't be rolled back, since adopted databases keep their data in it.
+-- MigrateDown refuses to go below this version.
+SELECT 1;
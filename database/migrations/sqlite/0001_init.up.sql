@@ -0,0 +1,23 @@
+-- Baseline schema, as created by GORM AutoMigrate before versioned migrations. Tables are
+-- created only when missing so existing databases adopt this version.
+
+CREATE TABLE IF NOT EXISTS `campaigns` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `address` text NOT NULL,
+  `name` text,
+  `created_at` integer,
+  `updated_at` integer
+);
+CREATE INDEX IF NOT EXISTS `idx_campaigns_address` ON `campaigns`(`address`);
+
+CREATE TABLE IF NOT EXISTS `signups` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `campaign_id` integer NOT NULL,
+  `address` text NOT NULL,
+  `status` text,
+  `created_at` integer,
+  `updated_at` integer,
+  CONSTRAINT `fk_signups_campaign` FOREIGN KEY (`campaign_id`) REFERENCES `campaigns`(`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_signups_address` ON `signups`(`address`);
+CREATE INDEX IF NOT EXISTS `idx_signups_campaign_id` ON `signups`(`campaign_id`);
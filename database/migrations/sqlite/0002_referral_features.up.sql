@@ -0,0 +1,103 @@
+-- Referral features added after the baseline: campaign destinations and previews, signup
+-- risk scores and reviews, touches, API keys and sessions.
+
+ALTER TABLE `campaigns` ADD COLUMN `attribution` text;
+ALTER TABLE `campaigns` ADD COLUMN `utm` text;
+ALTER TABLE `campaigns` ADD COLUMN `destination` text;
+ALTER TABLE `campaigns` ADD COLUMN `ios_url` text;
+ALTER TABLE `campaigns` ADD COLUMN `android_url` text;
+ALTER TABLE `campaigns` ADD COLUMN `deep_link` text;
+ALTER TABLE `campaigns` ADD COLUMN `description` text;
+ALTER TABLE `campaigns` ADD COLUMN `image_url` text;
+ALTER TABLE `campaigns` ADD COLUMN `filtered_hits` integer NOT NULL DEFAULT 0;
+
+CREATE TABLE `touches` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `visitor_id` text NOT NULL,
+  `campaign_id` integer NOT NULL,
+  `params` text,
+  `created_at` integer
+);
+CREATE INDEX `idx_touches_campaign_id` ON `touches`(`campaign_id`);
+CREATE INDEX `idx_touches_visitor_id` ON `touches`(`visitor_id`);
+
+ALTER TABLE `signups` ADD COLUMN `risk_score` integer;
+ALTER TABLE `signups` ADD COLUMN `risk_reasons` text;
+ALTER TABLE `signups` ADD COLUMN `ip_hash` text;
+ALTER TABLE `signups` ADD COLUMN `fingerprint` text;
+ALTER TABLE `signups` ADD COLUMN `visitor_id` text;
+ALTER TABLE `signups` ADD COLUMN `params` text;
+ALTER TABLE `signups` ADD COLUMN `claimed_by` text;
+ALTER TABLE `signups` ADD COLUMN `claimed_at` integer;
+CREATE INDEX `idx_signups_created_at` ON `signups`(`created_at`);
+CREATE INDEX `idx_signups_visitor_id` ON `signups`(`visitor_id`);
+CREATE INDEX `idx_signups_fingerprint` ON `signups`(`fingerprint`);
+CREATE INDEX `idx_signups_ip_hash` ON `signups`(`ip_hash`);
+
+CREATE TABLE `signup_events` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `signup_id` integer NOT NULL,
+  `from_status` text,
+  `to_status` text,
+  `actor` text,
+  `created_at` integer
+);
+CREATE INDEX `idx_signup_events_signup_id` ON `signup_events`(`signup_id`);
+
+CREATE TABLE `api_keys` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text NOT NULL,
+  `prefix` text NOT NULL,
+  `hash` text NOT NULL,
+  `scopes` text NOT NULL,
+  `revoked_at` integer,
+  `created_at` integer,
+  `updated_at` integer
+);
+CREATE INDEX `idx_api_keys_prefix` ON `api_keys`(`prefix`);
+CREATE UNIQUE INDEX `idx_api_keys_hash` ON `api_keys`(`hash`);
+
+CREATE TABLE `challenges` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `nonce` text NOT NULL,
+  `address` text NOT NULL,
+  `expires_at` integer NOT NULL,
+  `used_at` integer,
+  `created_at` integer
+);
+CREATE UNIQUE INDEX `idx_challenges_nonce` ON `challenges`(`nonce`);
+
+CREATE TABLE `refresh_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `hash` text NOT NULL,
+  `address` text NOT NULL,
+  `expires_at` integer NOT NULL,
+  `revoked_at` integer,
+  `created_at` integer,
+  `updated_at` integer
+);
+CREATE INDEX `idx_refresh_tokens_address` ON `refresh_tokens`(`address`);
+CREATE UNIQUE INDEX `idx_refresh_tokens_hash` ON `refresh_tokens`(`hash`);
+
+CREATE TABLE `revoked_tokens` (
+  `jti` text,
+  `expires_at` integer NOT NULL,
+  PRIMARY KEY (`jti`)
+);
+CREATE INDEX `idx_revoked_tokens_expires_at` ON `revoked_tokens`(`expires_at`);
+
+CREATE TABLE `signing_keys` (
+  `id` text,
+  `private_key` blob NOT NULL,
+  `created_at` integer,
+  `retired_at` integer,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE `used_nonces` (
+  `nonce` text,
+  `expires_at` integer NOT NULL,
+  `created_at` integer,
+  PRIMARY KEY (`nonce`)
+);
+CREATE INDEX `idx_used_nonces_expires_at` ON `used_nonces`(`expires_at`);
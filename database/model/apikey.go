@@ -0,0 +1,35 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// APIKey represents a hashed API key with space separated scopes.
+type APIKey struct {
+	ID        uint64 `gorm:"primarykey"`
+	Name      string `gorm:"not null"`
+	Prefix    string `gorm:"index;not null"`
+	Hash      string `gorm:"uniqueIndex;not null"`
+	Scopes    string `gorm:"not null"`
+	RevokedAt Time
+	CreatedAt Time
+	UpdatedAt Time
+}
+
+// ToDomain converts a model to a domain object representation.
+func (self APIKey) ToDomain() domain.APIKey {
+	key := domain.APIKey{
+		ID:        self.ID,
+		Name:      self.Name,
+		Prefix:    self.Prefix,
+		Scopes:    strings.Fields(self.Scopes),
+		CreatedAt: self.CreatedAt.FromUnix(),
+	}
+	if self.RevokedAt > 0 {
+		revokedAt := self.RevokedAt.FromUnix()
+		key.RevokedAt = &revokedAt
+	}
+	return key
+}
@@ -4,20 +4,64 @@ import "github.com/carp-cobain/referrals/domain"
 
 // Campaign represents a named referral campaign for a blockchain address.
 type Campaign struct {
-	ID        uint64 `gorm:"primarykey"`
-	Address   string `gorm:"index;not null"`
-	Name      string
-	CreatedAt Time
-	UpdatedAt Time
+	ID           uint64 `gorm:"primarykey"`
+	Address      string `gorm:"index;not null"`
+	Name         string
+	Attribution  string
+	UTM          string
+	Destination  string
+	IOSURL       string
+	AndroidURL   string
+	DeepLink     string
+	Description  string
+	ImageURL     string
+	FilteredHits uint64 `gorm:"not null;default:0"`
+	CreatedAt    Time
+	UpdatedAt    Time
 }
 
 // ToDomain converts a model to a domain object representation.
 func (self Campaign) ToDomain() domain.Campaign {
 	return domain.Campaign{
-		ID:        self.ID,
-		Address:   self.Address,
-		Name:      self.Name,
-		CreatedAt: self.CreatedAt.FromUnix(),
-		UpdatedAt: self.UpdatedAt.FromUnix(),
+		ID:      self.ID,
+		Address: self.Address,
+		Name:    self.Name,
+		CampaignOptions: domain.CampaignOptions{
+			Attribution: self.Attribution,
+			UTM:         domain.ParseParams(self.UTM),
+			CampaignDestinations: domain.CampaignDestinations{
+				Destination: self.Destination,
+				IOSURL:      self.IOSURL,
+				AndroidURL:  self.AndroidURL,
+				DeepLink:    self.DeepLink,
+			},
+			CampaignPreview: domain.CampaignPreview{
+				Description: self.Description,
+				ImageURL:    self.ImageURL,
+			},
+		},
+		FilteredHits: self.FilteredHits,
+		CreatedAt:    self.CreatedAt.FromUnix(),
+		UpdatedAt:    self.UpdatedAt.FromUnix(),
+	}
+}
+
+// Touch is a recorded click on a referral link by a visitor.
+type Touch struct {
+	ID         uint64 `gorm:"primarykey"`
+	VisitorID  string `gorm:"index;not null"`
+	CampaignID uint64 `gorm:"index;not null"`
+	Params     string
+	CreatedAt  Time
+}
+
+// ToDomain converts a model to a domain object representation.
+func (self Touch) ToDomain() domain.Touch {
+	return domain.Touch{
+		ID:         self.ID,
+		VisitorID:  self.VisitorID,
+		CampaignID: self.CampaignID,
+		Params:     domain.ParseParams(self.Params),
+		CreatedAt:  self.CreatedAt.FromUnix(),
 	}
 }
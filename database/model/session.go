@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// Challenge is a one time sign in message for an address.
+type Challenge struct {
+	ID        uint64 `gorm:"primarykey"`
+	Nonce     string `gorm:"uniqueIndex;not null"`
+	Address   string `gorm:"not null"`
+	ExpiresAt Time   `gorm:"not null"`
+	UsedAt    Time
+	CreatedAt Time
+}
+
+// RefreshToken is a hashed session refresh token for an address.
+type RefreshToken struct {
+	ID        uint64 `gorm:"primarykey"`
+	Hash      string `gorm:"uniqueIndex;not null"`
+	Address   string `gorm:"index;not null"`
+	ExpiresAt Time   `gorm:"not null"`
+	RevokedAt Time
+	CreatedAt Time
+	UpdatedAt Time
+}
+
+// RevokedToken is the ID of an access token revoked before it expired.
+type RevokedToken struct {
+	JTI       string `gorm:"primarykey"`
+	ExpiresAt Time   `gorm:"index;not null"`
+}
+
+// SigningKey is an Ed25519 key used to sign access tokens. The private key is encrypted with
+// the key encryption key.
+type SigningKey struct {
+	ID         string `gorm:"primarykey"`
+	PrivateKey []byte `gorm:"not null"`
+	CreatedAt  Time
+	RetiredAt  Time
+}
+
+// ToDomain converts a model to a domain object representation.
+func (self SigningKey) ToDomain() domain.SigningKey {
+	key := domain.SigningKey{
+		ID:         self.ID,
+		PrivateKey: self.PrivateKey,
+		CreatedAt:  self.CreatedAt.FromUnix(),
+	}
+	if self.RetiredAt > 0 {
+		retiredAt := self.RetiredAt.FromUnix()
+		key.RetiredAt = &retiredAt
+	}
+	return key
+}
+
+// NewTime converts a time to a unix timestamp for storage.
+func NewTime(t time.Time) Time {
+	return Time(t.Unix())
+}
+
+// UsedNonce is a one time token nonce that has been consumed.
+type UsedNonce struct {
+	Nonce     string `gorm:"primarykey"`
+	ExpiresAt Time   `gorm:"index;not null"`
+	CreatedAt Time
+}
@@ -1,26 +1,79 @@
 package model
 
-import "github.com/carp-cobain/referrals/domain"
+import (
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+)
 
 // Signup represents a blockchain address that signed up using a referral campaign.
 type Signup struct {
-	ID         uint64   `gorm:"primarykey"`
-	CampaignID uint64   `gorm:"index;not null"`
-	Campaign   Campaign `gorm:"foreignKey:CampaignID"`
-	Address    string   `gorm:"uniqueIndex;not null"`
-	Status     string
+	ID          uint64   `gorm:"primarykey"`
+	CampaignID  uint64   `gorm:"index;not null"`
+	Campaign    Campaign `gorm:"foreignKey:CampaignID"`
+	Address     string   `gorm:"uniqueIndex;not null"`
+	Status      string
+	RiskScore   int
+	RiskReasons string
+	IPHash      string `gorm:"index"`
+	Fingerprint string `gorm:"index"`
+	VisitorID   string `gorm:"index"`
+	Params      string
+	ClaimedBy   string
+	ClaimedAt   Time
+	CreatedAt   Time `gorm:"index"`
+	UpdatedAt   Time
+}
+
+// SignupEvent is a status change in the history of a signup.
+type SignupEvent struct {
+	ID         uint64 `gorm:"primarykey"`
+	SignupID   uint64 `gorm:"index;not null"`
+	FromStatus string
+	ToStatus   string
+	Actor      string
 	CreatedAt  Time
-	UpdatedAt  Time
 }
 
 // ToDomain converts a model to a domain object representation.
-func (self Signup) ToDomain() domain.Signup {
-	return domain.Signup{
+func (self SignupEvent) ToDomain() domain.SignupEvent {
+	return domain.SignupEvent{
 		ID:         self.ID,
-		CampaignID: self.CampaignID,
-		Address:    self.Address,
-		Status:     self.Status,
+		SignupID:   self.SignupID,
+		FromStatus: self.FromStatus,
+		ToStatus:   self.ToStatus,
+		Actor:      self.Actor,
 		CreatedAt:  self.CreatedAt.FromUnix(),
-		UpdatedAt:  self.UpdatedAt.FromUnix(),
+	}
+}
+
+// ToDomain converts a model to a domain object representation.
+func (self Signup) ToDomain() domain.Signup {
+	signup := domain.Signup{
+		ID:          self.ID,
+		CampaignID:  self.CampaignID,
+		Address:     self.Address,
+		Status:      self.Status,
+		RiskScore:   self.RiskScore,
+		RiskReasons: strings.Fields(self.RiskReasons),
+		VisitorID:   self.VisitorID,
+		Params:      domain.ParseParams(self.Params),
+		ClaimedBy:   self.ClaimedBy,
+		CreatedAt:   self.CreatedAt.FromUnix(),
+		UpdatedAt:   self.UpdatedAt.FromUnix(),
+	}
+	if self.ClaimedBy != "" {
+		claimedAt := self.ClaimedAt.FromUnix()
+		signup.ClaimedAt = &claimedAt
+	}
+	return signup
+}
+
+// ToExport converts a model with a joined campaign to an export representation.
+func (self Signup) ToExport() domain.SignupExport {
+	return domain.SignupExport{
+		Signup:          self.ToDomain(),
+		CampaignName:    self.Campaign.Name,
+		CampaignAddress: self.Campaign.Address,
 	}
 }
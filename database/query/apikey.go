@@ -0,0 +1,51 @@
+package query
+
+import (
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/database/model"
+	"gorm.io/gorm"
+)
+
+// SelectAPIKey selects an API key by id
+func SelectAPIKey(db *gorm.DB, id uint64) (key model.APIKey, err error) {
+	err = db.Where("id = ?", id).First(&key).Error
+	return
+}
+
+// SelectActiveAPIKey selects an API key that hasn't been revoked by hash
+func SelectActiveAPIKey(db *gorm.DB, hash string) (key model.APIKey, err error) {
+	err = db.Where("hash = ?", hash).Where("revoked_at = 0").First(&key).Error
+	return
+}
+
+// SelectAPIKeys selects a page of API keys
+func SelectAPIKeys(db *gorm.DB, cursor uint64, limit int) (keys []model.APIKey) {
+	db.Where("id > ?", cursor).
+		Order("id").
+		Limit(limit).
+		Find(&keys)
+	return
+}
+
+// InsertAPIKey inserts a new hashed API key
+func InsertAPIKey(
+	db *gorm.DB, name, prefix, hash string, scopes []string) (key model.APIKey, err error) {
+
+	key = model.APIKey{Name: name, Prefix: prefix, Hash: hash, Scopes: strings.Join(scopes, " ")}
+	err = db.Create(&key).Error
+	return
+}
+
+// RevokeAPIKey revokes an API key
+func RevokeAPIKey(db *gorm.DB, id uint64) (key model.APIKey, err error) {
+	if key, err = SelectAPIKey(db, id); err != nil {
+		return
+	}
+	if key.RevokedAt > 0 {
+		return
+	}
+	err = db.Model(&key).Updates(updates{"revoked_at": time.Now().Unix()}).Error
+	return
+}
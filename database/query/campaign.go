@@ -1,7 +1,10 @@
 package query
 
 import (
+	"time"
+
 	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/domain"
 	"gorm.io/gorm"
 )
 
@@ -11,6 +14,12 @@ func SelectCampaign(db *gorm.DB, id uint64) (campaign model.Campaign, err error)
 	return
 }
 
+// SelectNamedCampaign selects the first referral campaign with a name for an address
+func SelectNamedCampaign(db *gorm.DB, address, name string) (campaign model.Campaign, err error) {
+	err = db.Where("address = ? AND name = ?", address, name).Order("id").First(&campaign).Error
+	return
+}
+
 // SelectCampaigns selects a page of referral campaigns for an address
 func SelectCampaigns(
 	db *gorm.DB, address string, cursor uint64, limit int) (campaigns []model.Campaign) {
@@ -25,8 +34,53 @@ func SelectCampaigns(
 }
 
 // InsertCampaign inserts a new named campaign for an address
-func InsertCampaign(db *gorm.DB, address, name string) (campaign model.Campaign, err error) {
-	campaign = model.Campaign{Address: address, Name: name}
+func InsertCampaign(
+	db *gorm.DB, address, name string, options domain.CampaignOptions) (campaign model.Campaign, err error) {
+
+	campaign = model.Campaign{
+		Address:     address,
+		Name:        name,
+		Attribution: options.Attribution,
+		UTM:         options.UTM.Encode(),
+		Destination: options.Destination,
+		IOSURL:      options.IOSURL,
+		AndroidURL:  options.AndroidURL,
+		DeepLink:    options.DeepLink,
+		Description: options.Description,
+		ImageURL:    options.ImageURL,
+	}
 	err = db.Create(&campaign).Error
 	return
 }
+
+// CountCampaigns counts referral campaigns owned by an address
+func CountCampaigns(db *gorm.DB, address string) (count int64) {
+	db.Model(&model.Campaign{}).Where("address = ?", address).Count(&count)
+	return
+}
+
+// IncrementFilteredHits counts bot hits filtered from a campaign's clicks
+func IncrementFilteredHits(db *gorm.DB, campaignID, hits uint64) error {
+	return db.Model(&model.Campaign{}).
+		Where("id = ?", campaignID).
+		UpdateColumn("filtered_hits", gorm.Expr("filtered_hits + ?", hits)).
+		Error
+}
+
+// InsertTouch records a click on a referral link by a visitor with tracking params
+func InsertTouch(
+	db *gorm.DB, visitorID string, campaignID uint64, params domain.Params) (touch model.Touch, err error) {
+
+	touch = model.Touch{VisitorID: visitorID, CampaignID: campaignID, Params: params.Encode()}
+	err = db.Create(&touch).Error
+	return
+}
+
+// SelectTouches selects referral link clicks by a visitor since a time, oldest first
+func SelectTouches(db *gorm.DB, visitorID string, since time.Time) (touches []model.Touch) {
+	db.Where("visitor_id = ?", visitorID).
+		Where("created_at >= ?", since.Unix()).
+		Order("id").
+		Find(&touches)
+	return
+}
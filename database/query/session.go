@@ -0,0 +1,120 @@
+package query
+
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertChallenge inserts a new sign in challenge for an address
+func InsertChallenge(
+	db *gorm.DB, nonce, address string, expiresAt time.Time) (challenge model.Challenge, err error) {
+
+	challenge = model.Challenge{Nonce: nonce, Address: address, ExpiresAt: model.NewTime(expiresAt)}
+	err = db.Create(&challenge).Error
+	return
+}
+
+// UseChallenge marks an unexpired challenge for an address as used, so it can't be replayed.
+func UseChallenge(db *gorm.DB, nonce, address string) (challenge model.Challenge, err error) {
+	err = db.Where("nonce = ?", nonce).Where("address = ?", address).First(&challenge).Error
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	result := db.Model(&model.Challenge{}).
+		Where("id = ?", challenge.ID).
+		Where("used_at = 0").
+		Where("expires_at > ?", now).
+		Updates(updates{"used_at": now})
+	if err = result.Error; err == nil && result.RowsAffected == 0 {
+		err = domain.NewError(domain.ErrForbidden, "challenge expired or already used")
+	}
+	return
+}
+
+// InsertRefreshToken inserts a new hashed refresh token for an address
+func InsertRefreshToken(
+	db *gorm.DB, hash, address string, expiresAt time.Time) (token model.RefreshToken, err error) {
+
+	token = model.RefreshToken{Hash: hash, Address: address, ExpiresAt: model.NewTime(expiresAt)}
+	err = db.Create(&token).Error
+	return
+}
+
+// SelectRefreshToken selects a refresh token by hash
+func SelectRefreshToken(db *gorm.DB, hash string) (token model.RefreshToken, err error) {
+	err = db.Where("hash = ?", hash).First(&token).Error
+	return
+}
+
+// RevokeRefreshToken revokes an active refresh token, returning an error if it was already revoked.
+func RevokeRefreshToken(db *gorm.DB, id uint64) error {
+	result := db.Model(&model.RefreshToken{}).
+		Where("id = ?", id).
+		Where("revoked_at = 0").
+		Updates(updates{"revoked_at": time.Now().Unix()})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return domain.NewError(domain.ErrConflict, "refresh token already revoked")
+	}
+	return result.Error
+}
+
+// RevokeRefreshTokens revokes all active refresh tokens for an address
+func RevokeRefreshTokens(db *gorm.DB, address string) error {
+	return db.Model(&model.RefreshToken{}).
+		Where("address = ?", address).
+		Where("revoked_at = 0").
+		Updates(updates{"revoked_at": time.Now().Unix()}).
+		Error
+}
+
+// InsertRevokedToken denies an access token until it expires
+func InsertRevokedToken(db *gorm.DB, jti string, expiresAt time.Time) error {
+	token := model.RevokedToken{JTI: jti, ExpiresAt: model.NewTime(expiresAt)}
+	return db.Where(token).FirstOrCreate(&token).Error
+}
+
+// RevokedTokenExists checks whether an access token has been revoked
+func RevokedTokenExists(db *gorm.DB, jti string) bool {
+	var count int64
+	db.Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	return count > 0
+}
+
+// SelectSigningKeys selects signing keys that haven't been retired
+func SelectSigningKeys(db *gorm.DB) (keys []model.SigningKey) {
+	db.Where("retired_at = 0 OR retired_at > ?", time.Now().Unix()).
+		Order("created_at").
+		Find(&keys)
+	return
+}
+
+// InsertSigningKey inserts a new signing key
+func InsertSigningKey(db *gorm.DB, id string, privateKey []byte) (key model.SigningKey, err error) {
+	key = model.SigningKey{ID: id, PrivateKey: privateKey}
+	err = db.Create(&key).Error
+	return
+}
+
+// RetireSigningKeys schedules all active signing keys other than one to retire
+func RetireSigningKeys(db *gorm.DB, except string, retireAt time.Time) error {
+	return db.Model(&model.SigningKey{}).
+		Where("id != ?", except).
+		Where("retired_at = 0").
+		Updates(updates{"retired_at": retireAt.Unix()}).
+		Error
+}
+
+// InsertUsedNonce consumes a one time token nonce, returning an error if it was already used
+func InsertUsedNonce(db *gorm.DB, nonce string, expiresAt time.Time) error {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.UsedNonce{Nonce: nonce, ExpiresAt: model.NewTime(expiresAt)})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return domain.NewError(domain.ErrConflict, "token already used")
+	}
+	return result.Error
+}
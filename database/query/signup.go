@@ -1,10 +1,13 @@
 package query
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
 	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/domain"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SelectSignup selects a signup by id
@@ -23,26 +26,209 @@ func SelectSignups(db *gorm.DB, campaignID, cursor uint64, limit int) (signups [
 	return
 }
 
-// InsertSignup inserts a new referral for a campaign.
-func InsertSignup(db *gorm.DB, campaignID uint64, address string) (signup model.Signup, err error) {
-	signup = model.Signup{CampaignID: campaignID, Address: address, Status: "pending"}
+// InsertSignup inserts a new referral for a campaign with request metadata.
+// High risk signups are flagged for manual review.
+func InsertSignup(
+	db *gorm.DB, campaignID uint64, address string, meta domain.SignupMeta) (signup model.Signup, err error) {
+
+	risk := meta.Risk
+	status := domain.SignupPending
+	if risk.Flagged {
+		status = domain.SignupFlagged
+	}
+	signup = model.Signup{
+		CampaignID:  campaignID,
+		Address:     address,
+		Status:      status,
+		RiskScore:   risk.Score,
+		RiskReasons: strings.Join(risk.Reasons, " "),
+		IPHash:      risk.IPHash,
+		Fingerprint: risk.Fingerprint,
+		VisitorID:   meta.VisitorID,
+		Params:      meta.Params.Encode(),
+	}
+	err = db.Create(&signup).Error
+	return
+}
+
+// InsertSignupStatus inserts a new referral with a given status for a campaign.
+func InsertSignupStatus(
+	db *gorm.DB, campaignID uint64, address, status string) (signup model.Signup, err error) {
+
+	signup = model.Signup{CampaignID: campaignID, Address: address, Status: status}
 	err = db.Create(&signup).Error
 	return
 }
 
-// UpdateSignup updates a referral for a campaign.
+// SignupExists checks whether an address has already signed up for any campaign.
+func SignupExists(db *gorm.DB, address string) bool {
+	var count int64
+	db.Model(&model.Signup{}).Where("address = ?", address).Count(&count)
+	return count > 0
+}
+
+// UpdateSignup updates a referral status for a campaign.
 func UpdateSignup(
-	db *gorm.DB, campaignID, signupID uint64, status string) (signup model.Signup, err error) {
+	db *gorm.DB, campaignID, signupID uint64, status, actor string) (signup model.Signup, err error) {
 
 	signup, err = SelectSignup(db, signupID)
 	if err != nil {
 		return
 	}
 	if signup.CampaignID != campaignID {
-		err = fmt.Errorf("invalid campaign: %d", campaignID)
+		err = domain.NewError(domain.ErrValidation, "invalid campaign: %d", campaignID)
+		return
+	}
+	return TransitionSignup(db, signup, status, actor)
+}
+
+// TransitionSignup changes the status of a referral when the transition is allowed, releasing
+// any review claim and recording the change and actor in the referral history.
+func TransitionSignup(
+	db *gorm.DB, signup model.Signup, status, actor string) (model.Signup, error) {
+
+	if err := domain.ValidateSignupTransition(signup.Status, status); err != nil {
+		return signup, err
+	}
+	return ChangeSignupStatus(db, signup, status, actor)
+}
+
+// ReviewSignup changes the status of a flagged referral when a reviewer's decision is
+// allowed, releasing the review claim and recording the change in the referral history.
+func ReviewSignup(
+	db *gorm.DB, signup model.Signup, status, reviewer string) (model.Signup, error) {
+
+	if err := domain.ValidateReviewTransition(signup.Status, status); err != nil {
+		return signup, err
+	}
+	return ChangeSignupStatus(db, signup, status, reviewer)
+}
+
+// ChangeSignupStatus changes the status of a referral without checking the transition,
+// releasing any review claim and recording the change and actor in the referral history.
+func ChangeSignupStatus(
+	db *gorm.DB, signup model.Signup, status, actor string) (model.Signup, error) {
+
+	from := signup.Status
+	if from == status {
+		return signup, nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&signup).
+			Where("status = ?", from).
+			Updates(updates{"status": status, "claimed_by": "", "claimed_at": 0})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.NewError(domain.ErrConflict, "signup %d status changed concurrently", signup.ID)
+		}
+		event := model.SignupEvent{SignupID: signup.ID, FromStatus: from, ToStatus: status, Actor: actor}
+		return tx.Create(&event).Error
+	})
+	return signup, err
+}
+
+// SelectSignupEvents selects the status history for a referral.
+func SelectSignupEvents(db *gorm.DB, signupID uint64) (events []model.SignupEvent) {
+	db.Where("signup_id = ?", signupID).Order("id").Find(&events)
+	return
+}
+
+// SelectReviewQueue selects flagged referrals that are unclaimed, claimed by a reviewer or have
+// expired claims, highest risk first, after the referral with the cursor ID.
+func SelectReviewQueue(
+	db *gorm.DB, reviewer string, claimExpiry time.Time, cursor uint64, limit int) (signups []model.Signup) {
+
+	tx := db.Where("status = ?", domain.SignupFlagged).
+		Where(claimable(db, reviewer, claimExpiry))
+	if cursor > 0 {
+		after := db.Model(&model.Signup{}).Select("risk_score").Where("id = ?", cursor)
+		tx = tx.Where("risk_score < (?) OR (risk_score = (?) AND id > ?)", after, after, cursor)
+	}
+	tx.Order("risk_score DESC").
+		Order("id").
+		Limit(limit).
+		Find(&signups)
+	return
+}
+
+// ClaimSignup claims a flagged referral for a reviewer, so other reviewers skip it.
+func ClaimSignup(
+	db *gorm.DB, signupID uint64, reviewer string, claimExpiry time.Time) (signup model.Signup, err error) {
+
+	result := db.Model(&model.Signup{}).
+		Where("id = ?", signupID).
+		Where("status = ?", domain.SignupFlagged).
+		Where(claimable(db, reviewer, claimExpiry)).
+		Updates(updates{"claimed_by": reviewer, "claimed_at": time.Now().Unix()})
+	if err = result.Error; err != nil {
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = domain.NewError(domain.ErrConflict, "signup %d is not available for review", signupID)
+		return
+	}
+	return SelectSignup(db, signupID)
+}
+
+// UnclaimSignup releases a reviewer's claim on a referral.
+func UnclaimSignup(db *gorm.DB, signupID uint64, reviewer string) (signup model.Signup, err error) {
+	result := db.Model(&model.Signup{}).
+		Where("id = ?", signupID).
+		Where("claimed_by = ?", reviewer).
+		Updates(updates{"claimed_by": "", "claimed_at": 0})
+	if err = result.Error; err != nil {
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = domain.NewError(domain.ErrConflict, "signup %d is not claimed by reviewer", signupID)
+		return
+	}
+	return SelectSignup(db, signupID)
+}
+
+// Condition for referrals that are unclaimed, claimed by a reviewer or have expired claims.
+func claimable(db *gorm.DB, reviewer string, claimExpiry time.Time) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Where("claimed_by = ''").
+		Or("claimed_by = ?", reviewer).
+		Or("claimed_at < ?", claimExpiry.Unix())
+}
+
+// SelectSignupsWithCampaign selects a page of referrals with their campaigns, optionally
+// filtered by campaign and status. A zero campaign ID selects signups for all campaigns.
+func SelectSignupsWithCampaign(
+	db *gorm.DB, campaignID uint64, status string, cursor uint64, limit int) (signups []model.Signup, err error) {
+
+	tx := db.Joins("Campaign").Where("signups.id > ?", cursor)
+	if campaignID > 0 {
+		tx = tx.Where("signups.campaign_id = ?", campaignID)
+	}
+	if status != "" {
+		tx = tx.Where("signups.status = ?", status)
+	}
+	err = tx.Order("signups.id").Limit(limit).Find(&signups).Error
+	return
+}
+
+// CountSignupsSince counts referrals for a campaign created since a time.
+func CountSignupsSince(db *gorm.DB, campaignID uint64, since time.Time) (count int64) {
+	db.Model(&model.Signup{}).
+		Where("campaign_id = ?", campaignID).
+		Where("created_at >= ?", since.Unix()).
+		Count(&count)
+	return
+}
+
+// CountSignupsWith counts referrals for a campaign with a matching column value.
+func CountSignupsWith(db *gorm.DB, campaignID uint64, column, value string) (count int64) {
+	if value == "" {
 		return
 	}
-	result := db.Model(&signup).Updates(updates{"status": status})
-	err = result.Error
+	db.Model(&model.Signup{}).
+		Where("campaign_id = ?", campaignID).
+		Where(clause.Eq{Column: clause.Column{Name: column}, Value: value}).
+		Count(&count)
 	return
 }
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/database/query"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepo manages hashed API keys in a database.
+type APIKeyRepo struct {
+	readDB  *gorm.DB
+	writeDB *gorm.DB
+}
+
+// NewAPIKeyRepo creates a new repository for managing API keys.
+func NewAPIKeyRepo(readDB, writeDB *gorm.DB) APIKeyRepo {
+	return APIKeyRepo{readDB, writeDB}
+}
+
+// Authenticate gets the active API key matching a plaintext key.
+func (self APIKeyRepo) Authenticate(key string) (apiKey domain.APIKey, err error) {
+	var model model.APIKey
+	if model, err = query.SelectActiveAPIKey(self.readDB, auth.HashAPIKey(key)); err == nil {
+		apiKey = model.ToDomain()
+	}
+	err = wrapCredentialError(err, domain.ErrForbidden, "invalid api key")
+	return
+}
+
+// GetAPIKeys gets a page of API keys.
+func (self APIKeyRepo) GetAPIKeys(cursor uint64, limit int) (next uint64, keys []domain.APIKey) {
+	models := query.SelectAPIKeys(self.readDB, cursor, limit)
+	keys = make([]domain.APIKey, len(models))
+	for i, model := range models {
+		keys[i] = model.ToDomain()
+		next = max(next, model.ID)
+	}
+	return
+}
+
+// CreateAPIKey creates a new API key with scopes. The plaintext key is only
+// returned here; only its hash is stored.
+func (self APIKeyRepo) CreateAPIKey(
+	name string, scopes []string) (apiKey domain.APIKey, key string, err error) {
+
+	var prefix string
+	if key, prefix, err = auth.GenerateAPIKey(); err != nil {
+		err = fmt.Errorf("CreateAPIKey: %s", err.Error())
+		return
+	}
+	var model model.APIKey
+	if model, err = query.InsertAPIKey(self.writeDB, name, prefix, auth.HashAPIKey(key), scopes); err == nil {
+		apiKey = model.ToDomain()
+	}
+	if err != nil {
+		err = wrapError(err, "api key")
+		key = ""
+	}
+	return
+}
+
+// RevokeAPIKey revokes an API key by ID.
+func (self APIKeyRepo) RevokeAPIKey(id uint64) (apiKey domain.APIKey, err error) {
+	var model model.APIKey
+	if model, err = query.RevokeAPIKey(self.writeDB, id); err == nil {
+		apiKey = model.ToDomain()
+	}
+	err = wrapError(err, "api key %d", id)
+	return
+}
@@ -1,8 +1,6 @@
 package repo
 
 import (
-	"fmt"
-
 	"github.com/carp-cobain/referrals/database/model"
 	"github.com/carp-cobain/referrals/database/query"
 	"github.com/carp-cobain/referrals/domain"
@@ -26,9 +24,7 @@ func (self CampaignRepo) GetCampaign(id uint64) (campaign domain.Campaign, err e
 	if model, err = query.SelectCampaign(self.readDB, id); err == nil {
 		campaign = model.ToDomain()
 	}
-	if err != nil {
-		err = fmt.Errorf("GetCampaign %d: %s", id, err.Error())
-	}
+	err = wrapError(err, "campaign %d", id)
 	return
 }
 
@@ -47,13 +43,12 @@ func (self CampaignRepo) GetCampaigns(
 
 // CreateCampaign creates a new named campaign
 func (self CampaignRepo) CreateCampaign(
-	address, name string) (campaign domain.Campaign, err error) {
+	address, name string, options domain.CampaignOptions) (campaign domain.Campaign, err error) {
 
-	if model, err := query.InsertCampaign(self.writeDB, address, name); err == nil {
+	var model model.Campaign
+	if model, err = query.InsertCampaign(self.writeDB, address, name, options); err == nil {
 		campaign = model.ToDomain()
 	}
-	if err != nil {
-		err = fmt.Errorf("CreateCampaign: %s", err.Error())
-	}
+	err = wrapError(err, "campaign")
 	return
 }
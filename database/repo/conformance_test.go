@@ -0,0 +1,66 @@
+package repo_test
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/database"
+	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/keeper/keepertest"
+	"gorm.io/gorm"
+)
+
+var conformanceDBs atomic.Int64
+
+func TestSQLiteConformance(t *testing.T) {
+	keepertest.Run(t, func(t *testing.T) keepertest.Keepers {
+		dsn := fmt.Sprintf("file:conformance%d?mode=memory&cache=shared", conformanceDBs.Add(1))
+		db, err := database.Connect(dsn, 1)
+		if err != nil {
+			t.Fatalf("unable to connect to database: %+v", err)
+		}
+		return newTestKeepers(t, db)
+	})
+}
+
+// Run with TEST_POSTGRES_DSN=postgres://... pointing at a database that can be emptied.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	db, err := database.Connect(dsn, 4)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	keepertest.Run(t, func(t *testing.T) keepertest.Keepers {
+		err := db.Exec("DROP TABLE IF EXISTS signup_events, signups, touches, campaigns, api_keys, " +
+			"challenges, refresh_tokens, revoked_tokens, signing_keys, used_nonces, schema_migrations").Error
+		if err != nil {
+			t.Fatalf("unable to reset database: %+v", err)
+		}
+		return newTestKeepers(t, db)
+	})
+}
+
+func newTestKeepers(t *testing.T, db *gorm.DB) keepertest.Keepers {
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("unable to migrate: %+v", err)
+	}
+	sessionRepo := repo.NewSessionRepo(db, db, createKeyCipher(t))
+	return keepertest.Keepers{
+		Campaigns:   repo.NewCampaignRepo(db, db),
+		Signups:     repo.NewSignupRepo(db, db),
+		Risk:        repo.NewSignupRepo(db, db),
+		Touches:     repo.NewTouchRepo(db, db),
+		Reviews:     repo.NewReviewRepo(db, db, time.Minute),
+		APIKeys:     repo.NewAPIKeyRepo(db, db),
+		Sessions:    sessionRepo,
+		SigningKeys: sessionRepo,
+		Nonces:      sessionRepo,
+		Imports:     repo.NewImportRepo(db),
+	}
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// Wrap an error from a database operation on a record in a domain error. Domain errors pass
+// through, missing records are not found, unique violations are conflicts and anything else
+// means the database is unavailable.
+func wrapError(err error, format string, args ...any) error {
+	var domainErr *domain.Error
+	if err == nil || errors.As(err, &domainErr) {
+		return err
+	}
+	what := fmt.Sprintf(format, args...)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return domain.NewError(domain.ErrNotFound, "%s not found", what)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return domain.NewError(domain.ErrConflict, "%s already exists", what)
+	default:
+		return domain.WrapError(domain.ErrUnavailable, err, "%s", what)
+	}
+}
+
+// Wrap an error from a database operation checking credentials, where a missing record
+// means the credentials are invalid.
+func wrapCredentialError(err error, kind error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.NewError(kind, "%s", message)
+	}
+	return wrapError(err, "%s", message)
+}
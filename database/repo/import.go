@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/carp-cobain/referrals/database/query"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// ImportRepo stores bulk imported campaigns and signups.
+type ImportRepo struct {
+	writeDB *gorm.DB
+}
+
+// NewImportRepo creates a new repository for bulk imports.
+func NewImportRepo(writeDB *gorm.DB) ImportRepo {
+	return ImportRepo{writeDB}
+}
+
+// ImportRecords stores a chunk of import records in a single transaction, with a savepoint
+// per record so a failing record is rolled back and skipped without aborting the chunk.
+// Campaign refs created in the chunk are added to refs once the transaction commits. Returns
+// the number of campaigns and signups imported along with errors for records that were
+// skipped.
+func (self ImportRepo) ImportRecords(
+	refs map[string]uint64, records []domain.ImportRecord) (int, int, []domain.ImportError) {
+
+	var campaigns, signups int
+	var errs []domain.ImportError
+	created := make(map[string]uint64)
+	err := self.writeDB.Transaction(func(tx *gorm.DB) error {
+		campaigns, signups, errs = 0, 0, nil
+		for _, record := range records {
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				switch record.Kind {
+				case domain.ImportCampaign:
+					inserted, err := importCampaign(tx, refs, created, record)
+					if err == nil && inserted {
+						campaigns++
+					}
+					return err
+				case domain.ImportSignup:
+					err := importSignup(tx, refs, created, record)
+					if err == nil {
+						signups++
+					}
+					return err
+				default:
+					return fmt.Errorf("invalid record kind: %s", record.Kind)
+				}
+			})
+			if err != nil {
+				errs = append(errs, domain.ImportError{Line: record.Line, Error: err.Error()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errs = make([]domain.ImportError, len(records))
+		for i, record := range records {
+			errs[i] = domain.ImportError{Line: record.Line, Error: err.Error()}
+		}
+		return 0, 0, errs
+	}
+	for ref, id := range created {
+		refs[ref] = id
+	}
+	return campaigns, signups, errs
+}
+
+// Insert an imported campaign, tracking its source system ref. Campaigns are keyed by address
+// and name, so re-imports track the existing campaign instead of inserting a duplicate.
+// Returns whether a campaign was inserted.
+func importCampaign(
+	tx *gorm.DB, refs, created map[string]uint64, record domain.ImportRecord) (bool, error) {
+
+	if record.Ref != "" {
+		if _, ok := lookupRef(refs, created, record.Ref); ok {
+			return false, fmt.Errorf("duplicate campaign ref: %s", record.Ref)
+		}
+	}
+	campaign, err := query.SelectNamedCampaign(tx, record.Address, record.Name)
+	inserted := errors.Is(err, gorm.ErrRecordNotFound)
+	if inserted {
+		campaign, err = query.InsertCampaign(tx, record.Address, record.Name, domain.CampaignOptions{})
+	}
+	if err != nil {
+		return false, err
+	}
+	if record.Ref != "" {
+		created[record.Ref] = campaign.ID
+	}
+	return inserted, nil
+}
+
+// Insert an imported signup, skipping addresses that have already been referred.
+func importSignup(
+	tx *gorm.DB, refs, created map[string]uint64, record domain.ImportRecord) error {
+
+	campaignID, ok := lookupRef(refs, created, record.Ref)
+	if !ok {
+		id, err := strconv.ParseUint(record.Ref, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unknown campaign ref: %s", record.Ref)
+		}
+		campaignID = id
+	}
+	campaign, err := query.SelectCampaign(tx, campaignID)
+	if err != nil {
+		return fmt.Errorf("campaign %d: %s", campaignID, err.Error())
+	}
+	if campaign.Address == record.Address {
+		return fmt.Errorf("self referral error: %s", record.Address)
+	}
+	if query.SignupExists(tx, record.Address) {
+		return fmt.Errorf("address already referred: %s", record.Address)
+	}
+	_, err = query.InsertSignupStatus(tx, campaignID, record.Address, record.Status)
+	return err
+}
+
+// Lookup a campaign ID from previously imported or newly created refs.
+func lookupRef(refs, created map[string]uint64, ref string) (uint64, bool) {
+	if id, ok := created[ref]; ok {
+		return id, true
+	}
+	id, ok := refs[ref]
+	return id, ok
+}
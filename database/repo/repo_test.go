@@ -1,10 +1,18 @@
 package repo_test
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/carp-cobain/referrals/auth"
 	"github.com/carp-cobain/referrals/database"
+	"github.com/carp-cobain/referrals/database/model"
 	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/importer"
 	"gorm.io/gorm"
 )
 
@@ -19,11 +27,19 @@ func createTestDB(t *testing.T) *gorm.DB {
 	return db
 }
 
+func createKeyCipher(t *testing.T) *auth.KeyCipher {
+	keyCipher, err := auth.NewKeyCipher("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("unable to create key cipher: %+v", err)
+	}
+	return keyCipher
+}
+
 func TestCampaignRepo(t *testing.T) {
 	db := createTestDB(t)
 	referer := "tpabc123"
 	campaignRepo := repo.NewCampaignRepo(db, db)
-	campaign, err := campaignRepo.CreateCampaign(referer, "UnitTesting")
+	campaign, err := campaignRepo.CreateCampaign(referer, "UnitTesting", domain.CampaignOptions{})
 	if err != nil {
 		t.Fatalf("failed to create referral campaign: %+v", err)
 	}
@@ -35,24 +51,195 @@ func TestCampaignRepo(t *testing.T) {
 	}
 }
 
+func TestRepoErrors(t *testing.T) {
+	db, err := database.Connect("file:errors?mode=memory&cache=shared", 1)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %+v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("unable to migrate: %+v", err)
+	}
+	campaignRepo := repo.NewCampaignRepo(db, db)
+	if _, err := campaignRepo.GetCampaign(1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected campaign not found error, got: %+v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	// Database errors are outages, not missing records or bad requests.
+	if _, err := campaignRepo.GetCampaign(1000); !errors.Is(err, domain.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got: %+v", err)
+	}
+	_, err = campaignRepo.CreateCampaign("tpabc123", "UnitTesting", domain.CampaignOptions{})
+	if !errors.Is(err, domain.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got: %+v", err)
+	}
+}
+
+func TestTouchRepo(t *testing.T) {
+	db := createTestDB(t)
+	options := domain.CampaignOptions{UTM: domain.Params{"utm_source": "flyer"}}
+	campaign, err := repo.NewCampaignRepo(db, db).CreateCampaign("tpabc127", "UnitTesting", options)
+	if err != nil {
+		t.Fatalf("failed to create referral campaign: %+v", err)
+	}
+	if campaign.UTM["utm_source"] != "flyer" {
+		t.Fatalf("got unexpected campaign utm tags: %+v", campaign.UTM)
+	}
+	touchRepo := repo.NewTouchRepo(db, db)
+	params := campaign.UTM.Merge(domain.Params{"utm_medium": "print"})
+	if _, err := touchRepo.RecordTouch("visitor", campaign.ID, params); err != nil {
+		t.Fatalf("failed to record touch: %+v", err)
+	}
+	touches := touchRepo.GetTouches("visitor", time.Now().Add(-time.Minute))
+	if len(touches) != 1 || touches[0].Params["utm_medium"] != "print" || touches[0].Params["utm_source"] != "flyer" {
+		t.Fatalf("got unexpected touches: %+v", touches)
+	}
+}
+
 func TestSignupRepo(t *testing.T) {
 	db := createTestDB(t)
 	referer := "tpabc124"
 	campgaignRepo := repo.NewCampaignRepo(db, db)
-	campaign, err := campgaignRepo.CreateCampaign(referer, "UnitTesting")
+	campaign, err := campgaignRepo.CreateCampaign(referer, "UnitTesting", domain.CampaignOptions{})
 	if err != nil {
 		t.Fatalf("failed to create referral campaign: %+v", err)
 	}
 	referee := "tpabc125"
 	signupRepo := repo.NewSignupRepo(db, db)
-	if _, err := signupRepo.CreateSignup(campaign.ID, referee); err != nil {
+	if _, err := signupRepo.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); err != nil {
 		t.Fatalf("failed to create signup: %+v", err)
 	}
 	if _, signups := signupRepo.GetSignups(campaign.ID, 0, 10); len(signups) != 1 {
 		t.Fatalf("got unexpected number of signups for campaign")
 	}
+	if _, exports, err := signupRepo.ExportSignups(campaign.ID, "pending", 0, 10); err != nil || len(exports) != 1 {
+		t.Fatalf("got unexpected number of exported signups for campaign")
+	} else if exports[0].CampaignName != campaign.Name {
+		t.Fatalf("expected exported signup to include campaign name")
+	}
 	// Ensure people can't signup for thier own campaigns.
-	if _, err := signupRepo.CreateSignup(campaign.ID, referer); err == nil {
+	if _, err := signupRepo.CreateSignup(campaign.ID, referer, domain.SignupMeta{}); err == nil {
 		t.Fatalf("expected self referral error")
 	}
 }
+
+func TestImportRepo(t *testing.T) {
+	db := createTestDB(t)
+	referer := "tp1import0referer00000000000000000000000000"
+	referee := "tp1import0referee00000000000000000000000000"
+	input := strings.Join([]string{
+		`{"kind":"campaign","ref":"c1","address":"` + referer + `","name":"Imported"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referee + `","status":"verified"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referee + `"}`,
+		`{"kind":"signup","ref":"c1","address":"TP1INVALID"}`,
+		`not json`,
+	}, "\n")
+	bulkImporter := importer.NewImporter(repo.NewImportRepo(db), 2)
+	report, err := bulkImporter.Import(strings.NewReader(input), importer.FormatJSONL)
+	if err != nil {
+		t.Fatalf("failed to import records: %+v", err)
+	}
+	if report.Campaigns != 1 || report.Signups != 1 {
+		t.Fatalf("got unexpected import counts: %+v", report)
+	}
+	if len(report.Errors) != 3 {
+		t.Fatalf("got unexpected number of import errors: %+v", report.Errors)
+	}
+	if line := report.Errors[0].Line; line != 3 {
+		t.Fatalf("expected first import error on line 3, got: %d", line)
+	}
+}
+
+func TestAPIKeyRepo(t *testing.T) {
+	db := createTestDB(t)
+	apiKeyRepo := repo.NewAPIKeyRepo(db, db)
+	apiKey, key, err := apiKeyRepo.CreateAPIKey("UnitTesting", []string{"signups:verify"})
+	if err != nil {
+		t.Fatalf("failed to create api key: %+v", err)
+	}
+	if _, err := apiKeyRepo.Authenticate(key); err != nil {
+		t.Fatalf("failed to authenticate api key: %+v", err)
+	}
+	if _, err := apiKeyRepo.RevokeAPIKey(apiKey.ID); err != nil {
+		t.Fatalf("failed to revoke api key: %+v", err)
+	}
+	if _, err := apiKeyRepo.Authenticate(key); err == nil {
+		t.Fatalf("expected revoked api key error")
+	}
+}
+
+func TestSessionRepoNonces(t *testing.T) {
+	db := createTestDB(t)
+	sessionRepo := repo.NewSessionRepo(db, db, createKeyCipher(t))
+	expiresAt := time.Now().Add(time.Hour)
+	if err := sessionRepo.UseNonce("nonce", expiresAt); err != nil {
+		t.Fatalf("failed to use nonce: %+v", err)
+	}
+	if err := sessionRepo.UseNonce("nonce", expiresAt); err == nil {
+		t.Fatalf("expected replayed nonce error")
+	}
+}
+
+func TestSessionRepoSigningKeys(t *testing.T) {
+	db := createTestDB(t)
+	key, err := repo.NewSessionRepo(db, db, createKeyCipher(t)).RotateSigningKey(0)
+	if err != nil {
+		t.Fatalf("failed to rotate signing key: %+v", err)
+	}
+	var stored model.SigningKey
+	if err := db.Where("id = ?", key.ID).First(&stored).Error; err != nil {
+		t.Fatalf("failed to select signing key: %+v", err)
+	}
+	if bytes.Contains(stored.PrivateKey, key.PrivateKey) {
+		t.Fatalf("expected signing key to be stored encrypted")
+	}
+	// Keys sealed with another key encryption key can't be loaded.
+	other, _ := auth.NewKeyCipher("fedcba9876543210fedcba9876543210")
+	for _, loaded := range repo.NewSessionRepo(db, db, other).GetSigningKeys() {
+		if loaded.ID == key.ID {
+			t.Fatalf("expected signing key sealed with another key to be skipped")
+		}
+	}
+}
+
+func TestReviewRepo(t *testing.T) {
+	db := createTestDB(t)
+	campaign, err := repo.NewCampaignRepo(db, db).CreateCampaign("tpabc126", "UnitTesting", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create referral campaign: %+v", err)
+	}
+	signupRepo := repo.NewSignupRepo(db, db)
+	signup, err := signupRepo.CreateSignup(campaign.ID, "tpabc127", domain.SignupMeta{Risk: domain.Risk{Score: 90, Flagged: true}})
+	if err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	if signup.Status != domain.SignupFlagged {
+		t.Fatalf("expected high risk signup to be flagged, got: %s", signup.Status)
+	}
+	reviewRepo := repo.NewReviewRepo(db, db, time.Minute)
+	if _, queue := reviewRepo.GetReviewQueue("alice", 0, 10); len(queue) != 1 {
+		t.Fatalf("got unexpected number of signups in review queue")
+	}
+	if _, err := reviewRepo.ReviewSignup(signup.ID, "alice", domain.SignupVerified); err == nil {
+		t.Fatalf("expected unclaimed review error")
+	}
+	if _, err := reviewRepo.ClaimSignup(signup.ID, "alice"); err != nil {
+		t.Fatalf("failed to claim signup: %+v", err)
+	}
+	if _, err := reviewRepo.ClaimSignup(signup.ID, "bob"); err == nil {
+		t.Fatalf("expected claimed signup error")
+	}
+	if _, queue := reviewRepo.GetReviewQueue("bob", 0, 10); len(queue) != 0 {
+		t.Fatalf("expected claimed signup to be hidden from other reviewers")
+	}
+	if signup, err = reviewRepo.ReviewSignup(signup.ID, "alice", domain.SignupVerified); err != nil {
+		t.Fatalf("failed to approve signup: %+v", err)
+	}
+	if signup.Status != domain.SignupVerified || signup.ClaimedBy != "" {
+		t.Fatalf("got unexpected reviewed signup: %+v", signup)
+	}
+	history := reviewRepo.GetSignupHistory(signup.ID)
+	if len(history) != 1 || history[0].Actor != "alice" {
+		t.Fatalf("got unexpected signup history: %+v", history)
+	}
+}
@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/database/query"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// ReviewRepo manages the manual review queue for flagged signups.
+type ReviewRepo struct {
+	readDB   *gorm.DB
+	writeDB  *gorm.DB
+	claimTTL time.Duration
+}
+
+// NewReviewRepo creates a new repository for reviewing flagged signups. Claims expire
+// after a claim TTL, so abandoned reviews return to the queue.
+func NewReviewRepo(readDB, writeDB *gorm.DB, claimTTL time.Duration) ReviewRepo {
+	return ReviewRepo{readDB, writeDB, claimTTL}
+}
+
+// GetSignup gets a signup by ID.
+func (self ReviewRepo) GetSignup(signupID uint64) (signup domain.Signup, err error) {
+	var model model.Signup
+	if model, err = query.SelectSignup(self.readDB, signupID); err == nil {
+		signup = model.ToDomain()
+	}
+	err = wrapError(err, "signup %d", signupID)
+	return
+}
+
+// GetReviewQueue gets a page of flagged signups available to a reviewer, highest risk first,
+// after the signup with the cursor ID. The next cursor is the ID of the last signup.
+func (self ReviewRepo) GetReviewQueue(
+	reviewer string, cursor uint64, limit int) (next uint64, signups []domain.Signup) {
+
+	models := query.SelectReviewQueue(self.readDB, reviewer, self.claimExpiry(), cursor, limit)
+	signups = make([]domain.Signup, len(models))
+	for i, model := range models {
+		signups[i] = model.ToDomain()
+		next = model.ID
+	}
+	return
+}
+
+// ClaimSignup claims a flagged signup for a reviewer.
+func (self ReviewRepo) ClaimSignup(signupID uint64, reviewer string) (signup domain.Signup, err error) {
+	var model model.Signup
+	if model, err = query.ClaimSignup(self.writeDB, signupID, reviewer, self.claimExpiry()); err == nil {
+		signup = model.ToDomain()
+	}
+	err = wrapError(err, "signup %d", signupID)
+	return
+}
+
+// UnclaimSignup releases a reviewer's claim on a signup.
+func (self ReviewRepo) UnclaimSignup(signupID uint64, reviewer string) (signup domain.Signup, err error) {
+	var model model.Signup
+	if model, err = query.UnclaimSignup(self.writeDB, signupID, reviewer); err == nil {
+		signup = model.ToDomain()
+	}
+	err = wrapError(err, "signup %d", signupID)
+	return
+}
+
+// ReviewSignup approves or rejects a flagged signup claimed by a reviewer.
+func (self ReviewRepo) ReviewSignup(
+	signupID uint64, reviewer, status string) (signup domain.Signup, err error) {
+
+	var model model.Signup
+	if model, err = query.SelectSignup(self.writeDB, signupID); err != nil {
+		err = wrapError(err, "signup %d", signupID)
+		return
+	}
+	if model.Status != domain.SignupFlagged {
+		err = domain.NewError(domain.ErrConflict, "signup %d is not flagged for review", signupID)
+		return
+	}
+	if model.ClaimedBy != reviewer || model.ClaimedAt.FromUnix().Before(self.claimExpiry()) {
+		err = domain.NewError(domain.ErrConflict, "signup %d must be claimed before review", signupID)
+		return
+	}
+	if model, err = query.ReviewSignup(self.writeDB, model, status, reviewer); err == nil {
+		signup = model.ToDomain()
+	}
+	err = wrapError(err, "signup %d", signupID)
+	return
+}
+
+// GetSignupHistory gets the status history of a signup.
+func (self ReviewRepo) GetSignupHistory(signupID uint64) []domain.SignupEvent {
+	models := query.SelectSignupEvents(self.readDB, signupID)
+	events := make([]domain.SignupEvent, len(models))
+	for i, model := range models {
+		events[i] = model.ToDomain()
+	}
+	return events
+}
+
+// Claims made before this time have expired.
+func (self ReviewRepo) claimExpiry() time.Time {
+	return time.Now().Add(-self.claimTTL)
+}
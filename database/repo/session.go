@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/database/query"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// SessionRepo manages sign in challenges, refresh tokens and signing keys in a database.
+// Signing keys are stored encrypted.
+type SessionRepo struct {
+	readDB    *gorm.DB
+	writeDB   *gorm.DB
+	keyCipher *auth.KeyCipher
+}
+
+// NewSessionRepo creates a new repository for managing sessions.
+func NewSessionRepo(readDB, writeDB *gorm.DB, keyCipher *auth.KeyCipher) SessionRepo {
+	return SessionRepo{readDB, writeDB, keyCipher}
+}
+
+// CreateChallenge creates a one time sign in challenge for an address.
+func (self SessionRepo) CreateChallenge(
+	address string, ttl time.Duration) (challenge domain.Challenge, err error) {
+
+	var nonce string
+	if nonce, err = auth.RandomToken(16); err != nil {
+		err = fmt.Errorf("CreateChallenge: %s", err.Error())
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	if _, err = query.InsertChallenge(self.writeDB, nonce, address, expiresAt); err != nil {
+		err = wrapError(err, "challenge")
+		return
+	}
+	challenge = domain.Challenge{
+		Nonce:     nonce,
+		Address:   address,
+		Message:   auth.ChallengeMessage(address, nonce, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	return
+}
+
+// UseChallenge consumes a sign in challenge, so it can only be used once.
+func (self SessionRepo) UseChallenge(nonce, address string) (challenge domain.Challenge, err error) {
+	var model model.Challenge
+	if model, err = query.UseChallenge(self.writeDB, nonce, address); err != nil {
+		err = wrapCredentialError(err, domain.ErrForbidden, "invalid challenge")
+		return
+	}
+	expiresAt := model.ExpiresAt.FromUnix()
+	challenge = domain.Challenge{
+		Nonce:     model.Nonce,
+		Address:   model.Address,
+		Message:   auth.ChallengeMessage(model.Address, model.Nonce, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	return
+}
+
+// CreateRefreshToken creates a refresh token for an address. Only its hash is stored.
+func (self SessionRepo) CreateRefreshToken(
+	address string, ttl time.Duration) (token string, expiresAt time.Time, err error) {
+
+	if token, err = auth.RandomToken(32); err != nil {
+		err = fmt.Errorf("CreateRefreshToken: %s", err.Error())
+		return
+	}
+	expiresAt = time.Now().Add(ttl)
+	if _, err = query.InsertRefreshToken(self.writeDB, auth.HashRefreshToken(token), address, expiresAt); err != nil {
+		err = wrapError(err, "refresh token")
+		token = ""
+	}
+	return
+}
+
+// RotateRefreshToken revokes a refresh token and returns the address it was bound to.
+// Reusing a revoked refresh token revokes every refresh token for the address.
+func (self SessionRepo) RotateRefreshToken(token string) (address string, err error) {
+	var model model.RefreshToken
+	if model, err = query.SelectRefreshToken(self.writeDB, auth.HashRefreshToken(token)); err != nil {
+		err = wrapCredentialError(err, domain.ErrForbidden, "invalid refresh token")
+		return
+	}
+	if model.ExpiresAt.FromUnix().Before(time.Now()) {
+		err = domain.NewError(domain.ErrForbidden, "refresh token expired")
+		return
+	}
+	if err = query.RevokeRefreshToken(self.writeDB, model.ID); errors.Is(err, domain.ErrConflict) {
+		if err = query.RevokeRefreshTokens(self.writeDB, model.Address); err != nil {
+			err = wrapError(err, "refresh tokens")
+			return
+		}
+		err = domain.NewError(domain.ErrForbidden, "refresh token reused; all sessions revoked")
+		return
+	}
+	if err != nil {
+		err = wrapError(err, "refresh token")
+		return
+	}
+	address = model.Address
+	return
+}
+
+// RevokeRefreshToken revokes a refresh token for an address. Revoking a revoked token succeeds.
+func (self SessionRepo) RevokeRefreshToken(address, token string) error {
+	model, err := query.SelectRefreshToken(self.writeDB, auth.HashRefreshToken(token))
+	if err != nil {
+		return wrapCredentialError(err, domain.ErrValidation, "invalid refresh token")
+	}
+	if model.Address != address {
+		return domain.NewError(domain.ErrValidation, "invalid refresh token")
+	}
+	if err := query.RevokeRefreshToken(self.writeDB, model.ID); err != nil && !errors.Is(err, domain.ErrConflict) {
+		return wrapError(err, "refresh token")
+	}
+	return nil
+}
+
+// RevokeAccessToken denies an access token by ID until it expires.
+func (self SessionRepo) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if err := query.InsertRevokedToken(self.writeDB, jti, expiresAt); err != nil {
+		return wrapError(err, "revoked token")
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked checks whether an access token has been revoked.
+func (self SessionRepo) IsAccessTokenRevoked(jti string) bool {
+	return query.RevokedTokenExists(self.readDB, jti)
+}
+
+// GetSigningKeys gets all signing keys that haven't been retired. Keys that can't be
+// decrypted, as after changing the key encryption key, are logged and skipped.
+func (self SessionRepo) GetSigningKeys() []domain.SigningKey {
+	models := query.SelectSigningKeys(self.readDB)
+	keys := make([]domain.SigningKey, 0, len(models))
+	for _, model := range models {
+		key := model.ToDomain()
+		privateKey, err := self.keyCipher.Open(key.ID, key.PrivateKey)
+		if err != nil {
+			log.Printf("skipping signing key: %s", err.Error())
+			continue
+		}
+		key.PrivateKey = privateKey
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// RotateSigningKey creates a new signing key and schedules existing keys to retire
+// after a grace period, so tokens they signed can still be verified until they expire.
+func (self SessionRepo) RotateSigningKey(grace time.Duration) (key domain.SigningKey, err error) {
+	if key, err = auth.GenerateSigningKey(); err != nil {
+		err = fmt.Errorf("RotateSigningKey: %s", err.Error())
+		return
+	}
+	sealed, err := self.keyCipher.Seal(key.ID, key.PrivateKey)
+	if err != nil {
+		err = fmt.Errorf("RotateSigningKey: %s", err.Error())
+		return
+	}
+	err = self.writeDB.Transaction(func(tx *gorm.DB) error {
+		if _, err := query.InsertSigningKey(tx, key.ID, sealed); err != nil {
+			return err
+		}
+		return query.RetireSigningKeys(tx, key.ID, time.Now().Add(grace))
+	})
+	err = wrapError(err, "signing key")
+	return
+}
+
+// UseNonce consumes a one time token nonce, so the token can't be replayed.
+func (self SessionRepo) UseNonce(nonce string, expiresAt time.Time) error {
+	return wrapError(query.InsertUsedNonce(self.writeDB, nonce, expiresAt), "nonce")
+}
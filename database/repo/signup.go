@@ -1,7 +1,9 @@
 package repo
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/carp-cobain/referrals/database/model"
 	"github.com/carp-cobain/referrals/database/query"
@@ -33,34 +35,88 @@ func (self SignupRepo) GetSignups(
 	return
 }
 
-// CreateSignup creates a signup for a referral campaign
+// CreateSignup creates a signup for a referral campaign. The campaign is checked, the signup
+// inserted and any referral token nonce consumed in a single write transaction, so the
+// campaign can't change in between and a token is only used up by a recorded signup.
+// Returns domain.ErrAlreadyReferred if the address has already signed up.
 func (self SignupRepo) CreateSignup(
-	campaignID uint64, address string) (signup domain.Signup, err error) {
+	campaignID uint64, address string, meta domain.SignupMeta) (signup domain.Signup, err error) {
 
-	var campaign model.Campaign
-	campaign, err = query.SelectCampaign(self.readDB, campaignID)
-	if err != nil {
-		err = fmt.Errorf("campaign %d: %s", campaignID, err.Error())
-		return
-	}
-	if campaign.Address == address {
-		err = fmt.Errorf("self referral error: %s", address)
-		return
-	}
-	var model model.Signup
-	if model, err = query.InsertSignup(self.writeDB, campaignID, address); err == nil {
+	err = self.writeDB.Transaction(func(tx *gorm.DB) error {
+		campaign, err := query.SelectCampaign(tx, campaignID)
+		if err != nil {
+			return wrapError(err, "campaign %d", campaignID)
+		}
+		if campaign.Address == address {
+			return domain.NewError(domain.ErrValidation, "self referral error: %s", address)
+		}
+		model, err := query.InsertSignup(tx, campaignID, address, meta)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("%w: %s", domain.ErrAlreadyReferred, address)
+		}
+		if err != nil {
+			return err
+		}
+		if meta.Nonce != nil {
+			if err := query.InsertUsedNonce(tx, meta.Nonce.Value, meta.Nonce.ExpiresAt); err != nil {
+				return wrapError(err, "nonce")
+			}
+		}
 		signup = model.ToDomain()
+		return nil
+	})
+	if err != nil {
+		signup, err = domain.Signup{}, wrapError(err, "signup")
 	}
 	return
 }
 
 // UpdateSignup updates the status of a signup for a referral campaign.
 func (self SignupRepo) UpdateSignup(
-	campaignID, signupID uint64, status string) (signup domain.Signup, err error) {
+	campaignID, signupID uint64, status, actor string) (signup domain.Signup, err error) {
 
 	var model model.Signup
-	if model, err = query.UpdateSignup(self.writeDB, campaignID, signupID, status); err == nil {
+	if model, err = query.UpdateSignup(self.writeDB, campaignID, signupID, status, actor); err == nil {
 		signup = model.ToDomain()
 	}
+	err = wrapError(err, "signup %d", signupID)
+	return
+}
+
+// ExportSignups gets a page of signups with campaign details for exports. A zero campaign
+// ID exports signups for all campaigns and an empty status exports all statuses. Errors are
+// returned, since a missing page would silently truncate an export.
+func (self SignupRepo) ExportSignups(
+	campaignID uint64, status string, cursor uint64, limit int) (next uint64, signups []domain.SignupExport, err error) {
+
+	models, err := query.SelectSignupsWithCampaign(self.readDB, campaignID, status, cursor, limit)
+	if err != nil {
+		return 0, nil, wrapError(err, "signups")
+	}
+	signups = make([]domain.SignupExport, len(models))
+	for i, model := range models {
+		signups[i] = model.ToExport()
+		next = max(next, model.ID)
+	}
 	return
 }
+
+// CountRecentSignups counts signups for a campaign created since a time.
+func (self SignupRepo) CountRecentSignups(campaignID uint64, since time.Time) int64 {
+	return query.CountSignupsSince(self.readDB, campaignID, since)
+}
+
+// CountSharedIP counts signups for a campaign from the same hashed client IP.
+func (self SignupRepo) CountSharedIP(campaignID uint64, ipHash string) int64 {
+	return query.CountSignupsWith(self.readDB, campaignID, "ip_hash", ipHash)
+}
+
+// CountSharedFingerprint counts signups for a campaign with the same client fingerprint.
+func (self SignupRepo) CountSharedFingerprint(campaignID uint64, fingerprint string) int64 {
+	return query.CountSignupsWith(self.readDB, campaignID, "fingerprint", fingerprint)
+}
+
+// CountOwnedCampaigns counts campaigns owned by an address.
+func (self SignupRepo) CountOwnedCampaigns(address string) int64 {
+	return query.CountCampaigns(self.readDB, address)
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/database/model"
+	"github.com/carp-cobain/referrals/database/query"
+	"github.com/carp-cobain/referrals/domain"
+	"gorm.io/gorm"
+)
+
+// TouchRepo manages referral link clicks recorded for attribution.
+type TouchRepo struct {
+	readDB  *gorm.DB
+	writeDB *gorm.DB
+}
+
+// NewTouchRepo creates a new repository for referral link clicks.
+func NewTouchRepo(readDB, writeDB *gorm.DB) TouchRepo {
+	return TouchRepo{readDB, writeDB}
+}
+
+// RecordTouch records a click on a referral link by a visitor with tracking params.
+func (self TouchRepo) RecordTouch(
+	visitorID string, campaignID uint64, params domain.Params) (touch domain.Touch, err error) {
+
+	var model model.Touch
+	if model, err = query.InsertTouch(self.writeDB, visitorID, campaignID, params); err == nil {
+		touch = model.ToDomain()
+	}
+	err = wrapError(err, "touch")
+	return
+}
+
+// RecordFilteredHits counts bot hits per campaign on referral links that weren't recorded as
+// clicks, in one transaction.
+func (self TouchRepo) RecordFilteredHits(hits map[uint64]uint64) error {
+	return self.writeDB.Transaction(func(tx *gorm.DB) error {
+		for campaignID, count := range hits {
+			if err := query.IncrementFilteredHits(tx, campaignID, count); err != nil {
+				return wrapError(err, "campaign %d", campaignID)
+			}
+		}
+		return nil
+	})
+}
+
+// GetTouches gets referral link clicks by a visitor since a time, oldest first.
+func (self TouchRepo) GetTouches(visitorID string, since time.Time) []domain.Touch {
+	models := query.SelectTouches(self.readDB, visitorID, since)
+	touches := make([]domain.Touch, len(models))
+	for i, model := range models {
+		touches[i] = model.ToDomain()
+	}
+	return touches
+}
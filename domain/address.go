@@ -0,0 +1,24 @@
+package domain
+
+import "strings"
+
+// AddressPrefix is the required prefix for blockchain addresses.
+const AddressPrefix = "tp"
+
+// ValidateAddress trims and validates a blockchain address.
+func ValidateAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", NewError(ErrValidation, "address cannot be blank")
+	}
+	if len(address) < 41 || len(address) > 61 {
+		return "", NewError(ErrValidation, "address must be between 41 and 61 characters")
+	}
+	if strings.ToLower(address) != address {
+		return "", NewError(ErrValidation, "address must be all lower case")
+	}
+	if !strings.HasPrefix(address, AddressPrefix) {
+		return "", NewError(ErrValidation, "address must have prefix: %s", AddressPrefix)
+	}
+	return address, nil
+}
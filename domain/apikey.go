@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeAdmin          = "admin"
+	ScopeCampaignsRead  = "campaigns:read"
+	ScopeCampaignsWrite = "campaigns:write"
+	ScopeSignupsRead    = "signups:read"
+	ScopeSignupsWrite   = "signups:write"
+	ScopeSignupsVerify  = "signups:verify"
+	ScopeSignupsForward = "signups:forward"
+)
+
+// Scopes are all valid API key scopes
+var Scopes = []string{
+	ScopeAdmin,
+	ScopeCampaignsRead,
+	ScopeCampaignsWrite,
+	ScopeSignupsRead,
+	ScopeSignupsWrite,
+	ScopeSignupsVerify,
+	ScopeSignupsForward,
+}
+
+// APIKey represents a hashed API key with scoped permissions.
+type APIKey struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// ValidateScopes ensures API key scopes are valid variants.
+func ValidateScopes(scopes []string) ([]string, error) {
+	valid := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !slices.Contains(Scopes, scope) {
+			return nil, NewError(ErrValidation, "invalid scope: %s", scope)
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, NewError(ErrValidation, "at least one scope is required")
+	}
+	return valid, nil
+}
+
+// Principal is an authenticated api caller: either an API key or a blockchain address.
+type Principal struct {
+	KeyID          uint64    `json:"keyId,omitempty"`
+	Name           string    `json:"name"`
+	Scopes         []string  `json:"scopes"`
+	Address        string    `json:"address,omitempty"`
+	TokenID        string    `json:"-"`
+	TokenExpiresAt time.Time `json:"-"`
+}
+
+// HasScope checks whether a principal has been granted a scope. Admins have all scopes.
+func (self Principal) HasScope(scope string) bool {
+	return slices.Contains(self.Scopes, ScopeAdmin) || slices.Contains(self.Scopes, scope)
+}
+
+// CanAccess checks whether a principal owns a campaign or has been granted a scope for all campaigns.
+func (self Principal) CanAccess(campaign Campaign, scope string) bool {
+	return self.HasScope(scope) || (self.Address != "" && self.Address == campaign.Address)
+}
+
+// Actor identifies a principal in audit history.
+func (self Principal) Actor() string {
+	if self.KeyID > 0 {
+		return fmt.Sprintf("key:%d:%s", self.KeyID, self.Name)
+	}
+	return self.Address
+}
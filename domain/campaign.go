@@ -1,12 +1,91 @@
 package domain
 
-import "time"
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Campaign represents a referral campaign for a blockchain address.
 type Campaign struct {
-	ID        uint64    `json:"id"`
-	Address   string    `json:"address"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID      uint64 `json:"id"`
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	CampaignOptions
+	FilteredHits uint64    `json:"filteredHits"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// CampaignOptions are optional settings for a referral campaign.
+type CampaignOptions struct {
+	Attribution string `json:"attribution,omitempty"`
+	UTM         Params `json:"utm,omitempty"`
+	CampaignDestinations
+	CampaignPreview
+}
+
+// CampaignPreview is shown in link previews when referral links are shared.
+type CampaignPreview struct {
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+}
+
+// ValidatePreview ensures a campaign preview has a bounded description and an absolute
+// http(s) image URL.
+func ValidatePreview(preview CampaignPreview) (CampaignPreview, error) {
+	preview.Description = strings.TrimSpace(preview.Description)
+	preview.ImageURL = strings.TrimSpace(preview.ImageURL)
+	if len(preview.Description) > 300 {
+		return preview, NewError(ErrValidation, "description must be at most 300 characters")
+	}
+	if preview.ImageURL != "" {
+		parsed, err := url.Parse(preview.ImageURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return preview, NewError(ErrValidation, "invalid image URL: %s", preview.ImageURL)
+		}
+	}
+	return preview, nil
+}
+
+// CampaignDestinations are where referral links send visitors, instead of the global signup
+// URL. Mobile visitors go to their platform URL, or try the deep link first when set.
+type CampaignDestinations struct {
+	Destination string `json:"destination,omitempty"`
+	IOSURL      string `json:"iosUrl,omitempty"`
+	AndroidURL  string `json:"androidUrl,omitempty"`
+	DeepLink    string `json:"deepLink,omitempty"`
+}
+
+// Attribution modes decide which campaign gets credit when a visitor clicks several referral links.
+const (
+	// AttributionFirst keeps the first campaign clicked while its cookie is valid.
+	AttributionFirst = "first"
+	// AttributionLast credits the most recent campaign clicked.
+	AttributionLast = "last"
+	// AttributionServer records every click and picks a campaign from them at conversion.
+	AttributionServer = "server"
+)
+
+// AttributionModes are all valid attribution modes
+var AttributionModes = []string{AttributionFirst, AttributionLast, AttributionServer}
+
+// ValidateAttribution ensures an attribution mode is a valid variant. Empty is allowed and
+// means the deployment default.
+func ValidateAttribution(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode != "" && !slices.Contains(AttributionModes, mode) {
+		return "", NewError(ErrValidation, "invalid attribution mode: %s", mode)
+	}
+	return mode, nil
+}
+
+// Touch is a recorded click on a referral link by a visitor.
+type Touch struct {
+	ID         uint64    `json:"id"`
+	VisitorID  string    `json:"visitorId"`
+	CampaignID uint64    `json:"campaignId"`
+	Params     Params    `json:"params,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
 }
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors. Keepers return errors wrapping one of these, so callers can tell
+// a missing record from a rejected request or an outage with errors.Is.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrValidation  = errors.New("validation failed")
+	ErrForbidden   = errors.New("forbidden")
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// Error is a domain error of a kind. The message describes the error to clients; the cause,
+// when there is one, is an internal error that should only be logged.
+type Error struct {
+	Kind    error
+	Message string
+	Cause   error
+}
+
+// NewError creates a domain error of a kind with a formatted message.
+func NewError(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError creates a domain error of a kind with a formatted message caused by another error.
+func WrapError(kind, cause error, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Cause: cause}
+}
+
+// Error includes the cause, so logged errors keep internal details.
+func (self *Error) Error() string {
+	if self.Cause != nil {
+		return self.Message + ": " + self.Cause.Error()
+	}
+	return self.Message
+}
+
+// Unwrap gets the error kind and cause.
+func (self *Error) Unwrap() []error {
+	if self.Cause != nil {
+		return []error{self.Kind, self.Cause}
+	}
+	return []error{self.Kind}
+}
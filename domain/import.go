@@ -0,0 +1,32 @@
+package domain
+
+// Import record kinds
+const (
+	ImportCampaign = "campaign"
+	ImportSignup   = "signup"
+)
+
+// ImportRecord is a campaign or signup read from a bulk import file.
+// Campaign records use Ref as the campaign ID from the source system. Signup records
+// use Ref to point at an imported campaign, or at an existing campaign ID.
+type ImportRecord struct {
+	Line    int    `json:"-"`
+	Kind    string `json:"kind"`
+	Ref     string `json:"ref"`
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+}
+
+// ImportError reports a bulk import record that could not be imported.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportReport summarizes the results of a bulk import.
+type ImportReport struct {
+	Campaigns int           `json:"campaigns"`
+	Signups   int           `json:"signups"`
+	Errors    []ImportError `json:"errors"`
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// MaintenanceTask is the status of a scheduled database maintenance task.
+type MaintenanceTask struct {
+	Name           string     `json:"name"`
+	Interval       string     `json:"interval"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	LastRunAt      *time.Time `json:"lastRunAt,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastResult     string     `json:"lastResult,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Params are tracking query params, like UTM tags, recorded with referral clicks and signups.
+type Params map[string]string
+
+// UTMTags are the campaign UTM tags that can be set as campaign defaults.
+var UTMTags = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// MaxParamLength is the max length of a tracking param value
+const MaxParamLength = 256
+
+// MaxParams is the max number of tracking params recorded with a click or signup
+const MaxParams = 20
+
+// Encode params as a URL query string.
+func (self Params) Encode() string {
+	values := url.Values{}
+	for key, value := range self {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// Merge params over a copy of these params.
+func (self Params) Merge(params Params) Params {
+	if len(self) == 0 && len(params) == 0 {
+		return nil
+	}
+	merged := make(Params, len(self)+len(params))
+	for key, value := range self {
+		merged[key] = value
+	}
+	for key, value := range params {
+		merged[key] = value
+	}
+	return merged
+}
+
+// ParseParams decodes params from a URL query string.
+func ParseParams(query string) Params {
+	values, _ := url.ParseQuery(query)
+	if len(values) == 0 {
+		return nil
+	}
+	params := make(Params, len(values))
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	return params
+}
+
+// ValidateParams ensures tracking params are bounded in number and length.
+func ValidateParams(params Params) (Params, error) {
+	if len(params) > MaxParams {
+		return nil, NewError(ErrValidation, "too many params: max %d", MaxParams)
+	}
+	for key, value := range params {
+		if key == "" || len(key) > 64 || len(value) > MaxParamLength {
+			return nil, NewError(ErrValidation, "invalid param: %s", key)
+		}
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+	return params, nil
+}
+
+// ValidateUTM ensures campaign default UTM tags are known tags with bounded values.
+func ValidateUTM(params Params) (Params, error) {
+	validated := make(Params, len(params))
+	for key, value := range params {
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if !slices.Contains(UTMTags, key) {
+			return nil, NewError(ErrValidation, "invalid utm tag: %s", key)
+		}
+		if value == "" || len(value) > MaxParamLength {
+			return nil, NewError(ErrValidation, "invalid utm tag value: %s", key)
+		}
+		validated[key] = value
+	}
+	if len(validated) == 0 {
+		return nil, nil
+	}
+	return validated, nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// RedirectAllowlist are the hosts referral redirects may send visitors to. Entries starting
+// with "*." match any subdomain. There's no entry matching every host.
+type RedirectAllowlist []string
+
+// Allows checks whether a URL is an absolute http(s) URL on an allowed host. URLs with user
+// info are never allowed, since they're easily mistaken for a different host.
+func (self RedirectAllowlist) Allows(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.User != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "" {
+		return false
+	}
+	for _, allowed := range self {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok && suffix != "" && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL ensures a campaign destination is allowed. Empty is allowed and means no
+// destination.
+func (self RedirectAllowlist) ValidateURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL != "" && !self.Allows(rawURL) {
+		return "", NewError(ErrValidation, "redirect URL not allowed: %s", rawURL)
+	}
+	return rawURL, nil
+}
+
+// ValidateDeepLink ensures a deep link is an app link with one of the configured app schemes,
+// or an allowed http(s) URL. Empty is allowed and means no deep link.
+func (self RedirectAllowlist) ValidateDeepLink(rawURL string, appSchemes []string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" {
+		return "", NewError(ErrValidation, "invalid deep link: %s", rawURL)
+	}
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		return self.ValidateURL(rawURL)
+	}
+	if !slices.ContainsFunc(appSchemes, func(scheme string) bool { return strings.EqualFold(scheme, parsed.Scheme) }) {
+		return "", NewError(ErrValidation, "deep link scheme not allowed: %s", parsed.Scheme)
+	}
+	return rawURL, nil
+}
@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+func TestRedirectAllowlistAllows(t *testing.T) {
+	allowlist := domain.RedirectAllowlist{"good.com", "*.cdn.io"}
+	for _, test := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://good.com/signup", true},
+		{"http://good.com", true},
+		{"HTTPS://Good.com/signup", true},
+		{"https://a.cdn.io/x", true},
+		{"https://a.b.cdn.io/x", true},
+		{"https://cdn.io", false},
+		{"https://evilcdn.io", false},
+		{"https://good.com.evil.com", false},
+		{"https://good.com@evil.com", false},
+		{"https://evil.com@good.com", false},
+		{"//evil.com", false},
+		{"/signup", false},
+		{"javascript:alert(1)", false},
+		{"JavaScript://good.com/%0aalert(1)", false},
+		{"ftp://good.com", false},
+		{"https://", false},
+	} {
+		if allowed := allowlist.Allows(test.url); allowed != test.allowed {
+			t.Fatalf("expected Allows(%q) to be %t", test.url, test.allowed)
+		}
+	}
+	// A bare wildcard doesn't allow every host.
+	if (domain.RedirectAllowlist{"*"}).Allows("https://evil.com") {
+		t.Fatalf("expected bare wildcard not to match")
+	}
+}
+
+func TestValidateDeepLink(t *testing.T) {
+	allowlist := domain.RedirectAllowlist{"good.com"}
+	appSchemes := []string{"myapp"}
+	for _, test := range []struct {
+		url   string
+		valid bool
+	}{
+		{"", true},
+		{"myapp://refer", true},
+		{"MyApp://refer?code=1", true},
+		{"https://good.com/app", true},
+		{"HTTPS://good.com/app", true},
+		{"otherapp://refer", false},
+		{"https://evil.com/app", false},
+		{"https://good.com@evil.com", false},
+		{"//evil.com", false},
+		{"javascript:alert(1)", false},
+		{"JAVASCRIPT:alert(1)", false},
+		{"data:text/html,hi", false},
+		{"intent://refer#Intent;scheme=myapp;end", false},
+	} {
+		if _, err := allowlist.ValidateDeepLink(test.url, appSchemes); (err == nil) != test.valid {
+			t.Fatalf("expected ValidateDeepLink(%q) valid to be %t, got: %v", test.url, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// Challenge is a one time message an address signs to start a session.
+type Challenge struct {
+	Nonce     string    `json:"nonce"`
+	Address   string    `json:"address"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Session is a short lived access token and a refresh token bound to an address.
+type Session struct {
+	AccessToken      string    `json:"accessToken"`
+	TokenType        string    `json:"tokenType"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// SigningKey is an Ed25519 key used to sign session access tokens.
+type SigningKey struct {
+	ID         string
+	PrivateKey []byte
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+}
@@ -1,13 +1,148 @@
 package domain
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrAlreadyReferred is returned when creating a signup for an address that has already
+// signed up with any campaign.
+var ErrAlreadyReferred = NewError(ErrConflict, "address already referred")
 
 // Signup represents a blockchain address that signed up using a referral campaign.
 type Signup struct {
+	ID          uint64     `json:"id"`
+	CampaignID  uint64     `json:"campaignId"`
+	Address     string     `json:"address"`
+	Status      string     `json:"status"`
+	RiskScore   int        `json:"riskScore"`
+	RiskReasons []string   `json:"riskReasons"`
+	VisitorID   string     `json:"visitorId,omitempty"`
+	Params      Params     `json:"params,omitempty"`
+	ClaimedBy   string     `json:"claimedBy,omitempty"`
+	ClaimedAt   *time.Time `json:"claimedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Redact hides most of a signup address and risk details for public views.
+func (self Signup) Redact() Signup {
+	if len(self.Address) > 12 {
+		self.Address = self.Address[:6] + "..." + self.Address[len(self.Address)-4:]
+	}
+	self.RiskScore = 0
+	self.RiskReasons = nil
+	self.VisitorID = ""
+	self.Params = nil
+	self.ClaimedBy = ""
+	self.ClaimedAt = nil
+	return self
+}
+
+// Signup status variants
+const (
+	SignupPending  = "pending"
+	SignupVerified = "verified"
+	SignupFlagged  = "flagged"
+	SignupRejected = "rejected"
+)
+
+// SignupStatuses are all valid signup status variants
+var SignupStatuses = []string{SignupPending, SignupVerified, SignupFlagged, SignupRejected}
+
+// signupTransitions are the allowed status changes for signups. Flagged signups can only
+// leave review through reviewTransitions, and rejected signups are final.
+var signupTransitions = map[string][]string{
+	SignupPending:  {SignupVerified, SignupFlagged, SignupRejected},
+	SignupVerified: {SignupPending},
+}
+
+// reviewTransitions are the allowed status changes for reviewers deciding flagged signups
+var reviewTransitions = map[string][]string{
+	SignupFlagged: {SignupVerified, SignupRejected},
+}
+
+// ValidateSignupTransition ensures a signup can change from one status to another.
+func ValidateSignupTransition(from, to string) error {
+	return validateTransition(signupTransitions, from, to)
+}
+
+// ValidateReviewTransition ensures a reviewer can change a signup from one status to another.
+func ValidateReviewTransition(from, to string) error {
+	return validateTransition(reviewTransitions, from, to)
+}
+
+// Ensure a status change is allowed by a transition table.
+func validateTransition(transitions map[string][]string, from, to string) error {
+	if from == to || slices.Contains(transitions[from], to) {
+		return nil
+	}
+	return NewError(ErrValidation, "invalid status transition: %s -> %s", from, to)
+}
+
+// ValidateSignupStatus ensures a signup status is a valid variant.
+func ValidateSignupStatus(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == "" {
+		return "", NewError(ErrValidation, "invalid status: empty string")
+	}
+	if !slices.Contains(SignupStatuses, status) {
+		return "", NewError(ErrValidation, "invalid status variant: %s", status)
+	}
+	return status, nil
+}
+
+// ValidateSignupUpdate ensures a signup status can be set by clients. Only fraud scoring
+// flags signups for review.
+func ValidateSignupUpdate(status string) (string, error) {
+	status, err := ValidateSignupStatus(status)
+	if err != nil {
+		return "", err
+	}
+	if status == SignupFlagged {
+		return "", NewError(ErrValidation, "invalid status: signups can't be flagged by clients")
+	}
+	return status, nil
+}
+
+// SignupMeta is request metadata stored with a new signup.
+type SignupMeta struct {
+	Risk      Risk
+	VisitorID string
+	Params    Params
+	// Nonce is the referral token nonce consumed with the signup, when it came from a token.
+	Nonce *Nonce
+}
+
+// Nonce is a one time token nonce, remembered until its token expires.
+type Nonce struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// Risk is the fraud risk assessment for a signup.
+type Risk struct {
+	Score       int
+	Reasons     []string
+	Flagged     bool
+	IPHash      string
+	Fingerprint string
+}
+
+// SignupExport is a signup with the campaign details used in exports.
+type SignupExport struct {
+	Signup
+	CampaignName    string `json:"campaignName"`
+	CampaignAddress string `json:"campaignAddress"`
+}
+
+// SignupEvent is a status change in the history of a signup.
+type SignupEvent struct {
 	ID         uint64    `json:"id"`
-	CampaignID uint64    `json:"campaignId"`
-	Address    string    `json:"address"`
-	Status     string    `json:"status"`
+	SignupID   uint64    `json:"signupId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	Actor      string    `json:"actor"`
 	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
 }
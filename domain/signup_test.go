@@ -0,0 +1,32 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+func TestValidateSignupTransition(t *testing.T) {
+	for _, test := range []struct {
+		from, to string
+		allowed  bool
+	}{
+		{domain.SignupPending, domain.SignupVerified, true},
+		{domain.SignupPending, domain.SignupRejected, true},
+		{domain.SignupVerified, domain.SignupPending, true},
+		{domain.SignupRejected, domain.SignupRejected, true},
+		{domain.SignupFlagged, domain.SignupVerified, false},
+		{domain.SignupRejected, domain.SignupFlagged, false},
+		{domain.SignupRejected, domain.SignupPending, false},
+		{domain.SignupRejected, domain.SignupVerified, false},
+	} {
+		err := domain.ValidateSignupTransition(test.from, test.to)
+		if test.allowed && err != nil {
+			t.Fatalf("expected %s -> %s to be allowed, got: %+v", test.from, test.to, err)
+		}
+		if !test.allowed && !errors.Is(err, domain.ErrValidation) {
+			t.Fatalf("expected %s -> %s to be rejected, got: %+v", test.from, test.to, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package fraud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+)
+
+// Risk reasons recorded on signups
+const (
+	ReasonVelocity           = "velocity"
+	ReasonBurst              = "burst"
+	ReasonSharedIP           = "shared_ip"
+	ReasonSharedFingerprint  = "shared_fingerprint"
+	ReasonAddressReuse       = "address_reuse"
+	ReasonMissingFingerprint = "missing_fingerprint"
+)
+
+// Rules are the thresholds and weights used to score signup risk.
+type Rules struct {
+	VelocityWindow     time.Duration
+	VelocityLimit      int64
+	VelocityWeight     int
+	BurstWindow        time.Duration
+	BurstLimit         int64
+	BurstWeight        int
+	SharedIPLimit      int64
+	SharedIPWeight     int
+	FingerprintWeight  int
+	AddressReuseWeight int
+	MissingWeight      int
+	FlagThreshold      int
+}
+
+// DefaultRules are the default fraud scoring rules.
+var DefaultRules = Rules{
+	VelocityWindow:     time.Hour,
+	VelocityLimit:      50,
+	VelocityWeight:     20,
+	BurstWindow:        time.Minute,
+	BurstLimit:         5,
+	BurstWeight:        30,
+	SharedIPLimit:      3,
+	SharedIPWeight:     30,
+	FingerprintWeight:  40,
+	AddressReuseWeight: 25,
+	MissingWeight:      10,
+	FlagThreshold:      50,
+}
+
+// Signals are the request details a signup is scored on.
+type Signals struct {
+	CampaignID uint64
+	Address    string
+	IP         string
+	UserAgent  string
+}
+
+// Scorer scores the fraud risk of signups using campaign signup history. Client IPs and
+// user agents are hashed with a secret, so stored hashes can't be reversed by guessing.
+type Scorer struct {
+	riskReader keeper.RiskReader
+	rules      Rules
+	secret     []byte
+}
+
+// NewScorer creates a new signup fraud risk scorer.
+func NewScorer(riskReader keeper.RiskReader, rules Rules, secret []byte) Scorer {
+	return Scorer{riskReader, rules, secret}
+}
+
+// Score assesses the fraud risk of a signup. Signups scoring at or above the flag
+// threshold are flagged for manual review.
+func (self Scorer) Score(signals Signals) domain.Risk {
+	risk := domain.Risk{
+		IPHash:      Hash(self.secret, signals.IP),
+		Fingerprint: Hash(self.secret, signals.IP, signals.UserAgent),
+	}
+	add := func(reason string, weight int) {
+		risk.Score += weight
+		risk.Reasons = append(risk.Reasons, reason)
+	}
+	campaignID := signals.CampaignID
+	now := time.Now()
+	if self.riskReader.CountRecentSignups(campaignID, now.Add(-self.rules.VelocityWindow)) >= self.rules.VelocityLimit {
+		add(ReasonVelocity, self.rules.VelocityWeight)
+	}
+	if self.riskReader.CountRecentSignups(campaignID, now.Add(-self.rules.BurstWindow)) >= self.rules.BurstLimit {
+		add(ReasonBurst, self.rules.BurstWeight)
+	}
+	if signals.IP == "" || signals.UserAgent == "" {
+		add(ReasonMissingFingerprint, self.rules.MissingWeight)
+	}
+	if self.riskReader.CountSharedFingerprint(campaignID, risk.Fingerprint) > 0 {
+		add(ReasonSharedFingerprint, self.rules.FingerprintWeight)
+	} else if self.riskReader.CountSharedIP(campaignID, risk.IPHash) >= self.rules.SharedIPLimit {
+		add(ReasonSharedIP, self.rules.SharedIPWeight)
+	}
+	if self.riskReader.CountOwnedCampaigns(signals.Address) > 0 {
+		add(ReasonAddressReuse, self.rules.AddressReuseWeight)
+	}
+	risk.Score = min(risk.Score, 100)
+	risk.Flagged = risk.Score >= self.rules.FlagThreshold
+	return risk
+}
+
+// Hash hashes request details with an HMAC secret, so raw client IPs and user agents aren't
+// stored. Returns an empty string if any value is empty.
+func Hash(secret []byte, values ...string) string {
+	hasher := hmac.New(sha256.New, secret)
+	for _, value := range values {
+		if value == "" {
+			return ""
+		}
+		hasher.Write([]byte(value))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil)[:16])
+}
@@ -0,0 +1,61 @@
+package fraud_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/fraud"
+)
+
+// riskReader is a stub signup history for scoring tests.
+type riskReader struct {
+	recent       int64
+	sharedIP     int64
+	sharedPrint  int64
+	ownCampaigns int64
+}
+
+func (self riskReader) CountRecentSignups(uint64, time.Time) int64  { return self.recent }
+func (self riskReader) CountSharedIP(uint64, string) int64          { return self.sharedIP }
+func (self riskReader) CountSharedFingerprint(uint64, string) int64 { return self.sharedPrint }
+func (self riskReader) CountOwnedCampaigns(string) int64            { return self.ownCampaigns }
+
+var secret = []byte("fraud-test-secret")
+
+func TestScoreLowRisk(t *testing.T) {
+	scorer := fraud.NewScorer(riskReader{}, fraud.DefaultRules, secret)
+	risk := scorer.Score(fraud.Signals{CampaignID: 1, Address: "tp1", IP: "10.0.0.1", UserAgent: "Mozilla/5.0"})
+	if risk.Flagged || risk.Score != 0 || len(risk.Reasons) != 0 {
+		t.Fatalf("expected low risk signup, got: %+v", risk)
+	}
+	if risk.IPHash == "" || risk.Fingerprint == "" {
+		t.Fatalf("expected hashed client fingerprint")
+	}
+}
+
+func TestScoreFlagged(t *testing.T) {
+	scorer := fraud.NewScorer(riskReader{recent: 10, sharedPrint: 1}, fraud.DefaultRules, secret)
+	risk := scorer.Score(fraud.Signals{CampaignID: 1, Address: "tp1", IP: "10.0.0.1", UserAgent: "Mozilla/5.0"})
+	if !risk.Flagged {
+		t.Fatalf("expected flagged signup, got: %+v", risk)
+	}
+	for _, reason := range []string{fraud.ReasonBurst, fraud.ReasonSharedFingerprint} {
+		if !slices.Contains(risk.Reasons, reason) {
+			t.Fatalf("expected risk reason %s, got: %+v", reason, risk.Reasons)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	hash := fraud.Hash(secret, "10.0.0.1")
+	if hash == "" || hash != fraud.Hash(secret, "10.0.0.1") {
+		t.Fatalf("expected stable hash, got: %s", hash)
+	}
+	if hash == fraud.Hash([]byte("other-secret"), "10.0.0.1") {
+		t.Fatalf("expected hash to depend on the secret")
+	}
+	if fraud.Hash(secret, "10.0.0.1", "") != "" {
+		t.Fatalf("expected empty hash for missing values")
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler is the http/json api for issuing and revoking API keys
+type APIKeyHandler struct {
+	apiKeyKeeper keeper.APIKeyKeeper
+	paging       Paging
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyKeeper keeper.APIKeyKeeper, paging Paging) APIKeyHandler {
+	return APIKeyHandler{apiKeyKeeper, paging}
+}
+
+// GET /keys
+// GetAPIKeys gets a page of API keys
+func (self APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	cursor, limit := self.paging.params(c)
+	next, keys := self.apiKeyKeeper.GetAPIKeys(cursor, limit)
+	okJson(c, gin.H{"cursor": next, "keys": keys})
+}
+
+// POST /keys
+// CreateAPIKey issues a new API key. The plaintext key is only returned once.
+func (self APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var request APIKeyRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	name, scopes, err := request.Validate()
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	apiKey, key, err := self.apiKeyKeeper.CreateAPIKey(name, scopes)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	createdJson(c, gin.H{"apiKey": apiKey, "key": key})
+}
+
+// DELETE /keys/:kid
+// RevokeAPIKey revokes an API key
+func (self APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := uintParam(c, "kid")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	apiKey, err := self.apiKeyKeeper.RevokeAPIKey(id)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"apiKey": apiKey})
+}
+
+// APIKeyRequest is the request type for issuing API keys.
+type APIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// Validate API key request fields
+func (self APIKeyRequest) Validate() (string, []string, error) {
+	name := strings.TrimSpace(self.Name)
+	if name == "" {
+		return "", nil, domain.NewError(domain.ErrValidation, "name cannot be blank")
+	}
+	scopes, err := domain.ValidateScopes(self.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, scopes, nil
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Record a referral link click and its tracking params for the visitor, setting a visitor
+// cookie on first visit. Returns the visitor ID.
+func (self redirectRequest) recordTouch(
+	c *gin.Context, campaignID uint64, params domain.Params, path, cookieDomain string) string {
+
+	visitorID, err := c.Cookie(VisitorCookieName)
+	if err != nil || visitorID == "" {
+		if visitorID, err = auth.RandomToken(16); err != nil {
+			log.Printf("failed to create visitor ID: %s", err.Error())
+			return ""
+		}
+	}
+	c.SetCookie(VisitorCookieName, visitorID, self.cookieMaxAge(), path, cookieDomain, false, true)
+	if _, err := self.touchKeeper.RecordTouch(visitorID, campaignID, params); err != nil {
+		log.Printf("failed to record referral touch: %s", err.Error())
+	}
+	return visitorID
+}
+
+// Count a bot hit on a referral link that wasn't recorded as a click. Hits are recorded and
+// logged in batches.
+func (self redirectRequest) filterHit(campaignID uint64, reason string) {
+	self.hits.Count(campaignID, reason)
+}
+
+// Check whether an existing campaign cookie should be kept rather than overwritten by a click.
+// Only a cookie for a campaign using first touch attribution is kept.
+func (self redirectRequest) keepCookie(c *gin.Context, clicked domain.Campaign) bool {
+	current, err := self.cookieCampaign(c)
+	return err == nil && current.ID != clicked.ID && self.mode(current) == domain.AttributionFirst
+}
+
+// Pick the campaign to credit for a conversion, with signup metadata for the visitor. A
+// signed referral token takes precedence over clicks recorded against the visitor cookie.
+func (self redirectRequest) referral(c *gin.Context) (domain.Campaign, domain.SignupMeta, error) {
+	if token := c.Query(TokenParam); token != "" && self.options.Tokens != nil {
+		campaign, meta, err := self.claimToken(token)
+		if err == nil {
+			return campaign, meta, nil
+		}
+		log.Printf("failed to claim referral token: %s", err.Error())
+	}
+	visitorID, _ := c.Cookie(VisitorCookieName)
+	campaign, err := self.attribute(c, visitorID)
+	return campaign, domain.SignupMeta{VisitorID: visitorID}, err
+}
+
+// Pick the campaign to credit for a conversion. The campaign cookie decides unless its campaign
+// uses server attribution, in which case the campaign is picked from the visitor's recorded
+// clicks. Without a campaign cookie, only a click picked for a server attribution campaign counts.
+func (self redirectRequest) attribute(c *gin.Context, visitorID string) (domain.Campaign, error) {
+	cookied, err := self.cookieCampaign(c)
+	if err == nil && self.mode(cookied) != domain.AttributionServer {
+		return cookied, nil
+	}
+	if visitorID != "" {
+		campaign, ok := self.pickTouch(visitorID)
+		if ok && (err == nil || self.mode(campaign) == domain.AttributionServer) {
+			return campaign, nil
+		}
+	}
+	return cookied, err
+}
+
+// Pick a campaign from a visitor's clicks within the cookie max age. Clicks are replayed
+// oldest first: a later click takes credit unless the campaign picked so far uses first touch
+// attribution, which is never displaced by a later click.
+func (self redirectRequest) pickTouch(visitorID string) (picked domain.Campaign, ok bool) {
+	since := time.Now().Add(-self.options.CookieMaxAge)
+	campaigns := make(map[uint64]domain.Campaign)
+	for _, touch := range self.touchKeeper.GetTouches(visitorID, since) {
+		campaign, found := campaigns[touch.CampaignID]
+		if !found {
+			var err error
+			if campaign, err = self.campaignReader.GetCampaign(touch.CampaignID); err != nil {
+				continue
+			}
+			campaigns[touch.CampaignID] = campaign
+		}
+		if !ok || self.mode(picked) != domain.AttributionFirst {
+			picked, ok = campaign, true
+		}
+	}
+	return
+}
+
+// Get the campaign from the referral campaign cookie.
+func (self redirectRequest) cookieCampaign(c *gin.Context) (domain.Campaign, error) {
+	cookie, err := c.Cookie(CookieName)
+	if err == http.ErrNoCookie {
+		return domain.Campaign{}, fmt.Errorf("no cookie")
+	}
+	campaignID, err := strconv.ParseUint(cookie, 10, 64)
+	if err != nil {
+		return domain.Campaign{}, fmt.Errorf("failed to parse referral campaign cookie ID: %s", err.Error())
+	}
+	campaign, err := self.campaignReader.GetCampaign(campaignID)
+	if err != nil {
+		return domain.Campaign{}, fmt.Errorf("failed to get referral campaign %d: %s", campaignID, err.Error())
+	}
+	return campaign, nil
+}
+
+// Get the attribution mode for a campaign, falling back to the deployment default.
+func (self redirectRequest) mode(campaign domain.Campaign) string {
+	if campaign.Attribution != "" {
+		return campaign.Attribution
+	}
+	return self.options.Attribution
+}
+
+// Get the referral cookie max age in seconds.
+func (self redirectRequest) cookieMaxAge() int {
+	return int(self.options.CookieMaxAge.Seconds())
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the gin context key for authenticated callers
+const principalKey = "principal"
+
+// SignatureMaxSkew is the max clock skew allowed for signed request timestamps.
+var SignatureMaxSkew = 5 * time.Minute
+
+// AuthHandler authenticates api callers and enforces scoped permissions
+type AuthHandler struct {
+	apiKeyReader  keeper.APIKeyReader
+	sessionReader keeper.SessionReader
+	nonceKeeper   keeper.NonceKeeper
+	keySet        *auth.KeySet
+}
+
+// NewAuthHandler creates a new authentication middleware handler
+func NewAuthHandler(
+	apiKeyReader keeper.APIKeyReader,
+	sessionReader keeper.SessionReader,
+	nonceKeeper keeper.NonceKeeper,
+	keySet *auth.KeySet,
+) AuthHandler {
+	return AuthHandler{apiKeyReader, sessionReader, nonceKeeper, keySet}
+}
+
+// Authenticate resolves the caller from an API key, session access token or signed address
+// headers when provided. Requests without credentials continue unauthenticated; invalid
+// credentials are rejected.
+func (self AuthHandler) Authenticate(c *gin.Context) {
+	if token := bearerToken(c); token != "" && !auth.IsAPIKey(token) {
+		principal, err := self.verifyAccessToken(token)
+		if err != nil {
+			unauthorizedJson(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, principal)
+	} else if key := apiKeyCredential(c); key != "" {
+		apiKey, err := self.apiKeyReader.Authenticate(key)
+		if err != nil {
+			unauthorizedJson(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, domain.Principal{KeyID: apiKey.ID, Name: apiKey.Name, Scopes: apiKey.Scopes})
+	} else if c.GetHeader("x-account-signature") != "" {
+		address, err := self.verifySignedRequest(c)
+		if errors.Is(err, domain.ErrUnavailable) {
+			domainErrorJson(c, err)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			unauthorizedJson(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, domain.Principal{Name: address, Address: address})
+	}
+	c.Next()
+}
+
+// RequireScope only allows authenticated callers that have been granted a scope.
+func (self AuthHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := getPrincipal(c)
+		if !ok {
+			unauthorizedJson(c, fmt.Errorf("authentication required"))
+			c.Abort()
+			return
+		}
+		if !principal.HasScope(scope) {
+			forbiddenJson(c, fmt.Errorf("missing required scope: %s", scope))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Check that the caller owns a campaign or has a scope for all campaigns, sending a
+// 401 or 403 error response if not. Callers pass the scope the operation needs on other
+// owners' campaigns.
+func authorizeCampaign(c *gin.Context, campaign domain.Campaign, scope string) bool {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		unauthorizedJson(c, fmt.Errorf("authentication required"))
+		return false
+	}
+	if !principal.CanAccess(campaign, scope) {
+		forbiddenJson(c, fmt.Errorf("campaign %d: access denied", campaign.ID))
+		return false
+	}
+	return true
+}
+
+// Check that the caller is an address or has a scope for all addresses, sending a 401 or 403
+// error response if not.
+func authorizeAddress(c *gin.Context, address, scope string) bool {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		unauthorizedJson(c, fmt.Errorf("authentication required"))
+		return false
+	}
+	if !principal.HasScope(scope) && principal.Address != address {
+		forbiddenJson(c, fmt.Errorf("address %s: access denied", address))
+		return false
+	}
+	return true
+}
+
+// Verify a session access token that hasn't been revoked.
+func (self AuthHandler) verifyAccessToken(token string) (domain.Principal, error) {
+	claims, err := self.keySet.Verify(token)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	if self.sessionReader.IsAccessTokenRevoked(claims.ID) {
+		return domain.Principal{}, fmt.Errorf("access token revoked")
+	}
+	return domain.Principal{
+		Name:           claims.Subject,
+		Address:        claims.Subject,
+		TokenID:        claims.ID,
+		TokenExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// Verify a request signed by the key for a blockchain address. The signed message is the
+// request method, path, raw query, unix timestamp and hex sha256 of the body separated by
+// newlines. Signed messages are recorded until their timestamp is out of the allowed skew, so
+// a signed request can't be replayed, even with a re-encoded signature.
+func (self AuthHandler) verifySignedRequest(c *gin.Context) (string, error) {
+	address := c.GetHeader("x-account-address")
+	timestamp := c.GetHeader("x-account-timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature timestamp: %s", timestamp)
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := time.Since(signedAt); skew > SignatureMaxSkew || skew < -SignatureMaxSkew {
+		return "", fmt.Errorf("signature timestamp expired")
+	}
+	bodyHash, err := hashBody(c)
+	if err != nil {
+		return "", fmt.Errorf("unable to read request body: %s", err.Error())
+	}
+	message := strings.Join([]string{
+		c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, timestamp, bodyHash,
+	}, "\n")
+	pubKey, signature := c.GetHeader("x-account-pubkey"), c.GetHeader("x-account-signature")
+	if err := auth.VerifySignature(address, pubKey, signature, []byte(message)); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(address + "\n" + message))
+	err = self.nonceKeeper.UseNonce("signature:"+hex.EncodeToString(sum[:]), signedAt.Add(SignatureMaxSkew))
+	if errors.Is(err, domain.ErrConflict) {
+		return "", fmt.Errorf("signature already used")
+	}
+	if err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// Hash a request body for signature verification, leaving the body to be read again.
+func hashBody(c *gin.Context) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get the authenticated caller for a request.
+func getPrincipal(c *gin.Context) (domain.Principal, bool) {
+	if value, ok := c.Get(principalKey); ok {
+		principal, ok := value.(domain.Principal)
+		return principal, ok
+	}
+	return domain.Principal{}, false
+}
+
+// Read an API key from the x-api-key header or a bearer authorization header.
+func apiKeyCredential(c *gin.Context) string {
+	if key := c.GetHeader("x-api-key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	return bearerToken(c)
+}
+
+// Read a bearer token from the authorization header.
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
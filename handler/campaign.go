@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/carp-cobain/referrals/domain"
 	"github.com/carp-cobain/referrals/keeper"
 	"github.com/gin-gonic/gin"
 )
@@ -11,28 +12,38 @@ import (
 // CampaignHandler is the http/json api for managing referral campaigns
 type CampaignHandler struct {
 	campaignKeeper keeper.CampaignKeeper
+	settings       *Live[Settings]
+	paging         Paging
 }
 
-// NewCampaignHandler creates a new referral campaign handler
-func NewCampaignHandler(campaignKeeper keeper.CampaignKeeper) CampaignHandler {
-	return CampaignHandler{campaignKeeper}
+// NewCampaignHandler creates a new referral campaign handler. Campaign destinations must be
+// on the current redirect allowlist.
+func NewCampaignHandler(
+	campaignKeeper keeper.CampaignKeeper, settings *Live[Settings], paging Paging) CampaignHandler {
+
+	return CampaignHandler{campaignKeeper, settings, paging}
 }
 
 // GET /campaigns
-// GetCampaigns gets a page of campaigns for an address
+// GetCampaigns gets a page of campaigns for an address. Callers can list their own campaigns,
+// or any address's campaigns with campaigns:read.
 func (self CampaignHandler) GetCampaigns(c *gin.Context) {
 	address := c.Query("address")
 	if address == "" {
 		badRequestJson(c, fmt.Errorf("address query param is required"))
 		return
 	}
-	cursor, limit := getPageParams(c)
+	if !authorizeAddress(c, address, domain.ScopeCampaignsRead) {
+		return
+	}
+	cursor, limit := self.paging.params(c)
 	next, campaigns := self.campaignKeeper.GetCampaigns(address, cursor, limit)
 	okJson(c, gin.H{"cursor": next, "campaigns": campaigns})
 }
 
 // GET /campaigns/:id
-// GetCampaign gets campaigns by ID
+// GetCampaign gets campaigns by ID. Callers can get their own campaigns, or any campaign with
+// campaigns:read.
 func (self CampaignHandler) GetCampaign(c *gin.Context) {
 	id, err := uintParam(c, "id")
 	if err != nil {
@@ -41,28 +52,48 @@ func (self CampaignHandler) GetCampaign(c *gin.Context) {
 	}
 	campaign, err := self.campaignKeeper.GetCampaign(id)
 	if err != nil {
-		notFoundJson(c, err)
+		domainErrorJson(c, err)
+		return
+	}
+	if !authorizeCampaign(c, campaign, domain.ScopeCampaignsRead) {
 		return
 	}
 	okJson(c, gin.H{"campaign": campaign})
 }
 
 // POST /campaigns
-// CreateCampaign creates new named campaigns
+// CreateCampaign creates new named campaigns. Campaign owners create campaigns for the
+// address bound to their session; API keys with campaigns:write provide an address.
 func (self CampaignHandler) CreateCampaign(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok {
+		unauthorizedJson(c, fmt.Errorf("authentication required"))
+		return
+	}
 	var request CampaignRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
+	if err := bindJSON(c, &request); err != nil {
 		badRequestJson(c, err)
 		return
 	}
-	address, name, err := request.Validate()
+	if principal.Address != "" {
+		if request.Address != "" && request.Address != principal.Address {
+			forbiddenJson(c, fmt.Errorf("address does not match session: %s", request.Address))
+			return
+		}
+		request.Address = principal.Address
+	} else if !principal.HasScope(domain.ScopeCampaignsWrite) {
+		forbiddenJson(c, fmt.Errorf("missing required scope: %s", domain.ScopeCampaignsWrite))
+		return
+	}
+	redirect := self.settings.Load().Redirect
+	address, name, options, err := request.Validate(redirect.Allowlist, redirect.DeepLinkSchemes)
 	if err != nil {
 		badRequestJson(c, err)
 		return
 	}
-	campaign, err := self.campaignKeeper.CreateCampaign(address, name)
+	campaign, err := self.campaignKeeper.CreateCampaign(address, name, options)
 	if err != nil {
-		badRequestJson(c, err)
+		domainErrorJson(c, err)
 		return
 	}
 	okJson(c, gin.H{"campaign": campaign})
@@ -70,21 +101,49 @@ func (self CampaignHandler) CreateCampaign(c *gin.Context) {
 
 // CampaignRequest is the request type for creating referral campaigns.
 type CampaignRequest struct {
-	Address string `json:"address" binding:"required,min=41,max=61"`
-	Name    string `json:"name"`
+	Address     string        `json:"address" binding:"omitempty,min=41,max=61"`
+	Name        string        `json:"name"`
+	Attribution string        `json:"attribution"`
+	UTM         domain.Params `json:"utm"`
+	Destination string        `json:"destination" binding:"max=2048"`
+	IOSURL      string        `json:"iosUrl" binding:"max=2048"`
+	AndroidURL  string        `json:"androidUrl" binding:"max=2048"`
+	DeepLink    string        `json:"deepLink" binding:"max=2048"`
+	Description string        `json:"description"`
+	ImageURL    string        `json:"imageUrl" binding:"max=2048"`
 }
 
-// Validate campaign request address
-func (self CampaignRequest) Validate() (string, string, error) {
-	address := strings.TrimSpace(self.Address)
-	if address == "" {
-		return "", "", fmt.Errorf("address cannot be blank")
+// Validate campaign request fields. Destinations must be on the redirect allowlist, and deep
+// links must use one of the app schemes.
+func (self CampaignRequest) Validate(
+	allowlist domain.RedirectAllowlist, appSchemes []string) (string, string, domain.CampaignOptions, error) {
+
+	var options domain.CampaignOptions
+	address, err := domain.ValidateAddress(self.Address)
+	if err != nil {
+		return "", "", options, err
+	}
+	if options.Attribution, err = domain.ValidateAttribution(self.Attribution); err != nil {
+		return "", "", options, err
+	}
+	if options.UTM, err = domain.ValidateUTM(self.UTM); err != nil {
+		return "", "", options, err
+	}
+	if options.Destination, err = allowlist.ValidateURL(self.Destination); err != nil {
+		return "", "", options, err
+	}
+	if options.IOSURL, err = allowlist.ValidateURL(self.IOSURL); err != nil {
+		return "", "", options, err
+	}
+	if options.AndroidURL, err = allowlist.ValidateURL(self.AndroidURL); err != nil {
+		return "", "", options, err
 	}
-	if strings.ToLower(address) != address {
-		return "", "", fmt.Errorf("address must be all lower case")
+	if options.DeepLink, err = allowlist.ValidateDeepLink(self.DeepLink, appSchemes); err != nil {
+		return "", "", options, err
 	}
-	if !strings.HasPrefix(address, "tp") {
-		return "", "", fmt.Errorf("address must have prefix: tp")
+	preview := domain.CampaignPreview{Description: self.Description, ImageURL: self.ImageURL}
+	if options.CampaignPreview, err = domain.ValidatePreview(preview); err != nil {
+		return "", "", options, err
 	}
-	return address, strings.TrimSpace(self.Name), nil
+	return address, strings.TrimSpace(self.Name), options, nil
 }
@@ -0,0 +1,24 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// ConfigHandler is the http/json api for inspecting the active config
+type ConfigHandler struct {
+	settings *Live[Settings]
+}
+
+// NewConfigHandler creates a new config handler
+func NewConfigHandler(settings *Live[Settings]) ConfigHandler {
+	return ConfigHandler{settings}
+}
+
+// GET /config
+// GetConfig gets the active config, with secrets redacted.
+func (self ConfigHandler) GetConfig(c *gin.Context) {
+	values, err := self.settings.Load().Config.Redacted()
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"config": values})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Platforms routed to their own campaign destinations
+const (
+	platformIOS     = "ios"
+	platformAndroid = "android"
+)
+
+// deepLinkPage tries to open an app deep link, falling back to a web destination when the
+// app isn't installed.
+var deepLinkPage = template.Must(template.New("deeplink").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Redirecting…</title></head>
+<body>
+<a href="{{.Fallback}}">Continue</a>
+<script>
+window.location.href = {{.DeepLink}};
+setTimeout(function () { window.location.href = {{.Fallback}}; }, 1500);
+</script>
+</body>
+</html>
+`))
+
+// Detect the mobile platform of a visitor from their user agent.
+func platform(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(userAgent, "android"):
+		return platformAndroid
+	case strings.Contains(userAgent, "iphone"), strings.Contains(userAgent, "ipad"),
+		strings.Contains(userAgent, "ipod"):
+		return platformIOS
+	}
+	return ""
+}
+
+// Get the destination for a campaign click: the visitor's platform URL, the campaign
+// destination, or the global signup URL.
+func destination(c *gin.Context, campaign domain.Campaign, signupURL string) string {
+	switch platform(c.Request.UserAgent()) {
+	case platformIOS:
+		if campaign.IOSURL != "" {
+			return campaign.IOSURL
+		}
+	case platformAndroid:
+		if campaign.AndroidURL != "" {
+			return campaign.AndroidURL
+		}
+	}
+	return defaultString(campaign.Destination, signupURL)
+}
+
+// Send a visitor to a campaign destination. Mobile visitors try the deep link first when
+// one is set.
+func redirect(c *gin.Context, deepLink, fallback string) {
+	if deepLink == "" || platform(c.Request.UserAgent()) == "" {
+		c.Redirect(http.StatusFound, fallback)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	data := map[string]string{"DeepLink": deepLink, "Fallback": fallback}
+	if err := deepLinkPage.Execute(c.Writer, data); err != nil {
+		log.Printf("failed to render deep link page: %s", err.Error())
+	}
+}
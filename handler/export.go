@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPageSize is the number of signups read from storage per page during exports.
+var ExportPageSize int = 1000
+
+// exportColumns are the header columns for CSV signup exports.
+var exportColumns = []string{
+	"id", "campaign_id", "campaign_name", "campaign_address", "address", "status", "created_at", "updated_at",
+}
+
+// ExportHandler is the http api for exporting referral campaign signups
+type ExportHandler struct {
+	campaignReader keeper.CampaignReader
+	signupKeeper   keeper.SignupKeeper
+}
+
+// NewExportHandler creates a new signup export handler
+func NewExportHandler(
+	campaignReader keeper.CampaignReader, signupKeeper keeper.SignupKeeper) ExportHandler {
+
+	return ExportHandler{campaignReader, signupKeeper}
+}
+
+// GET /campaigns/:id/signups/export?format=csv|jsonl&status=
+// ExportSignups streams all signups for a referral campaign to its owner
+func (self ExportHandler) ExportSignups(c *gin.Context) {
+	campaignID, err := uintParam(c, "id")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	campaign, err := self.campaignReader.GetCampaign(campaignID)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	if !authorizeCampaign(c, campaign, domain.ScopeAdmin) {
+		return
+	}
+	self.export(c, campaignID, fmt.Sprintf("campaign-%d-signups", campaignID))
+}
+
+// GET /signups/export?format=csv|jsonl&status=
+// ExportAllSignups streams all signups for all referral campaigns
+func (self ExportHandler) ExportAllSignups(c *gin.Context) {
+	self.export(c, 0, "signups")
+}
+
+// Stream signups page by page using an ID cursor, so exports are never fully loaded in memory.
+// A failure before the response starts gets an error response; after it starts, the connection
+// is aborted so clients see a truncated export rather than a complete one.
+func (self ExportHandler) export(c *gin.Context, campaignID uint64, filename string) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "jsonl" {
+		badRequestJson(c, fmt.Errorf("invalid export format: %s", format))
+		return
+	}
+	status := c.Query("status")
+	if status != "" {
+		var err error
+		if status, err = domain.ValidateSignupStatus(status); err != nil {
+			badRequestJson(c, err)
+			return
+		}
+	}
+	next, signups, err := self.signupKeeper.ExportSignups(campaignID, status, 0, ExportPageSize)
+	if err != nil {
+		domainErrorJson(c, err)
+		c.Abort()
+		return
+	}
+	write := jsonlExportWriter(c)
+	contentType := "application/jsonl"
+	if format == "csv" {
+		write = csvExportWriter(c)
+		contentType = "text/csv"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	c.Status(http.StatusOK)
+	for {
+		if err := write(signups); err != nil {
+			abortExport(c, err)
+		}
+		c.Writer.Flush()
+		if len(signups) < ExportPageSize {
+			break
+		}
+		if next, signups, err = self.signupKeeper.ExportSignups(campaignID, status, next, ExportPageSize); err != nil {
+			abortExport(c, err)
+		}
+	}
+}
+
+// Abort an export that failed after its response started, logging the failure. The status
+// has already been sent, so the handler panics with http.ErrAbortHandler to close the
+// connection.
+func abortExport(c *gin.Context, err error) {
+	log.Printf("%s %s failed after streaming started (request %s): %s",
+		c.Request.Method, c.FullPath(), c.GetString(requestIDKey), err.Error())
+	panic(http.ErrAbortHandler)
+}
+
+// Create a writer for CSV signup exports, starting with a header row. Text cells are escaped
+// so spreadsheets don't evaluate them as formulas.
+func csvExportWriter(c *gin.Context) func([]domain.SignupExport) error {
+	writer := csv.NewWriter(c.Writer)
+	header := true
+	return func(signups []domain.SignupExport) error {
+		if header {
+			if err := writer.Write(exportColumns); err != nil {
+				return err
+			}
+			header = false
+		}
+		for _, signup := range signups {
+			err := writer.Write([]string{
+				strconv.FormatUint(signup.ID, 10),
+				strconv.FormatUint(signup.CampaignID, 10),
+				csvText(signup.CampaignName),
+				csvText(signup.CampaignAddress),
+				csvText(signup.Address),
+				csvText(signup.Status),
+				signup.CreatedAt.UTC().Format(time.RFC3339),
+				signup.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+}
+
+// Escape a CSV text cell that a spreadsheet would evaluate as a formula by prefixing a quote.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Create a writer for JSONL signup exports, one JSON object per line.
+func jsonlExportWriter(c *gin.Context) func([]domain.SignupExport) error {
+	encoder := json.NewEncoder(c.Writer)
+	return func(signups []domain.SignupExport) error {
+		for _, signup := range signups {
+			if err := encoder.Encode(signup); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,761 @@
+package handler_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/bot"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/fraud"
+	"github.com/carp-cobain/referrals/handler"
+	"github.com/carp-cobain/referrals/keeper/memory"
+	"github.com/carp-cobain/referrals/ratelimit"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	referer = "tp1handler0referer00000000000000000000000000"
+	referee = "tp1handler0referee00000000000000000000000000"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// Create a memory store with a campaign.
+func newStore(t *testing.T) (*memory.Store, domain.Campaign) {
+	t.Helper()
+	store := memory.NewStore(time.Minute)
+	campaign, err := store.CreateCampaign(referer, "Handler", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	return store, campaign
+}
+
+// Create a signup handler backed by a memory store.
+func newSignupHandler(store *memory.Store) handler.SignupHandler {
+	return handler.NewSignupHandler(store, store, fraud.NewScorer(store, fraud.DefaultRules, []byte("handler-test")), handler.Paging{DefaultLimit: 10, MaxLimit: 1000})
+}
+
+// Create a redirect handler backed by a memory store. Filtered hits are recorded when the
+// test ends.
+func newRedirectHandler(
+	t *testing.T, store *memory.Store, settings *handler.Live[handler.Settings]) handler.RedirectHandler {
+
+	hits := bot.NewHitCounter(store.RecordFilteredHits, time.Minute)
+	t.Cleanup(func() { hits.Close() })
+	scorer := fraud.NewScorer(store, fraud.DefaultRules, []byte("handler-test"))
+	return handler.NewRedirectHandler(store, store, store, hits, scorer, settings)
+}
+
+// Create authentication middleware backed by a memory store.
+func newAuthHandler(store *memory.Store) handler.AuthHandler {
+	return handler.NewAuthHandler(store, store, store, auth.NewKeySet(store.GetSigningKeys))
+}
+
+// Create an API key with scopes, returning its plaintext key.
+func newAPIKey(t *testing.T, store *memory.Store, scopes ...string) string {
+	t.Helper()
+	_, key, err := store.CreateAPIKey("handler", scopes)
+	if err != nil {
+		t.Fatalf("failed to create api key: %+v", err)
+	}
+	return key
+}
+
+// Send a JSON request to a router with optional header name/value pairs, and decode the JSON
+// response body.
+func serve(
+	t *testing.T, r http.Handler, method, path, body string, headers ...string) (*httptest.ResponseRecorder, map[string]any) {
+
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var response map[string]any
+	if strings.Contains(w.Header().Get("Content-Type"), "json") {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to decode response: %+v: %s", err, w.Body.String())
+		}
+	}
+	return w, response
+}
+
+func TestUpdateFlaggedSignup(t *testing.T) {
+	store, campaign := newStore(t)
+	flagged := domain.SignupMeta{Risk: domain.Risk{Score: 90, Flagged: true}}
+	signup, err := store.CreateSignup(campaign.ID, referee, flagged)
+	if err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	r := gin.New()
+	r.PATCH("/campaigns/:id/signups/:sid", newSignupHandler(store).UpdateSignup)
+	w, response := serve(t, r, http.MethodPatch, "/campaigns/1/signups/1", `{"status":"verified"}`)
+	if w.Code != http.StatusBadRequest || response["code"] != handler.CodeValidationFailed {
+		t.Fatalf("expected flagged signup verification to be rejected, got: %d %+v", w.Code, response)
+	}
+	if signup, _ = store.GetSignup(signup.ID); signup.Status != domain.SignupFlagged {
+		t.Fatalf("expected signup to stay flagged, got: %s", signup.Status)
+	}
+}
+
+func TestUpdateSignupToFlagged(t *testing.T) {
+	store, campaign := newStore(t)
+	if _, err := store.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	r := gin.New()
+	r.PATCH("/campaigns/:id/signups/:sid", newSignupHandler(store).UpdateSignup)
+	w, response := serve(t, r, http.MethodPatch, "/campaigns/1/signups/1", `{"status":"flagged"}`)
+	if w.Code != http.StatusBadRequest || response["code"] != handler.CodeValidationFailed {
+		t.Fatalf("expected client flagging to be rejected, got: %d %+v", w.Code, response)
+	}
+}
+
+func TestCreateSignupForwarding(t *testing.T) {
+	store, _ := newStore(t)
+	r := gin.New()
+	r.POST("/campaigns/:id/signups", newAuthHandler(store).Authenticate, newSignupHandler(store).CreateSignup)
+	body := `{"address":"` + referee + `","ip":"10.0.0.1","userAgent":"Mozilla/5.0"}`
+	writer := newAPIKey(t, store, domain.ScopeSignupsWrite)
+	w, response := serve(t, r, http.MethodPost, "/campaigns/1/signups", body, "x-api-key", writer)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected forwarded client details to need a scope, got: %d %+v", w.Code, response)
+	}
+	forwarder := newAPIKey(t, store, domain.ScopeSignupsWrite, domain.ScopeSignupsForward)
+	w, response = serve(t, r, http.MethodPost, "/campaigns/1/signups", body, "x-api-key", forwarder)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected forwarded client details to be accepted, got: %d %+v", w.Code, response)
+	}
+}
+
+func TestCreateSignupAlreadyReferred(t *testing.T) {
+	store, campaign := newStore(t)
+	if _, err := store.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	r := gin.New()
+	r.POST("/campaigns/:id/signups", newSignupHandler(store).CreateSignup)
+	body := `{"address":"` + referee + `"}`
+	w, response := serve(t, r, http.MethodPost, "/campaigns/1/signups", body)
+	if w.Code != http.StatusConflict || response["code"] != handler.CodeAlreadyReferred {
+		t.Fatalf("expected already referred conflict, got: %d %+v", w.Code, response)
+	}
+}
+
+func TestReviewQueuePages(t *testing.T) {
+	store, campaign := newStore(t)
+	for i, score := range []int{70, 90, 80} {
+		meta := domain.SignupMeta{Risk: domain.Risk{Score: score, Flagged: true}}
+		if _, err := store.CreateSignup(campaign.ID, referee+string(rune('a'+i)), meta); err != nil {
+			t.Fatalf("failed to create signup: %+v", err)
+		}
+	}
+	reviews := handler.NewReviewHandler(store, store, handler.NewLive(handler.Settings{}), handler.Paging{DefaultLimit: 2, MaxLimit: 10})
+	r := gin.New()
+	r.GET("/review/signups", newAuthHandler(store).Authenticate, reviews.GetReviewQueue)
+	reviewer := newAPIKey(t, store, domain.ScopeSignupsVerify)
+	var scores []float64
+	cursor := 0.0
+	for page := 0; page < 2; page++ {
+		path := fmt.Sprintf("/review/signups?cursor=%d", int(cursor))
+		w, response := serve(t, r, http.MethodGet, path, "", "x-api-key", reviewer)
+		if w.Code != http.StatusOK {
+			t.Fatalf("failed to get review queue page %d: %d %+v", page, w.Code, response)
+		}
+		for _, signup := range response["signups"].([]any) {
+			scores = append(scores, signup.(map[string]any)["riskScore"].(float64))
+		}
+		cursor = response["cursor"].(float64)
+	}
+	if fmt.Sprint(scores) != "[90 80 70]" {
+		t.Fatalf("expected both review queue pages highest risk first, got: %v", scores)
+	}
+}
+
+func TestClaimAlreadyReferred(t *testing.T) {
+	store, campaign := newStore(t)
+	if _, err := store.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	tokens, err := auth.NewReferralTokens("handler-test-referral-token-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create referral tokens: %+v", err)
+	}
+	token, err := tokens.Sign(campaign.ID, "visitor")
+	if err != nil {
+		t.Fatalf("failed to sign referral token: %+v", err)
+	}
+	settings := handler.NewLive(handler.Settings{
+		Redirect: handler.RedirectOptions{SignupURL: "https://myapp.io/signup", Tokens: tokens},
+	})
+	redirectHandler := newRedirectHandler(t, store, settings)
+	r := gin.New()
+	r.POST("/referrals/claim", redirectHandler.Claim)
+	body := `{"token":"` + token + `","address":"` + referee + `"}`
+	w, response := serve(t, r, http.MethodPost, "/referrals/claim", body)
+	if w.Code != http.StatusConflict || response["code"] != handler.CodeAlreadyReferred {
+		t.Fatalf("expected already referred conflict, got: %d %+v", w.Code, response)
+	}
+}
+
+func TestClaimTokenErrors(t *testing.T) {
+	store, _ := newStore(t)
+	tokens, err := auth.NewReferralTokens("handler-test-referral-token-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create referral tokens: %+v", err)
+	}
+	missing, err := tokens.Sign(1000, "visitor")
+	if err != nil {
+		t.Fatalf("failed to sign referral token: %+v", err)
+	}
+	settings := handler.NewLive(handler.Settings{
+		Redirect: handler.RedirectOptions{SignupURL: "https://myapp.io/signup", Tokens: tokens},
+	})
+	r := gin.New()
+	r.POST("/referrals/claim", newRedirectHandler(t, store, settings).Claim)
+	for token, expected := range map[string]struct {
+		status int
+		code   string
+	}{
+		"not-a-token": {http.StatusBadRequest, handler.CodeValidationFailed},
+		missing:       {http.StatusNotFound, handler.CodeNotFound},
+	} {
+		body := `{"token":"` + token + `","address":"` + referee + `"}`
+		w, response := serve(t, r, http.MethodPost, "/referrals/claim", body)
+		if w.Code != expected.status || response["code"] != expected.code {
+			t.Fatalf("expected %d %s for token %s, got: %d %+v", expected.status, expected.code, token, w.Code, response)
+		}
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	store, _ := newStore(t)
+	tokens, err := auth.NewReferralTokens("handler-test-referral-token-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create referral tokens: %+v", err)
+	}
+	settings := handler.NewLive(handler.Settings{
+		Redirect: handler.RedirectOptions{SignupURL: "https://myapp.io/signup", Tokens: tokens},
+	})
+	claim := newRedirectHandler(t, store, settings).Claim
+	r := gin.New()
+	r.Use(handler.RequestID())
+	r.POST("/referrals/claim", claim)
+
+	// Binding failures are reported with JSON field names
+	w, response := serve(t, r, http.MethodPost, "/referrals/claim", `{"token":"abc"}`, handler.RequestIDHeader, "req-1")
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != handler.ProblemContentType {
+		t.Fatalf("expected problem response, got: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	expected := map[string]any{
+		"type":      "about:blank",
+		"title":     "Bad Request",
+		"status":    float64(http.StatusBadRequest),
+		"instance":  "/referrals/claim",
+		"code":      handler.CodeValidationFailed,
+		"detail":    "request has invalid fields",
+		"requestId": "req-1",
+	}
+	for key, value := range expected {
+		if response[key] != value {
+			t.Fatalf("expected %s %v, got: %+v", key, value, response)
+		}
+	}
+	if w.Header().Get(handler.RequestIDHeader) != "req-1" {
+		t.Fatalf("expected request ID to be echoed, got: %s", w.Header().Get(handler.RequestIDHeader))
+	}
+	fields, _ := response["errors"].([]any)
+	if len(fields) != 1 || fields[0].(map[string]any)["field"] != "address" || fields[0].(map[string]any)["code"] != "required" {
+		t.Fatalf("expected address required field error, got: %+v", response["errors"])
+	}
+
+	// JSON type errors are reported with JSON field names, and invalid request IDs are replaced
+	w, response = serve(t, r, http.MethodPost, "/referrals/claim", `{"token":1}`, handler.RequestIDHeader, "bad id!")
+	fields, _ = response["errors"].([]any)
+	if len(fields) != 1 || fields[0].(map[string]any)["field"] != "token" || fields[0].(map[string]any)["code"] != "type" {
+		t.Fatalf("expected token type field error, got: %+v", response["errors"])
+	}
+	requestID := w.Header().Get(handler.RequestIDHeader)
+	if requestID == "" || requestID == "bad id!" || response["requestId"] != requestID {
+		t.Fatalf("expected invalid request ID to be replaced, got: %q %+v", requestID, response)
+	}
+
+	// Legacy clients get the error shape and text they had before problem details
+	legacy := gin.New()
+	legacy.Use(handler.RequestID(), handler.LegacyErrors())
+	legacy.POST("/referrals/claim", claim)
+	w, response = serve(t, legacy, http.MethodPost, "/referrals/claim", `{"token":"abc"}`)
+	if w.Code != http.StatusBadRequest || len(response) != 1 {
+		t.Fatalf("expected legacy error response, got: %d %+v", w.Code, response)
+	}
+	if message, _ := response["error"].(string); !strings.Contains(message, "ClaimRequest.Address") {
+		t.Fatalf("expected legacy error to name struct fields, got: %+v", response)
+	}
+}
+
+// Sign a request with headers for an account key, returning header name/value pairs.
+func signRequest(
+	t *testing.T, privKey *secp256k1.PrivateKey, method, path, query, body string, signedAt time.Time) []string {
+
+	t.Helper()
+	pubKey := privKey.PubKey().SerializeCompressed()
+	address, err := auth.PubKeyAddress(pubKey)
+	if err != nil {
+		t.Fatalf("failed to derive address: %+v", err)
+	}
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	bodyHash := sha256.Sum256([]byte(body))
+	message := strings.Join([]string{method, path, query, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+	hash := sha256.Sum256([]byte(message))
+	signature := ecdsa.SignCompact(privKey, hash[:], true)[1:]
+	return []string{
+		"x-account-address", address,
+		"x-account-pubkey", base64.StdEncoding.EncodeToString(pubKey),
+		"x-account-timestamp", timestamp,
+		"x-account-signature", base64.StdEncoding.EncodeToString(signature),
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	store, _ := newStore(t)
+	privKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %+v", err)
+	}
+	owner, _ := auth.PubKeyAddress(privKey.PubKey().SerializeCompressed())
+	if _, err := store.CreateCampaign(owner, "Signed", domain.CampaignOptions{}); err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	r := gin.New()
+	r.GET("/campaigns/:id/signups", newAuthHandler(store).Authenticate, newSignupHandler(store).GetSignups)
+	path := "/campaigns/2/signups"
+	headers := signRequest(t, privKey, http.MethodGet, path, "limit=5", "", time.Now())
+	if w, response := serve(t, r, http.MethodGet, path+"?limit=5", "", headers...); w.Code != http.StatusOK {
+		t.Fatalf("expected signed owner request to be accepted, got: %d %+v", w.Code, response)
+	}
+	if w, _ := serve(t, r, http.MethodGet, path+"?limit=5", "", headers...); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected replayed signed request to be rejected, got: %d", w.Code)
+	}
+	headers = signRequest(t, privKey, http.MethodGet, path, "limit=5", "", time.Now().Add(-time.Second))
+	if w, _ := serve(t, r, http.MethodGet, path+"?limit=500", "", headers...); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected signed request with a changed query to be rejected, got: %d", w.Code)
+	}
+	headers = signRequest(t, privKey, http.MethodGet, path, "", `{"a":1}`, time.Now())
+	if w, _ := serve(t, r, http.MethodGet, path, `{"a":2}`, headers...); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected signed request with a changed body to be rejected, got: %d", w.Code)
+	}
+	// Only owners and admins can list full signups for a campaign.
+	reader := newAPIKey(t, store, domain.ScopeSignupsRead)
+	if w, _ := serve(t, r, http.MethodGet, path, "", "x-api-key", reader); w.Code != http.StatusForbidden {
+		t.Fatalf("expected signups:read key to be forbidden, got: %d", w.Code)
+	}
+	admin := newAPIKey(t, store, domain.ScopeAdmin)
+	if w, _ := serve(t, r, http.MethodGet, path, "", "x-api-key", admin); w.Code != http.StatusOK {
+		t.Fatalf("expected admin key to be allowed, got: %d", w.Code)
+	}
+}
+
+func TestReloadCookieMaxAge(t *testing.T) {
+	store, _ := newStore(t)
+	options := handler.RedirectOptions{SignupURL: "https://myapp.io/signup", CookieMaxAge: time.Hour}
+	settings := handler.NewLive(handler.Settings{Redirect: options})
+	r := gin.New()
+	r.GET("/referrals/:id/signup", newRedirectHandler(t, store, settings).Signup)
+	for _, maxAge := range []time.Duration{time.Hour, 2 * time.Hour} {
+		options.CookieMaxAge = maxAge
+		settings.Store(handler.Settings{Redirect: options})
+		w, _ := serve(t, r, http.MethodGet, "/referrals/1/signup", "")
+		expected := fmt.Sprintf("Max-Age=%d", int(maxAge.Seconds()))
+		if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Set-Cookie"), expected) {
+			t.Fatalf("expected reloaded cookie %s, got: %d %s", expected, w.Code, w.Header().Values("Set-Cookie"))
+		}
+	}
+}
+
+// Get the value of a cookie set by a response, if any.
+func responseCookie(w *httptest.ResponseRecorder, name string) (string, bool) {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestAttributionMixedModes(t *testing.T) {
+	store, last := newStore(t)
+	first, err := store.CreateCampaign(referer, "First", domain.CampaignOptions{Attribution: domain.AttributionFirst})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	server, err := store.CreateCampaign(referer, "Server", domain.CampaignOptions{Attribution: domain.AttributionServer})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	options := handler.RedirectOptions{
+		SignupURL:    "https://myapp.io/signup",
+		CookieMaxAge: time.Hour,
+		Attribution:  domain.AttributionLast,
+	}
+	redirectHandler := newRedirectHandler(t, store, handler.NewLive(handler.Settings{Redirect: options}))
+	r := gin.New()
+	r.GET("/referrals/:id/signup", redirectHandler.Signup)
+	r.GET("/referrals", redirectHandler.Referrals)
+	click := func(campaignID uint64, cookies string) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/referrals/%d/signup", campaignID)
+		w, _ := serve(t, r, http.MethodGet, path, "", "Cookie", cookies)
+		if w.Code != http.StatusFound {
+			t.Fatalf("expected redirect for campaign %d, got: %d", campaignID, w.Code)
+		}
+		return w
+	}
+	// A first touch campaign takes over a last touch cookie, and then keeps it.
+	lastCookie := fmt.Sprintf("%s=%d", handler.CookieName, last.ID)
+	if value, _ := responseCookie(click(first.ID, lastCookie), handler.CookieName); value != fmt.Sprint(first.ID) {
+		t.Fatalf("expected first touch campaign to replace last touch cookie, got: %q", value)
+	}
+	firstCookie := fmt.Sprintf("%s=%d", handler.CookieName, first.ID)
+	if value, ok := responseCookie(click(last.ID, firstCookie), handler.CookieName); ok {
+		t.Fatalf("expected first touch cookie to be kept, got: %q", value)
+	}
+	// A server attribution campaign is credited from recorded clicks without a campaign cookie,
+	// even though the deployment default is last touch.
+	visitorID, ok := responseCookie(click(server.ID, ""), handler.VisitorCookieName)
+	if !ok {
+		t.Fatalf("expected visitor cookie")
+	}
+	visitorCookie := fmt.Sprintf("%s=%s", handler.VisitorCookieName, visitorID)
+	serve(t, r, http.MethodGet, "/referrals", "", "Cookie", visitorCookie, "x-account-address", referee)
+	if _, signups := store.GetSignups(server.ID, 0, 10); len(signups) != 1 {
+		t.Fatalf("expected signup credited to server attribution campaign, got: %+v", signups)
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	store, _ := newStore(t)
+	allowlist := domain.RedirectAllowlist{"good.com"}
+	request := handler.CampaignRequest{
+		Address:     referer,
+		Name:        "Destinations",
+		Destination: "https://good.com/web",
+		IOSURL:      "https://good.com/ios",
+		DeepLink:    "myapp://refer",
+	}
+	_, name, options, err := request.Validate(allowlist, []string{"myapp"})
+	if err != nil {
+		t.Fatalf("expected valid campaign destinations: %+v", err)
+	}
+	for _, deepLink := range []string{"javascript:alert(1)", "otherapp://refer", "https://good.com@evil.com"} {
+		invalid := request
+		invalid.DeepLink = deepLink
+		if _, _, _, err := invalid.Validate(allowlist, []string{"myapp"}); err == nil {
+			t.Fatalf("expected deep link %q to be rejected", deepLink)
+		}
+	}
+	campaign, err := store.CreateCampaign(referer, name, options)
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	settings := handler.NewLive(handler.Settings{Redirect: handler.RedirectOptions{SignupURL: "https://good.com/signup"}})
+	r := gin.New()
+	r.GET("/referrals/:id/signup", newRedirectHandler(t, store, settings).Signup)
+	path := fmt.Sprintf("/referrals/%d/signup", campaign.ID)
+	// Desktop visitors are redirected to the destination.
+	w, _ := serve(t, r, http.MethodGet, path, "", "User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://good.com/web" {
+		t.Fatalf("expected redirect to destination, got: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	// Mobile visitors try the deep link, falling back to their platform URL.
+	w, _ = serve(t, r, http.MethodGet, path, "", "User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `"myapp://refer"`) || !strings.Contains(body, `href="https://good.com/ios"`) {
+		t.Fatalf("expected deep link page with ios fallback, got: %d %s", w.Code, body)
+	}
+	w, _ = serve(t, r, http.MethodGet, path, "", "User-Agent", "Mozilla/5.0 (Linux; Android 14)")
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `href="https://good.com/web"`) {
+		t.Fatalf("expected deep link page with destination fallback, got: %d %s", w.Code, body)
+	}
+}
+
+func TestQRCodeCaching(t *testing.T) {
+	store, campaign := newStore(t)
+	r := gin.New()
+	r.GET("/campaigns/:id/qr.svg", newAuthHandler(store).Authenticate, handler.NewQRHandler(store, "https://ref.myapp.io").GetSVG)
+	path := fmt.Sprintf("/campaigns/%d/qr.svg", campaign.ID)
+	reader := newAPIKey(t, store, domain.ScopeCampaignsRead)
+	w, _ := serve(t, r, http.MethodGet, path, "", "x-api-key", reader)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+		t.Fatalf("expected privately cacheable QR code, got: %d %s", w.Code, w.Header().Get("Cache-Control"))
+	}
+	// Links are built from the base URL, not forwarded headers.
+	spoofed, _ := serve(t, r, http.MethodGet, path, "", "x-api-key", reader, "X-Forwarded-Proto", "javascript")
+	if etag := spoofed.Header().Get("ETag"); etag == "" || etag != w.Header().Get("ETag") {
+		t.Fatalf("expected the same QR code for a spoofed scheme, got: %s %s", etag, w.Header().Get("ETag"))
+	}
+}
+
+func TestSessionCampaignAccess(t *testing.T) {
+	store, campaign := newStore(t)
+	if _, err := store.RotateSigningKey(0); err != nil {
+		t.Fatalf("failed to create signing key: %+v", err)
+	}
+	keySet := auth.NewKeySet(store.GetSigningKeys)
+	authenticate := handler.NewAuthHandler(store, store, store, keySet).Authenticate
+	campaignHandler := handler.NewCampaignHandler(store, handler.NewLive(handler.Settings{}), handler.Paging{DefaultLimit: 10, MaxLimit: 1000})
+	qrHandler := handler.NewQRHandler(store, "https://ref.myapp.io")
+	r := gin.New()
+	r.GET("/campaigns", authenticate, campaignHandler.GetCampaigns)
+	r.GET("/campaigns/:id", authenticate, campaignHandler.GetCampaign)
+	r.GET("/campaigns/:id/qr.png", authenticate, qrHandler.GetPNG)
+	bearer := func(address string) string {
+		token, _, _, err := keySet.Sign(address, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to sign access token: %+v", err)
+		}
+		return "Bearer " + token
+	}
+	// Session owners can read their campaigns back without scopes.
+	owner := bearer(referer)
+	for _, path := range []string{"/campaigns?address=" + referer, fmt.Sprintf("/campaigns/%d", campaign.ID), fmt.Sprintf("/campaigns/%d/qr.png", campaign.ID)} {
+		if w, response := serve(t, r, http.MethodGet, path, "", "authorization", owner); w.Code != http.StatusOK {
+			t.Fatalf("expected owner to read %s, got: %d %+v", path, w.Code, response)
+		}
+	}
+	// Other sessions can't.
+	other := bearer(referee)
+	for _, path := range []string{"/campaigns?address=" + referer, fmt.Sprintf("/campaigns/%d", campaign.ID), fmt.Sprintf("/campaigns/%d/qr.png", campaign.ID)} {
+		if w, _ := serve(t, r, http.MethodGet, path, "", "authorization", other); w.Code != http.StatusForbidden {
+			t.Fatalf("expected other session to be forbidden from %s, got: %d", path, w.Code)
+		}
+	}
+	if w, _ := serve(t, r, http.MethodGet, fmt.Sprintf("/campaigns/%d", campaign.ID), ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated request to be rejected, got: %d", w.Code)
+	}
+}
+
+func TestIssueSessionWithoutSigningKeys(t *testing.T) {
+	store, _ := newStore(t)
+	options := handler.SessionOptions{ChallengeTTL: time.Minute, AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+	sessions := handler.NewSessionHandler(store, store, auth.NewKeySet(store.GetSigningKeys), options)
+	r := gin.New()
+	r.POST("/auth/refresh", sessions.RefreshSession)
+	token, _, err := store.CreateRefreshToken(referer, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %+v", err)
+	}
+	// Signing failures are server errors, without internal details.
+	w, response := serve(t, r, http.MethodPost, "/auth/refresh", `{"refreshToken":"`+token+`"}`)
+	if w.Code != http.StatusInternalServerError || response["detail"] != nil {
+		t.Fatalf("expected internal error without detail, got: %d %+v", w.Code, response)
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	store, _ := newStore(t)
+	options := domain.CampaignOptions{CampaignPreview: domain.CampaignPreview{Description: `Earn "more" & save`}}
+	campaign, err := store.CreateCampaign(referer, `<script>alert("x")</script>`, options)
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	redirect := handler.RedirectOptions{SignupURL: "https://myapp.io/signup", BaseURL: "https://ref.myapp.io"}
+	r := gin.New()
+	r.GET("/referrals/:id/signup", newRedirectHandler(t, store, handler.NewLive(handler.Settings{Redirect: redirect})).Signup)
+	path := fmt.Sprintf("/referrals/%d/signup", campaign.ID)
+	// Link preview crawlers get an escaped preview page linking to the configured base URL.
+	crawler := "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+	w, _ := serve(t, r, http.MethodGet, path, "", "User-Agent", crawler, "X-Forwarded-Proto", "javascript")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected preview page for crawler, got: %d %s", w.Code, body)
+	}
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;") {
+		t.Fatalf("expected escaped campaign name in preview page: %s", body)
+	}
+	if !strings.Contains(body, `content="Earn &#34;more&#34; &amp; save"`) {
+		t.Fatalf("expected escaped campaign description in preview page: %s", body)
+	}
+	if expected := fmt.Sprintf(`<meta property="og:url" content="https://ref.myapp.io/referrals/%d/signup">`, campaign.ID); !strings.Contains(body, expected) {
+		t.Fatalf("expected og:url on the base URL in preview page: %s", body)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("expected no cookies for crawler, got: %+v", cookies)
+	}
+	// Browsers are redirected.
+	browser := "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Safari/605.1.15"
+	if w, _ := serve(t, r, http.MethodGet, path, "", "User-Agent", browser); w.Code != http.StatusFound {
+		t.Fatalf("expected redirect for browser, got: %d", w.Code)
+	}
+}
+
+// A signup keeper whose exports fail after a number of full pages.
+type failingExports struct {
+	*memory.Store
+	pages int
+}
+
+func (self *failingExports) ExportSignups(
+	campaignID uint64, status string, cursor uint64, limit int) (uint64, []domain.SignupExport, error) {
+
+	if self.pages == 0 {
+		return 0, nil, domain.NewError(domain.ErrUnavailable, "database is locked")
+	}
+	self.pages--
+	return cursor + uint64(limit), make([]domain.SignupExport, limit), nil
+}
+
+func TestExportFailures(t *testing.T) {
+	store, _ := newStore(t)
+	exports := &failingExports{Store: store}
+	r := gin.New()
+	r.Use(handler.Recovery())
+	r.GET("/signups/export", handler.NewExportHandler(store, exports).ExportAllSignups)
+	// A failure before the export starts gets an error response.
+	w, _ := serve(t, r, http.MethodGet, "/signups/export", "")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != handler.ProblemContentType {
+		t.Fatalf("expected unavailable problem response, got: %d %s", w.Code, w.Body.String())
+	}
+	// A failure part way through aborts the connection, so the export isn't mistaken as complete.
+	exports.pages = 1
+	server := httptest.NewServer(r)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/signups/export?format=jsonl")
+	if err != nil {
+		t.Fatalf("failed to start export: %+v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || err == nil {
+		t.Fatalf("expected truncated export to fail, got: %d %v", resp.StatusCode, err)
+	}
+}
+
+func TestExportCSVFormulas(t *testing.T) {
+	store, _ := newStore(t)
+	campaign, err := store.CreateCampaign(referer, `=HYPERLINK("https://evil.example","x")`, domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	if _, err := store.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	r := gin.New()
+	r.GET("/signups/export", handler.NewExportHandler(store, store).ExportAllSignups)
+	w, _ := serve(t, r, http.MethodGet, "/signups/export", "")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if w.Code != http.StatusOK || err != nil || len(records) != 2 {
+		t.Fatalf("expected header and signup rows, got: %d %v %q", w.Code, err, records)
+	}
+	if name := records[1][2]; name != `'=HYPERLINK("https://evil.example","x")` {
+		t.Fatalf("expected campaign name formula to be escaped, got: %s", name)
+	}
+	if address := records[1][4]; address != referee {
+		t.Fatalf("expected address to be unchanged, got: %s", address)
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	settings := handler.NewLive(handler.Settings{Limits: map[string]ratelimit.Limit{"write": {Rate: 0.001, Burst: 1}}})
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("failed to set trusted proxies: %+v", err)
+	}
+	r.POST("/limited", handler.NewRateLimiter(ratelimit.NewMemoryStore(time.Minute), settings).Limit("write"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	// Spoofed X-Forwarded-For headers from untrusted peers don't get a fresh bucket.
+	for i, expected := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		w, _ := serve(t, r, http.MethodPost, "/limited", "", "X-Forwarded-For", fmt.Sprintf("10.0.0.%d", i))
+		if w.Code != expected {
+			t.Fatalf("expected %d for request %d, got: %d", expected, i, w.Code)
+		}
+	}
+}
+
+func TestRateLimitSignedAddresses(t *testing.T) {
+	store, _ := newStore(t)
+	settings := handler.NewLive(handler.Settings{Limits: map[string]ratelimit.Limit{"write": {Rate: 0.001, Burst: 1}}})
+	r := gin.New()
+	limit := handler.NewRateLimiter(ratelimit.NewMemoryStore(time.Minute), settings).Limit("write")
+	r.POST("/limited", newAuthHandler(store).Authenticate, limit, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	// Signing with a new key from the same IP doesn't get a fresh bucket.
+	for i, expected := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		privKey, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %+v", err)
+		}
+		headers := signRequest(t, privKey, http.MethodPost, "/limited", "", "", time.Now())
+		if w, _ := serve(t, r, http.MethodPost, "/limited", "", headers...); w.Code != expected {
+			t.Fatalf("expected %d for request %d, got: %d", expected, i, w.Code)
+		}
+	}
+}
+
+func TestRateLimitSignedRequests(t *testing.T) {
+	store, _ := newStore(t)
+	settings := handler.NewLive(handler.Settings{Limits: map[string]ratelimit.Limit{"signed": {Rate: 0.001, Burst: 1}}})
+	r := gin.New()
+	limit := handler.NewRateLimiter(ratelimit.NewMemoryStore(time.Minute), settings).LimitSigned("signed")
+	r.GET("/limited", limit, newAuthHandler(store).Authenticate, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	// Signed requests are limited before their signatures are verified and recorded.
+	privKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %+v", err)
+	}
+	for i, expected := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		headers := signRequest(t, privKey, http.MethodGet, "/limited", "", "", time.Now().Add(-time.Duration(i)*time.Second))
+		if w, _ := serve(t, r, http.MethodGet, "/limited", "", headers...); w.Code != expected {
+			t.Fatalf("expected %d for request %d, got: %d", expected, i, w.Code)
+		}
+	}
+	// Requests without signed headers aren't limited.
+	if w, _ := serve(t, r, http.MethodGet, "/limited", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected unsigned request to be allowed, got: %d", w.Code)
+	}
+}
+
+// A maintenance keeper without tasks or metrics.
+type noMaintenance struct{}
+
+func (noMaintenance) GetMaintenanceTasks() []domain.MaintenanceTask {
+	return []domain.MaintenanceTask{}
+}
+
+func (noMaintenance) RunMaintenanceTask(name string) (domain.MaintenanceTask, error) {
+	return domain.MaintenanceTask{}, domain.NewError(domain.ErrNotFound, "maintenance task not found: %s", name)
+}
+
+func (noMaintenance) GetMaintenanceMetrics() map[string]int64 {
+	return map[string]int64{}
+}
+
+func TestGetMetrics(t *testing.T) {
+	r := gin.New()
+	r.GET("/metrics", handler.NewMaintenanceHandler(noMaintenance{}).GetMetrics)
+	w, response := serve(t, r, http.MethodGet, "/metrics", "")
+	if _, ok := response["maintenance"]; w.Code != http.StatusOK || !ok || len(response) != 1 {
+		t.Fatalf("expected only maintenance metrics, got: %d %+v", w.Code, response)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/carp-cobain/referrals/importer"
+	"github.com/gin-gonic/gin"
+)
+
+// ImportHandler is the http api for bulk importing campaigns and signups
+type ImportHandler struct {
+	importer importer.Importer
+}
+
+// NewImportHandler creates a new bulk import handler
+func NewImportHandler(importer importer.Importer) ImportHandler {
+	return ImportHandler{importer}
+}
+
+// POST /import?format=csv|jsonl
+// Import streams campaigns and signups from the request body and reports errors by line.
+func (self ImportHandler) Import(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = importFormat(c.ContentType())
+	}
+	if format == "" {
+		badRequestJson(c, fmt.Errorf("format query param is required"))
+		return
+	}
+	report, err := self.importer.Import(c.Request.Body, format)
+	if err != nil {
+		errorJsonWith(c, http.StatusBadRequest, err, gin.H{"report": report})
+		return
+	}
+	okJson(c, gin.H{"report": report})
+}
+
+// Determine an import format from a request content type.
+func importFormat(contentType string) string {
+	switch {
+	case strings.HasSuffix(contentType, "/csv"):
+		return importer.FormatCSV
+	case strings.HasSuffix(contentType, "jsonl"), strings.HasSuffix(contentType, "ndjson"):
+		return importer.FormatJSONL
+	}
+	return ""
+}
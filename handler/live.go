@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"sync/atomic"
+
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/ratelimit"
+)
+
+// Settings is an immutable snapshot of the reloadable settings. Reloads swap in a whole new
+// snapshot, so handlers never see config, redirect options and rate limits out of step.
+type Settings struct {
+	Config   config.Config
+	Redirect RedirectOptions
+	Limits   map[string]ratelimit.Limit
+}
+
+// Live is a value that can be swapped at runtime, like reloaded config. Handlers load it
+// once per request so they always see a consistent snapshot.
+type Live[T any] struct {
+	value atomic.Pointer[T]
+}
+
+// NewLive creates a live value.
+func NewLive[T any](value T) *Live[T] {
+	live := &Live[T]{}
+	live.Store(value)
+	return live
+}
+
+// Load gets the current value.
+func (self *Live[T]) Load() T {
+	return *self.value.Load()
+}
+
+// Store swaps in a new value.
+func (self *Live[T]) Store(value T) {
+	self.value.Store(&value)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceHandler is the http/json api for database maintenance
+type MaintenanceHandler struct {
+	maintenanceKeeper keeper.MaintenanceKeeper
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(maintenanceKeeper keeper.MaintenanceKeeper) MaintenanceHandler {
+	return MaintenanceHandler{maintenanceKeeper}
+}
+
+// GET /maintenance
+// GetMaintenanceTasks gets the status of scheduled database maintenance tasks.
+func (self MaintenanceHandler) GetMaintenanceTasks(c *gin.Context) {
+	okJson(c, gin.H{"tasks": self.maintenanceKeeper.GetMaintenanceTasks()})
+}
+
+// POST /maintenance/:task/run
+// RunMaintenanceTask runs a database maintenance task now.
+func (self MaintenanceHandler) RunMaintenanceTask(c *gin.Context) {
+	name := c.Param("task")
+	if !self.hasTask(name) {
+		notFoundJson(c, fmt.Errorf("maintenance task not found: %s", name))
+		return
+	}
+	task, err := self.maintenanceKeeper.RunMaintenanceTask(name)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"task": task})
+}
+
+// GET /metrics
+// GetMetrics gets maintenance task counters. Only maintenance metrics are served; other
+// process details, like the command line, can contain secrets.
+func (self MaintenanceHandler) GetMetrics(c *gin.Context) {
+	okJson(c, gin.H{"maintenance": self.maintenanceKeeper.GetMaintenanceMetrics()})
+}
+
+// Check whether a maintenance task is scheduled.
+func (self MaintenanceHandler) hasTask(name string) bool {
+	for _, task := range self.maintenanceKeeper.GetMaintenanceTasks() {
+		if task.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Get the tracking params for a referral link click: campaign default UTM tags, overridden by
+// allowed query params on the click.
+func (self redirectRequest) clickParams(c *gin.Context, campaign domain.Campaign) domain.Params {
+	clicked := make(domain.Params)
+	for key, values := range c.Request.URL.Query() {
+		if key == TokenParam || len(values) == 0 || !self.allowParam(key) {
+			continue
+		}
+		if value := values[0]; value != "" && len(value) <= domain.MaxParamLength {
+			clicked[key] = value
+		}
+		if len(clicked) == domain.MaxParams {
+			break
+		}
+	}
+	return campaign.UTM.Merge(clicked)
+}
+
+// Check whether a query param is on the passthrough allowlist. Allowlist entries ending in
+// '*' match by prefix.
+func (self redirectRequest) allowParam(key string) bool {
+	for _, allowed := range self.options.PassthroughParams {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(key, prefix) {
+			return true
+		}
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the tracking params from a visitor's most recent click on a campaign.
+func (self redirectRequest) touchParams(visitorID string, campaignID uint64) (params domain.Params) {
+	if visitorID == "" {
+		return nil
+	}
+	since := time.Now().Add(-self.options.CookieMaxAge)
+	for _, touch := range self.touchKeeper.GetTouches(visitorID, since) {
+		if touch.CampaignID == campaignID {
+			params = touch.Params
+		}
+	}
+	return
+}
+
+// Add params to the query string of a URL, replacing any existing values.
+func withParams(rawURL string, params domain.Params) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		log.Printf("failed to parse redirect URL: %s", err.Error())
+		return rawURL
+	}
+	query := parsed.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewCrawlers are user agent fragments of link preview crawlers, which get a preview page
+// instead of a redirect.
+var PreviewCrawlers = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"linkedinbot",
+	"discordbot",
+	"whatsapp",
+	"telegrambot",
+	"pinterest",
+	"redditbot",
+	"skypeuripreview",
+	"applebot",
+	"embedly",
+}
+
+// DefaultPreviewTemplate renders Open Graph and Twitter card metadata for a campaign.
+var DefaultPreviewTemplate = template.Must(template.New("preview").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:url" content="{{.URL}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Image}}">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta name="twitter:title" content="{{.Title}}">
+{{- if .Description}}
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+</head>
+<body>
+<a href="{{.Destination}}">{{.Title}}</a>
+</body>
+</html>
+`))
+
+// PreviewData is the data available to preview templates.
+type PreviewData struct {
+	Title       string
+	Description string
+	Image       string
+	URL         string
+	Destination string
+}
+
+// Check whether a user agent is a link preview crawler.
+func isCrawler(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range PreviewCrawlers {
+		if strings.Contains(userAgent, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render a link preview page for a campaign.
+func (self redirectRequest) preview(c *gin.Context, campaign domain.Campaign, destination string) {
+	tmpl := self.options.Preview
+	if tmpl == nil {
+		tmpl = DefaultPreviewTemplate
+	}
+	data := PreviewData{
+		Title:       campaign.Name,
+		Description: campaign.Description,
+		Image:       campaign.ImageURL,
+		URL:         referralLink(self.options.BaseURL, campaign.ID),
+		Destination: destination,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		log.Printf("failed to render preview page: %s", err.Error())
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// RequestIDHeader tags requests and responses with an ID, so errors reported by clients can
+// be matched with server logs.
+const RequestIDHeader = "X-Request-ID"
+
+// Context keys for error responses
+const (
+	requestIDKey    = "requestID"
+	legacyErrorsKey = "legacyErrors"
+)
+
+// Error codes are stable identifiers for kinds of errors, which clients can use to show
+// localized messages. Details may change between releases; codes don't.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeAlreadyReferred  = "already_referred"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+)
+
+// Codes for specific domain errors, checked before the code for a response status.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{domain.ErrAlreadyReferred, CodeAlreadyReferred},
+	{domain.ErrValidation, CodeValidationFailed},
+}
+
+// Default codes for response statuses
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeBadRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusTooManyRequests:     CodeRateLimited,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+}
+
+// Request IDs accepted from clients
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// FieldError is a request field that failed validation. Codes are validation rules, like
+// required or max.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// requestError is a failed validation of a bound request, with the request type so problem
+// responses can report JSON field names. Its text is the validator's, which legacy clients see.
+type requestError struct {
+	validator.ValidationErrors
+	requestType reflect.Type
+}
+
+// Unwrap gets the validation errors.
+func (self requestError) Unwrap() error {
+	return self.ValidationErrors
+}
+
+// RequestID creates middleware that tags each request with the ID from its X-Request-ID
+// header, or a random ID, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			var err error
+			if requestID, err = auth.RandomToken(12); err != nil {
+				log.Printf("failed to create request ID: %s", err.Error())
+				c.Next()
+				return
+			}
+		}
+		c.Set(requestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// LegacyErrors creates middleware that sends errors in the pre problem+json
+// {"error": "..."} shape, for clients that haven't migrated yet.
+func LegacyErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(legacyErrorsKey, true)
+		c.Next()
+	}
+}
+
+// Create RFC 7807 problem details for an error response, extended with an error code, the
+// request ID and any request fields that failed validation. Server errors have no detail,
+// so internal errors aren't leaked to clients.
+func newProblem(c *gin.Context, status int, err error) gin.H {
+	problem := gin.H{
+		"type":     "about:blank",
+		"title":    http.StatusText(status),
+		"status":   status,
+		"instance": c.Request.URL.Path,
+		"code":     errorCode(status, err),
+	}
+	if status < http.StatusInternalServerError {
+		problem["detail"] = err.Error()
+	}
+	if requestID := c.GetString(requestIDKey); requestID != "" {
+		problem["requestId"] = requestID
+	}
+	if fields := fieldErrors(err); len(fields) > 0 {
+		problem["code"] = CodeValidationFailed
+		problem["detail"] = "request has invalid fields"
+		problem["errors"] = fields
+	}
+	return problem
+}
+
+// Get the code for an error response.
+func errorCode(status int, err error) string {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Get the request fields that failed validation or had the wrong JSON type. Fields of bound
+// requests are named by their JSON paths.
+func fieldErrors(err error) (fields []FieldError) {
+	var requestErr requestError
+	errors.As(err, &requestErr)
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, validationErr := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:  fieldPath(requestErr.requestType, validationErr.StructNamespace()),
+				Code:   validationErr.Tag(),
+				Detail: fieldDetail(validationErr),
+			})
+		}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		fields = append(fields, FieldError{
+			Field:  typeErr.Field,
+			Code:   "type",
+			Detail: fmt.Sprintf("must be a %s", typeErr.Type.String()),
+		})
+	}
+	return
+}
+
+// Describe a field validation failure.
+func fieldDetail(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "min", "max", "len":
+		if err.Kind() == reflect.String {
+			return fmt.Sprintf("must have %s length %s", err.Tag(), err.Param())
+		}
+		return fmt.Sprintf("must have %s %s", err.Tag(), err.Param())
+	}
+	if err.Param() != "" {
+		return fmt.Sprintf("must satisfy %s=%s", err.Tag(), err.Param())
+	}
+	return fmt.Sprintf("must satisfy %s", err.Tag())
+}
+
+// Get the JSON path of a field from its validation error namespace, like
+// CampaignRequest.DeepLink. The request type is dropped, and struct field names are replaced
+// with JSON names when the request type is known. Embedded structs without a JSON name are
+// flattened, like encoding/json does.
+func fieldPath(requestType reflect.Type, namespace string) string {
+	_, path, ok := strings.Cut(namespace, ".")
+	if !ok {
+		return namespace
+	}
+	if requestType == nil {
+		return path
+	}
+	var names []string
+	t := requestType
+	for _, segment := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		name, index, indexed := strings.Cut(segment, "[")
+		field, found := reflect.StructField{}, false
+		if t.Kind() == reflect.Struct {
+			field, found = t.FieldByName(name)
+		}
+		if !found {
+			return path
+		}
+		t = field.Type
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array ||
+			t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			continue
+		}
+		name = jsonFieldName(field)
+		if indexed {
+			name += "[" + index
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ".")
+}
+
+// Get the JSON name of a struct field.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
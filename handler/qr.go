@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/carp-cobain/referrals/qr"
+	"github.com/gin-gonic/gin"
+)
+
+// QRCacheMaxAge is the max age in seconds clients may cache QR code images
+var QRCacheMaxAge int = 24 * 60 * 60
+
+// QRHandler renders referral links as QR codes for print.
+type QRHandler struct {
+	campaignReader keeper.CampaignReader
+	baseURL        string
+}
+
+// NewQRHandler creates a new QR code handler. Referral links are built from the base URL.
+func NewQRHandler(campaignReader keeper.CampaignReader, baseURL string) QRHandler {
+	return QRHandler{campaignReader, baseURL}
+}
+
+// GET /campaigns/:id/qr.png
+// GetPNG renders a campaign referral link as a PNG QR code.
+func (self QRHandler) GetPNG(c *gin.Context) {
+	self.render(c, "image/png", qr.Code.PNG)
+}
+
+// GET /campaigns/:id/qr.svg
+// GetSVG renders a campaign referral link as an SVG QR code.
+func (self QRHandler) GetSVG(c *gin.Context) {
+	self.render(c, "image/svg+xml", qr.Code.SVG)
+}
+
+// Render a campaign referral link as a QR code with the size, margin and level query params.
+// Images are cached privately by clients, since the API is authenticated, and revalidated with
+// ETags. Callers can render their own campaigns, or any campaign with campaigns:read.
+func (self QRHandler) render(c *gin.Context, contentType string, encode func(qr.Code, io.Writer) error) {
+	campaignID, err := uintParam(c, "id")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	options, err := qrOptions(c)
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	campaign, err := self.campaignReader.GetCampaign(campaignID)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	if !authorizeCampaign(c, campaign, domain.ScopeCampaignsRead) {
+		return
+	}
+	link := referralLink(self.baseURL, campaign.ID)
+	etag := qrETag(contentType, link, options)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", QRCacheMaxAge))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	code, err := qr.Encode(link, options)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := encode(code, &buf); err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// Read QR code rendering options from query params, using defaults for missing params.
+func qrOptions(c *gin.Context) (qr.Options, error) {
+	options := qr.DefaultOptions
+	var err error
+	if size, ok := c.GetQuery("size"); ok {
+		if options.Size, err = strconv.Atoi(size); err != nil {
+			return options, fmt.Errorf("size: expected int, got: %s", size)
+		}
+	}
+	if margin, ok := c.GetQuery("margin"); ok {
+		if options.Margin, err = strconv.Atoi(margin); err != nil {
+			return options, fmt.Errorf("margin: expected int, got: %s", margin)
+		}
+	}
+	options.Level = c.DefaultQuery("level", options.Level)
+	return options.Validate()
+}
+
+// Compute an ETag for a rendered QR code.
+func qrETag(contentType, link string, options qr.Options) string {
+	key := fmt.Sprintf("%s|%s|%d|%d|%s", contentType, link, options.Size, options.Margin, options.Level)
+	hash := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(hash[:8]) + `"`
+}
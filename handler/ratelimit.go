@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/carp-cobain/referrals/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter limits request rates per caller using token buckets
+type RateLimiter struct {
+	store    ratelimit.Store
+	settings *Live[Settings]
+}
+
+// NewRateLimiter creates a new rate limiting middleware handler. Limits are looked up by
+// route group name on each request, so they can be reloaded.
+func NewRateLimiter(store ratelimit.Store, settings *Live[Settings]) RateLimiter {
+	return RateLimiter{store, settings}
+}
+
+// Limit creates middleware that rate limits a named route group per caller. Callers are
+// identified by API key, then client IP. Route groups without a limit aren't limited.
+func (self RateLimiter) Limit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := self.settings.Load().Limits[name]
+		if !ok {
+			c.Next()
+			return
+		}
+		key := fmt.Sprintf("%s:%s", name, rateLimitKey(c))
+		if ok, retryAfter := self.store.Allow(key, limit); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(1, seconds)))
+			errorJson(c, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitSigned creates middleware that rate limits requests with signed address headers by
+// client IP. It runs before authentication, since verifying a signature records its nonce.
+func (self RateLimiter) LimitSigned(name string) gin.HandlerFunc {
+	limit := self.Limit(name)
+	return func(c *gin.Context) {
+		if c.GetHeader("x-account-signature") == "" {
+			c.Next()
+			return
+		}
+		limit(c)
+	}
+}
+
+// Get the key identifying a caller for rate limiting. Addresses from sessions and signed
+// requests aren't used, since anyone can create new addresses to get fresh buckets.
+func rateLimitKey(c *gin.Context) string {
+	if principal, ok := getPrincipal(c); ok && principal.KeyID > 0 {
+		return fmt.Sprintf("key:%d", principal.KeyID)
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -2,11 +2,15 @@ package handler
 
 import (
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
+	"time"
 
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/bot"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/fraud"
 	"github.com/carp-cobain/referrals/keeper"
 	"github.com/gin-gonic/gin"
 )
@@ -14,45 +18,140 @@ import (
 // CookieName is the name for referral campaign cookies
 var CookieName string = "_referral_campaign"
 
-// MaxAge is the max age for referral campaign cookies
-var MaxAge int = 30 * 24 * 60 * 60
+// VisitorCookieName is the name for cookies identifying visitors across referral clicks
+var VisitorCookieName string = "_referral_visitor"
 
 // RedirectHandler is the http/json api for managing referral campaigns
 type RedirectHandler struct {
 	campaignReader keeper.CampaignReader
 	signupKeeper   keeper.SignupKeeper
+	touchKeeper    keeper.TouchKeeper
+	hits           *bot.HitCounter
+	scorer         fraud.Scorer
+	settings       *Live[Settings]
 }
 
-// NewRedirectHandler creates a new referral campaign handler
+// redirectRequest is a redirect handler bound to the options current when a request started,
+// so a reload can't change them part way through the request.
+type redirectRequest struct {
+	RedirectHandler
+	options RedirectOptions
+}
+
+// RedirectOptions are deployment settings for referral redirects.
+type RedirectOptions struct {
+	// SignupURL is where referral links send visitors for campaigns without a destination.
+	SignupURL string
+	// CookiePath is the path of referral campaign cookies.
+	CookiePath string
+	// CookieDomain is the domain of referral campaign cookies.
+	CookieDomain string
+	// CookieMaxAge is how long referral cookies and recorded clicks count for attribution.
+	CookieMaxAge time.Duration
+	// Attribution is the default attribution mode for campaigns that don't set their own.
+	Attribution string
+	// Tokens signs referral tokens for cookie-less attribution. Disabled when nil.
+	Tokens *auth.ReferralTokens
+	// PassthroughParams are the query params passed from referral links to the signup URL.
+	PassthroughParams []string
+	// Allowlist are the hosts visitors may be redirected to after a referral signup.
+	Allowlist domain.RedirectAllowlist
+	// DeepLinkSchemes are the app URL schemes campaign deep links may use.
+	DeepLinkSchemes []string
+	// BaseURL is the public URL of referral links.
+	BaseURL string
+	// Preview renders link previews for crawlers. DefaultPreviewTemplate is used when nil.
+	Preview *template.Template
+	// Bots classifies bot requests, which aren't recorded as clicks or signups.
+	Bots bot.Classifier
+}
+
+// NewRedirectHandler creates a new referral campaign handler. Filtered bot hits are counted
+// with the hit counter. Redirect options are reloadable; each request works with the options
+// current when it started.
 func NewRedirectHandler(
-	campaignReader keeper.CampaignReader, signupKeeper keeper.SignupKeeper) RedirectHandler {
-	return RedirectHandler{campaignReader, signupKeeper}
+	campaignReader keeper.CampaignReader,
+	signupKeeper keeper.SignupKeeper,
+	touchKeeper keeper.TouchKeeper,
+	hits *bot.HitCounter,
+	scorer fraud.Scorer,
+	settings *Live[Settings],
+) RedirectHandler {
+	return RedirectHandler{campaignReader, signupKeeper, touchKeeper, hits, scorer, settings}
+}
+
+// Bind the handler to the current redirect options for a request.
+func (self RedirectHandler) bind() redirectRequest {
+	return redirectRequest{self, self.settings.Load().Redirect}
 }
 
 // GET /referrals/:id/signup
-// Signup drops a cookie and redirects the requestor to a signup URL.
+// Signup records a click, drops a cookie and redirects the requestor to the campaign
+// destination, or the signup URL when the campaign doesn't have one. Mobile visitors are
+// routed to platform destinations or the campaign deep link when set. Allowed tracking params
+// and campaign UTM tags are passed along to the destination. When referral tokens are enabled,
+// a signed token is also passed along for clients that drop cookies. Link preview crawlers get
+// a page with campaign metadata instead, and other bots are redirected without a cookie.
+// Neither is recorded as a click, but both are counted as filtered hits on the campaign.
 func (self RedirectHandler) Signup(c *gin.Context) {
-	signupURL, path, domain := lookupSignupEnv()
+	self.bind().signup(c)
+}
+
+// Handle a referral link click with bound options.
+func (self redirectRequest) signup(c *gin.Context) {
+	signupURL, path, domain := self.options.SignupURL, self.options.CookiePath, self.options.CookieDomain
 	campaignID, err := uintParam(c, "id")
 	if err != nil {
 		c.Redirect(http.StatusFound, signupURL)
 		return
 	}
-	if campaign, err := self.campaignReader.GetCampaign(campaignID); err == nil {
+	campaign, err := self.campaignReader.GetCampaign(campaignID)
+	if err != nil {
+		c.Redirect(http.StatusFound, signupURL)
+		return
+	}
+	if isCrawler(c.Request.UserAgent()) {
+		self.filterHit(campaign.ID, bot.ReasonUserAgent)
+		self.preview(c, campaign, destination(c, campaign, signupURL))
+		return
+	}
+	if reason, ok := self.options.Bots.Classify(c.Request); ok {
+		self.filterHit(campaign.ID, reason)
+		c.Redirect(http.StatusFound, withParams(destination(c, campaign, signupURL), campaign.UTM))
+		return
+	}
+	params := self.clickParams(c, campaign)
+	visitorID := self.recordTouch(c, campaign.ID, params, path, domain)
+	if !self.keepCookie(c, campaign) {
 		value := fmt.Sprintf("%d", campaign.ID)
-		c.SetCookie(CookieName, value, MaxAge, path, domain, false, false)
+		c.SetCookie(CookieName, value, self.cookieMaxAge(), path, domain, false, false)
+	}
+	target := withParams(destination(c, campaign, signupURL), params)
+	deepLink := ""
+	if campaign.DeepLink != "" {
+		deepLink = self.tokenURL(withParams(campaign.DeepLink, params), campaign.ID, visitorID)
 	}
-	c.Redirect(http.StatusFound, signupURL)
+	redirect(c, deepLink, self.tokenURL(target, campaign.ID, visitorID))
 }
 
 // GET /referrals
-// Referrals records referrals from campaign cookie and redirects to a provided URL.
+// Referrals records referrals from a signed referral token or campaign cookie and redirects
+// to a provided URL.
 func (self RedirectHandler) Referrals(c *gin.Context) {
-	// Check for a redirect URL in query params. Use signup url if not provided.
-	signup, _, _ := lookupSignupEnv()
+	self.bind().referrals(c)
+}
+
+// Handle a referral conversion with bound options.
+func (self redirectRequest) referrals(c *gin.Context) {
+	// Check for a redirect URL in query params. Use signup url if not provided or if it isn't
+	// on the redirect allowlist.
 	url := c.Query("url")
+	if url != "" && !self.options.Allowlist.Allows(url) {
+		log.Printf("redirect URL not allowed: %s", url)
+		url = ""
+	}
 	if url == "" {
-		url = signup
+		url = self.options.SignupURL
 	}
 	// Assume a redirect here from signup complete, so try and pull blockchain address.
 	// If not found, redirect
@@ -62,47 +161,23 @@ func (self RedirectHandler) Referrals(c *gin.Context) {
 		c.Redirect(http.StatusFound, url)
 		return
 	}
-	// Check for cookie, redirect if not found.
-	cookie, err := c.Cookie(CookieName)
-	if err == http.ErrNoCookie {
-		log.Printf("no cookie; redirecting to: %s", url)
+	// Don't record signups for bots
+	if reason, ok := self.options.Bots.Classify(c.Request); ok {
+		log.Printf("filtered bot signup (%s); redirecting to: %s", reason, url)
 		c.Redirect(http.StatusFound, url)
 		return
 	}
-	// Get campaign from cookie
-	campaignID, err := strconv.ParseUint(cookie, 10, 64)
+	// Pick the campaign to credit from a referral token, recorded clicks or the campaign cookie,
+	// redirect if not found.
+	campaign, meta, err := self.referral(c)
 	if err != nil {
-		log.Printf("failed to parse referral campaign cookie ID: %s", err.Error())
+		log.Printf("%s; redirecting to: %s", err.Error(), url)
 		c.Redirect(http.StatusFound, url)
 		return
 	}
-	campaign, err := self.campaignReader.GetCampaign(campaignID)
-	if err != nil {
-		log.Printf("failed to get referral campaign %d: %s", campaignID, err.Error())
-		c.Redirect(http.StatusFound, url)
-		return
-	}
-	// Store referral signup
-	if _, err := self.signupKeeper.CreateSignup(campaign.ID, address); err != nil {
+	if _, err := self.createSignup(c, campaign, address, meta); err != nil {
 		log.Printf("failed to record signup referral: %s", err.Error())
 	}
 	// Send user on their way
 	c.Redirect(http.StatusFound, url)
 }
-
-// Lookup signup redirect info from env var
-func lookupSignupEnv() (string, string, string) {
-	url, ok := os.LookupEnv("SIGNUP_URL")
-	if !ok {
-		log.Panicf("SIGNUP_URL not defined")
-	}
-	path, ok := os.LookupEnv("SIGNUP_COOKIE_PATH")
-	if !ok {
-		log.Panicf("SIGNUP_COOKIE_PATH not defined")
-	}
-	domain, ok := os.LookupEnv("SIGNUP_COOKIE_DOMAIN")
-	if !ok {
-		log.Panicf("SIGNUP_COOKIE_DOMAIN not defined")
-	}
-	return url, path, domain
-}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 )
 
 // Read an unsigned integer parameter with the given key
@@ -17,23 +21,55 @@ func uintParam(c *gin.Context, key string) (uint64, error) {
 	return i, nil
 }
 
+// Bind a JSON request body, keeping the request type on validation errors for problem responses.
+func bindJSON(c *gin.Context, request any) error {
+	err := c.ShouldBindJSON(request)
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return requestError{validationErrs, reflect.TypeOf(request)}
+	}
+	return err
+}
+
+// Paging bounds the page sizes list requests can ask for.
+type Paging struct {
+	// DefaultLimit is the page size used when a request doesn't have a valid limit.
+	DefaultLimit int
+	// MaxLimit is the largest page size a request can ask for.
+	MaxLimit int
+}
+
 // Get and return bounded query parameters for paging.
 // If no query params are found, default values are returned.
-func getPageParams(c *gin.Context) (uint64, int) {
-	cursor, limit := uint64(0), 10
+func (self Paging) params(c *gin.Context) (uint64, int) {
+	cursor, limit := uint64(0), self.DefaultLimit
 	if cursorQuery, ok := c.GetQuery("cursor"); ok {
 		cursor, _ = strconv.ParseUint(cursorQuery, 10, 64)
 	}
 	if limitQuery, ok := c.GetQuery("limit"); ok {
 		limit, _ = strconv.Atoi(limitQuery)
 	}
-	return cursor, clamp(limit)
+	return cursor, self.clamp(limit)
 }
 
-// Ensure limit is between 10 and 1000
-func clamp(limit int) int {
-	if limit >= 10 && limit <= 1000 {
+// Ensure limit is between the default and max page limits
+func (self Paging) clamp(limit int) int {
+	if limit >= self.DefaultLimit && limit <= self.MaxLimit {
 		return limit
 	}
-	return 10
+	return self.DefaultLimit
+}
+
+// Return a value, or a default value if it's empty
+func defaultString(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Build the canonical referral link for a campaign from the configured base URL. Request
+// hosts and forwarded headers are never used, since any client can set them.
+func referralLink(baseURL string, campaignID uint64) string {
+	return fmt.Sprintf("%s/referrals/%d/signup", strings.TrimSuffix(baseURL, "/"), campaignID)
 }
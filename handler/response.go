@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
 	"net/http"
+	"runtime/debug"
 
+	"github.com/carp-cobain/referrals/domain"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,9 +22,21 @@ func createdJson(c *gin.Context, body gin.H) {
 	c.JSON(http.StatusCreated, body)
 }
 
-// Sends an error JSON response.
+// Sends an error response as RFC 7807 problem details, or as {"error": "..."} JSON for
+// legacy clients.
 func errorJson(c *gin.Context, status int, err error) {
-	c.JSON(status, gin.H{"error": err.Error()})
+	errorJsonWith(c, status, err, nil)
+}
+
+// Sends an error response with extra members, like an import report.
+func errorJsonWith(c *gin.Context, status int, err error, extra gin.H) {
+	body := gin.H{"error": err.Error()}
+	if !c.GetBool(legacyErrorsKey) {
+		body = newProblem(c, status, err)
+		c.Header("Content-Type", ProblemContentType)
+	}
+	maps.Copy(body, extra)
+	c.JSON(status, body)
 }
 
 // Sends a 400 error JSON response.
@@ -30,3 +48,61 @@ func badRequestJson(c *gin.Context, err error) {
 func notFoundJson(c *gin.Context, err error) {
 	errorJson(c, http.StatusNotFound, err)
 }
+
+// Sends a 401 error JSON response, unless credentials couldn't be checked because of an outage.
+func unauthorizedJson(c *gin.Context, err error) {
+	if errors.Is(err, domain.ErrUnavailable) {
+		domainErrorJson(c, err)
+		return
+	}
+	errorJson(c, http.StatusUnauthorized, err)
+}
+
+// Sends a 403 error JSON response.
+func forbiddenJson(c *gin.Context, err error) {
+	errorJson(c, http.StatusForbidden, err)
+}
+
+// Sends an error JSON response with a status for the kind of a domain error. Server errors
+// are logged and reported without details, so internal errors aren't leaked to clients.
+func domainErrorJson(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed (request %s): %s",
+			c.Request.Method, c.FullPath(), c.GetString(requestIDKey), err.Error())
+		err = fmt.Errorf("%s", http.StatusText(status))
+	}
+	errorJson(c, status, err)
+}
+
+// Get the HTTP status for the kind of a domain error. Errors without a kind are internal.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Recovery creates middleware that recovers from handler panics with a 500 response, logging
+// them. http.ErrAbortHandler is re-panicked so the server closes the connection of a handler
+// that aborted after its response started.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+		log.Printf("%s %s panicked (request %s): %v\n%s",
+			c.Request.Method, c.FullPath(), c.GetString(requestIDKey), err, debug.Stack())
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
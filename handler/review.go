@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewHandler is the http/json api for manually reviewing flagged signups
+type ReviewHandler struct {
+	reviewKeeper keeper.ReviewKeeper
+	touchKeeper  keeper.TouchKeeper
+	settings     *Live[Settings]
+	paging       Paging
+}
+
+// NewReviewHandler creates a new signup review handler. Signup touches are looked up within
+// the current referral cookie max age.
+func NewReviewHandler(
+	reviewKeeper keeper.ReviewKeeper, touchKeeper keeper.TouchKeeper, settings *Live[Settings], paging Paging) ReviewHandler {
+
+	return ReviewHandler{reviewKeeper, touchKeeper, settings, paging}
+}
+
+// GET /review/signups
+// GetReviewQueue gets a page of flagged signups available to the reviewer, highest risk first
+func (self ReviewHandler) GetReviewQueue(c *gin.Context) {
+	principal, _ := getPrincipal(c)
+	cursor, limit := self.paging.params(c)
+	next, signups := self.reviewKeeper.GetReviewQueue(principal.Actor(), cursor, limit)
+	okJson(c, gin.H{"cursor": next, "signups": signups})
+}
+
+// POST /review/signups/:sid/claim
+// ClaimSignup claims a flagged signup, so other reviewers skip it
+func (self ReviewHandler) ClaimSignup(c *gin.Context) {
+	self.review(c, self.reviewKeeper.ClaimSignup)
+}
+
+// DELETE /review/signups/:sid/claim
+// UnclaimSignup releases a claim on a flagged signup
+func (self ReviewHandler) UnclaimSignup(c *gin.Context) {
+	self.review(c, self.reviewKeeper.UnclaimSignup)
+}
+
+// POST /review/signups/:sid/approve
+// ApproveSignup verifies a claimed flagged signup
+func (self ReviewHandler) ApproveSignup(c *gin.Context) {
+	self.review(c, func(signupID uint64, reviewer string) (domain.Signup, error) {
+		return self.reviewKeeper.ReviewSignup(signupID, reviewer, domain.SignupVerified)
+	})
+}
+
+// POST /review/signups/:sid/reject
+// RejectSignup rejects a claimed flagged signup
+func (self ReviewHandler) RejectSignup(c *gin.Context) {
+	self.review(c, func(signupID uint64, reviewer string) (domain.Signup, error) {
+		return self.reviewKeeper.ReviewSignup(signupID, reviewer, domain.SignupRejected)
+	})
+}
+
+// GET /review/signups/:sid/history
+// GetSignupHistory gets the status history of a signup
+func (self ReviewHandler) GetSignupHistory(c *gin.Context) {
+	signupID, err := uintParam(c, "sid")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"history": self.reviewKeeper.GetSignupHistory(signupID)})
+}
+
+// GET /review/signups/:sid/touches
+// GetSignupTouches gets the referral link clicks that led to a signup, to resolve attribution disputes
+func (self ReviewHandler) GetSignupTouches(c *gin.Context) {
+	signupID, err := uintParam(c, "sid")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	signup, err := self.reviewKeeper.GetSignup(signupID)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	touches := []domain.Touch{}
+	if signup.VisitorID != "" {
+		since := signup.CreatedAt.Add(-self.settings.Load().Redirect.CookieMaxAge)
+		for _, touch := range self.touchKeeper.GetTouches(signup.VisitorID, since) {
+			if !touch.CreatedAt.After(signup.CreatedAt) {
+				touches = append(touches, touch)
+			}
+		}
+	}
+	okJson(c, gin.H{"signup": signup, "touches": touches})
+}
+
+// Apply a review action to a signup as the authenticated reviewer.
+func (self ReviewHandler) review(
+	c *gin.Context, action func(signupID uint64, reviewer string) (domain.Signup, error)) {
+
+	signupID, err := uintParam(c, "sid")
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	principal, _ := getPrincipal(c)
+	signup, err := action(signupID, principal.Actor())
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"signup": signup})
+}
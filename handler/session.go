@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionOptions are the lifetimes of sign in challenges and session tokens.
+type SessionOptions struct {
+	// ChallengeTTL is how long an address has to sign a sign in challenge.
+	ChallengeTTL time.Duration
+	// AccessTokenTTL is the lifetime of session access tokens.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of session refresh tokens.
+	RefreshTokenTTL time.Duration
+}
+
+// SessionHandler is the http/json api for wallet signature sessions
+type SessionHandler struct {
+	sessionKeeper    keeper.SessionKeeper
+	signingKeyKeeper keeper.SigningKeyKeeper
+	keySet           *auth.KeySet
+	options          SessionOptions
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(
+	sessionKeeper keeper.SessionKeeper,
+	signingKeyKeeper keeper.SigningKeyKeeper,
+	keySet *auth.KeySet,
+	options SessionOptions,
+) SessionHandler {
+	return SessionHandler{sessionKeeper, signingKeyKeeper, keySet, options}
+}
+
+// POST /auth/challenge
+// CreateChallenge creates a one time message for an address to sign
+func (self SessionHandler) CreateChallenge(c *gin.Context) {
+	var request ChallengeRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	address, err := domain.ValidateAddress(request.Address)
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	challenge, err := self.sessionKeeper.CreateChallenge(address, self.options.ChallengeTTL)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	createdJson(c, gin.H{"challenge": challenge})
+}
+
+// POST /auth/token
+// CreateSession exchanges a signed challenge for an access token and refresh token
+func (self SessionHandler) CreateSession(c *gin.Context) {
+	var request TokenRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	address, err := domain.ValidateAddress(request.Address)
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	challenge, err := self.sessionKeeper.UseChallenge(request.Nonce, address)
+	if err != nil {
+		unauthorizedJson(c, err)
+		return
+	}
+	message := []byte(challenge.Message)
+	if err := auth.VerifySignature(address, request.PubKey, request.Signature, message); err != nil {
+		unauthorizedJson(c, err)
+		return
+	}
+	self.issueSession(c, address)
+}
+
+// POST /auth/refresh
+// RefreshSession rotates a refresh token and issues a new access token
+func (self SessionHandler) RefreshSession(c *gin.Context) {
+	var request RefreshRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	address, err := self.sessionKeeper.RotateRefreshToken(request.RefreshToken)
+	if errors.Is(err, domain.ErrUnavailable) {
+		domainErrorJson(c, err)
+		return
+	}
+	if err != nil {
+		unauthorizedJson(c, err)
+		return
+	}
+	self.issueSession(c, address)
+}
+
+// POST /auth/revoke
+// RevokeSession revokes the caller's access token and optionally a refresh token
+func (self SessionHandler) RevokeSession(c *gin.Context) {
+	principal, ok := getPrincipal(c)
+	if !ok || principal.TokenID == "" {
+		unauthorizedJson(c, fmt.Errorf("session access token required"))
+		return
+	}
+	var request RevokeRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	if request.RefreshToken != "" {
+		if err := self.sessionKeeper.RevokeRefreshToken(principal.Address, request.RefreshToken); err != nil {
+			domainErrorJson(c, err)
+			return
+		}
+	}
+	if err := self.sessionKeeper.RevokeAccessToken(principal.TokenID, principal.TokenExpiresAt); err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"revoked": true})
+}
+
+// POST /auth/keys/rotate
+// RotateSigningKey creates a new access token signing key. Previous keys keep
+// verifying tokens until those tokens expire.
+func (self SessionHandler) RotateSigningKey(c *gin.Context) {
+	key, err := self.signingKeyKeeper.RotateSigningKey(self.options.AccessTokenTTL)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	self.keySet.Reload()
+	okJson(c, gin.H{"kid": key.ID})
+}
+
+// GET /.well-known/jwks.json
+// GetJWKS gets the public keys used to verify access tokens
+func (self SessionHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, self.keySet.JWKS())
+}
+
+// Issue an access token and refresh token for an address
+func (self SessionHandler) issueSession(c *gin.Context, address string) {
+	accessToken, _, expiresAt, err := self.keySet.Sign(address, self.options.AccessTokenTTL)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	refreshToken, refreshExpiresAt, err := self.sessionKeeper.CreateRefreshToken(address, self.options.RefreshTokenTTL)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	okJson(c, gin.H{"session": domain.Session{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}})
+}
+
+// ChallengeRequest is the request type for creating sign in challenges.
+type ChallengeRequest struct {
+	Address string `json:"address" binding:"required,min=41,max=61"`
+}
+
+// TokenRequest is the request type for exchanging a signed challenge for a session.
+type TokenRequest struct {
+	Address   string `json:"address" binding:"required,min=41,max=61"`
+	Nonce     string `json:"nonce" binding:"required"`
+	PubKey    string `json:"pubKey" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+// RefreshRequest is the request type for refreshing sessions.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// RevokeRequest is the request type for revoking sessions.
+type RevokeRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
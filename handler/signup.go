@@ -2,8 +2,9 @@ package handler
 
 import (
 	"fmt"
-	"strings"
 
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/fraud"
 	"github.com/carp-cobain/referrals/keeper"
 	"github.com/gin-gonic/gin"
 )
@@ -12,29 +13,42 @@ import (
 type SignupHandler struct {
 	campaignReader keeper.CampaignReader
 	signupKeeper   keeper.SignupKeeper
+	scorer         fraud.Scorer
+	paging         Paging
 }
 
 // NewSignupHandler creates a new referral campaign handler
 func NewSignupHandler(
-	campaignReader keeper.CampaignReader, signupKeeper keeper.SignupKeeper) SignupHandler {
+	campaignReader keeper.CampaignReader, signupKeeper keeper.SignupKeeper, scorer fraud.Scorer, paging Paging) SignupHandler {
 
-	return SignupHandler{campaignReader, signupKeeper}
+	return SignupHandler{campaignReader, signupKeeper, scorer, paging}
 }
 
 // GET /campaigns/:id/signups
-// GetSignups gets a page of signups for a referral campaign
+// GetSignups gets a page of signups for a referral campaign. Only the campaign owner
+// sees full addresses; unauthenticated callers get a redacted view.
 func (self SignupHandler) GetSignups(c *gin.Context) {
 	campaignID, err := uintParam(c, "id")
 	if err != nil {
 		badRequestJson(c, err)
 		return
 	}
-	if _, err := self.campaignReader.GetCampaign(campaignID); err != nil {
-		notFoundJson(c, err)
+	campaign, err := self.campaignReader.GetCampaign(campaignID)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	_, authenticated := getPrincipal(c)
+	if authenticated && !authorizeCampaign(c, campaign, domain.ScopeAdmin) {
 		return
 	}
-	cursor, limit := getPageParams(c)
+	cursor, limit := self.paging.params(c)
 	next, signups := self.signupKeeper.GetSignups(campaignID, cursor, limit)
+	if !authenticated {
+		for i, signup := range signups {
+			signups[i] = signup.Redact()
+		}
+	}
 	okJson(c, gin.H{"cursor": next, "signups": signups})
 }
 
@@ -47,7 +61,7 @@ func (self SignupHandler) CreateSignup(c *gin.Context) {
 		return
 	}
 	var request SignupRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
+	if err := bindJSON(c, &request); err != nil {
 		badRequestJson(c, err)
 		return
 	}
@@ -56,13 +70,26 @@ func (self SignupHandler) CreateSignup(c *gin.Context) {
 		badRequestJson(c, err)
 		return
 	}
+	principal, _ := getPrincipal(c)
+	forwarded := request.IP != "" || request.UserAgent != ""
+	if forwarded && !principal.HasScope(domain.ScopeSignupsForward) {
+		forbiddenJson(c, fmt.Errorf("forwarding ip and userAgent requires the %s scope", domain.ScopeSignupsForward))
+		return
+	}
 	if _, err := self.campaignReader.GetCampaign(campaignID); err != nil {
-		notFoundJson(c, err)
+		domainErrorJson(c, err)
 		return
 	}
-	signup, err := self.signupKeeper.CreateSignup(campaignID, address)
+	risk := self.scorer.Score(fraud.Signals{
+		CampaignID: campaignID,
+		Address:    address,
+		IP:         defaultString(request.IP, c.ClientIP()),
+		UserAgent:  defaultString(request.UserAgent, c.Request.UserAgent()),
+	})
+	meta := domain.SignupMeta{Risk: risk, VisitorID: request.VisitorID, Params: request.Params}
+	signup, err := self.signupKeeper.CreateSignup(campaignID, address, meta)
 	if err != nil {
-		badRequestJson(c, err)
+		domainErrorJson(c, err)
 		return
 	}
 	okJson(c, gin.H{"signup": signup})
@@ -82,7 +109,7 @@ func (self SignupHandler) UpdateSignup(c *gin.Context) {
 		return
 	}
 	var request UpdateSignupRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
+	if err := bindJSON(c, &request); err != nil {
 		badRequestJson(c, err)
 		return
 	}
@@ -92,35 +119,35 @@ func (self SignupHandler) UpdateSignup(c *gin.Context) {
 		return
 	}
 	if _, err := self.campaignReader.GetCampaign(campaignID); err != nil {
-		notFoundJson(c, err)
+		domainErrorJson(c, err)
 		return
 	}
-	signup, err := self.signupKeeper.UpdateSignup(campaignID, signupID, status)
+	principal, _ := getPrincipal(c)
+	signup, err := self.signupKeeper.UpdateSignup(campaignID, signupID, status, principal.Actor())
 	if err != nil {
-		badRequestJson(c, err)
+		domainErrorJson(c, err)
 		return
 	}
 	okJson(c, gin.H{"signup": signup})
 }
 
-// SignupRequest is the request type for consuming referral campaigns.
+// SignupRequest is the request type for consuming referral campaigns. Servers creating
+// signups on behalf of users should forward the user's IP and user agent for fraud scoring,
+// which needs the signups:forward scope.
 type SignupRequest struct {
-	Address string `json:"address" binding:"required,min=41,max=61"`
+	Address   string        `json:"address" binding:"required,min=41,max=61"`
+	IP        string        `json:"ip" binding:"omitempty,ip"`
+	UserAgent string        `json:"userAgent" binding:"max=512"`
+	VisitorID string        `json:"visitorId" binding:"max=64"`
+	Params    domain.Params `json:"params"`
 }
 
 // Validate signup request fields
 func (self SignupRequest) Validate() (string, error) {
-	address := strings.TrimSpace(self.Address)
-	if address == "" {
-		return "", fmt.Errorf("address cannot be blank")
-	}
-	if strings.ToLower(address) != address {
-		return "", fmt.Errorf("address must be all lower case")
+	if _, err := domain.ValidateParams(self.Params); err != nil {
+		return "", err
 	}
-	if !strings.HasPrefix(address, "tp") {
-		return "", fmt.Errorf("address must have prefix: tp")
-	}
-	return address, nil
+	return domain.ValidateAddress(self.Address)
 }
 
 // UpdateSignupRequest is the request type for updating signup status.
@@ -128,14 +155,7 @@ type UpdateSignupRequest struct {
 	Status string `json:"status" binding:"required"`
 }
 
-// Validate ensures a signup status is a valid variant.
+// Validate ensures a signup status is a valid variant clients can set.
 func (self UpdateSignupRequest) Validate() (string, error) {
-	status := strings.ToLower(strings.TrimSpace(self.Status))
-	if status == "" {
-		return "", fmt.Errorf("invalid status: empty string")
-	}
-	if status != "verified" && status != "pending" {
-		return "", fmt.Errorf("invalid status variant: %s", status)
-	}
-	return status, nil
+	return domain.ValidateSignupUpdate(self.Status)
 }
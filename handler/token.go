@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/fraud"
+	"github.com/gin-gonic/gin"
+)
+
+// TokenParam is the query parameter carrying signed referral tokens
+var TokenParam string = "ref"
+
+// POST /referrals/claim
+// Claim records a signup from a signed referral token. This is for clients that can't keep
+// cookies, like mobile apps and cross domain flows, which pass the token along instead.
+func (self RedirectHandler) Claim(c *gin.Context) {
+	self.bind().claim(c)
+}
+
+// Handle a referral token claim with bound options.
+func (self redirectRequest) claim(c *gin.Context) {
+	if self.options.Tokens == nil {
+		notFoundJson(c, fmt.Errorf("referral tokens are not enabled"))
+		return
+	}
+	var request ClaimRequest
+	if err := bindJSON(c, &request); err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	address, err := request.Validate()
+	if err != nil {
+		badRequestJson(c, err)
+		return
+	}
+	campaign, meta, err := self.claimToken(request.Token)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	signup, err := self.createSignup(c, campaign, address, meta)
+	if err != nil {
+		domainErrorJson(c, err)
+		return
+	}
+	createdJson(c, gin.H{"signup": signup})
+}
+
+// Add a signed referral token to a signup URL, when referral tokens are enabled.
+func (self redirectRequest) tokenURL(signupURL string, campaignID uint64, visitorID string) string {
+	if self.options.Tokens == nil {
+		return signupURL
+	}
+	token, err := self.options.Tokens.Sign(campaignID, visitorID)
+	if err != nil {
+		log.Printf("failed to sign referral token: %s", err.Error())
+		return signupURL
+	}
+	return withParams(signupURL, domain.Params{TokenParam: token})
+}
+
+// Verify a signed referral token, returning the referred campaign and signup metadata with
+// the visitor that clicked the referral link and the token nonce. The nonce is consumed when
+// the signup is created.
+func (self redirectRequest) claimToken(token string) (domain.Campaign, domain.SignupMeta, error) {
+	if self.options.Tokens == nil {
+		return domain.Campaign{}, domain.SignupMeta{}, fmt.Errorf("referral tokens are not enabled")
+	}
+	referral, err := self.options.Tokens.Verify(token)
+	if err != nil {
+		return domain.Campaign{}, domain.SignupMeta{}, domain.WrapError(domain.ErrValidation, err, "invalid referral token")
+	}
+	campaign, err := self.campaignReader.GetCampaign(referral.CampaignID)
+	if err != nil {
+		return domain.Campaign{}, domain.SignupMeta{}, fmt.Errorf("failed to get referral campaign %d: %w", referral.CampaignID, err)
+	}
+	meta := domain.SignupMeta{
+		VisitorID: referral.VisitorID,
+		Nonce:     &domain.Nonce{Value: referral.Nonce, ExpiresAt: referral.ExpiresAt},
+	}
+	return campaign, meta, nil
+}
+
+// Store a referral signup, scored for fraud risk, with the tracking params of the visitor's
+// click on the campaign.
+func (self redirectRequest) createSignup(
+	c *gin.Context, campaign domain.Campaign, address string, meta domain.SignupMeta) (domain.Signup, error) {
+
+	meta.Risk = self.scorer.Score(fraud.Signals{
+		CampaignID: campaign.ID,
+		Address:    address,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	})
+	meta.Params = self.touchParams(meta.VisitorID, campaign.ID)
+	return self.signupKeeper.CreateSignup(campaign.ID, address, meta)
+}
+
+// ClaimRequest is the request type for claiming a signed referral token
+type ClaimRequest struct {
+	Token   string `json:"token" binding:"required,max=512"`
+	Address string `json:"address" binding:"required,min=41,max=61"`
+}
+
+// Validate claim request fields
+func (self ClaimRequest) Validate() (string, error) {
+	return domain.ValidateAddress(self.Address)
+}
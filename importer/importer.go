@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper"
+)
+
+// Supported import file formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// DefaultChunkSize is the number of records committed per transaction.
+var DefaultChunkSize = 500
+
+// Importer streams campaigns and signups from bulk import files into storage.
+type Importer struct {
+	importKeeper keeper.ImportKeeper
+	chunkSize    int
+}
+
+// NewImporter creates a new bulk importer that commits records in chunks.
+func NewImporter(importKeeper keeper.ImportKeeper, chunkSize int) Importer {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return Importer{importKeeper, chunkSize}
+}
+
+// Import reads records from a CSV or JSONL stream and commits them in chunks.
+// Invalid records are skipped and reported by line number.
+func (self Importer) Import(r io.Reader, format string) (report domain.ImportReport, err error) {
+	var next func() (domain.ImportRecord, error)
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		next, err = csvRecords(r)
+	case FormatJSONL:
+		next = jsonlRecords(r)
+	default:
+		err = fmt.Errorf("unsupported import format: %s", format)
+	}
+	if err != nil {
+		return
+	}
+	refs := make(map[string]uint64)
+	chunk := make([]domain.ImportRecord, 0, self.chunkSize)
+	flush := func() {
+		campaigns, signups, errs := self.importKeeper.ImportRecords(refs, chunk)
+		report.Campaigns += campaigns
+		report.Signups += signups
+		report.Errors = append(report.Errors, errs...)
+		chunk = chunk[:0]
+	}
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(invalidRecord); !ok && err != nil {
+			if len(chunk) > 0 {
+				flush()
+			}
+			return report, fmt.Errorf("line %d: %s", record.Line, err.Error())
+		}
+		if err == nil {
+			record, err = validate(record)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, domain.ImportError{Line: record.Line, Error: err.Error()})
+			continue
+		}
+		if chunk = append(chunk, record); len(chunk) >= self.chunkSize {
+			flush()
+		}
+	}
+	if len(chunk) > 0 {
+		flush()
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+	return
+}
+
+// Validate an import record using the same rules as the http api.
+func validate(record domain.ImportRecord) (domain.ImportRecord, error) {
+	record.Kind = strings.ToLower(strings.TrimSpace(record.Kind))
+	record.Ref = strings.TrimSpace(record.Ref)
+	record.Name = strings.TrimSpace(record.Name)
+	address, err := domain.ValidateAddress(record.Address)
+	if err != nil {
+		return record, err
+	}
+	record.Address = address
+	switch record.Kind {
+	case domain.ImportCampaign:
+		return record, nil
+	case domain.ImportSignup:
+		if record.Ref == "" {
+			return record, fmt.Errorf("signup ref cannot be blank")
+		}
+		if record.Status == "" {
+			record.Status = domain.SignupPending
+		}
+		record.Status, err = domain.ValidateSignupStatus(record.Status)
+		return record, err
+	}
+	return record, fmt.Errorf("invalid record kind: %s", record.Kind)
+}
+
+// Iterate records in a JSONL stream, one JSON object per line.
+func jsonlRecords(r io.Reader) func() (domain.ImportRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	return func() (record domain.ImportRecord, err error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			if err = json.Unmarshal(text, &record); err != nil {
+				err = invalidRecord{err}
+			}
+			record.Line = line
+			return
+		}
+		if err = scanner.Err(); err == nil {
+			err = io.EOF
+		}
+		record.Line = line + 1
+		return
+	}
+}
+
+// Iterate records in a CSV stream with a header row of column names.
+func csvRecords(r io.Reader) (func() (domain.ImportRecord, error), error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read csv header: %s", err.Error())
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["kind"]; !ok {
+		return nil, fmt.Errorf("csv header missing column: kind")
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, fmt.Errorf("csv header missing column: address")
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	return func() (record domain.ImportRecord, err error) {
+		row, err := reader.Read()
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				record.Line = parseErr.Line
+				err = invalidRecord{parseErr}
+			}
+			return
+		}
+		record.Line, _ = reader.FieldPos(0)
+		record.Kind = field(row, "kind")
+		record.Ref = field(row, "ref")
+		record.Address = field(row, "address")
+		record.Name = field(row, "name")
+		record.Status = field(row, "status")
+		return
+	}, nil
+}
+
+// invalidRecord is an error for a single malformed record that can be skipped.
+type invalidRecord struct {
+	err error
+}
+
+func (self invalidRecord) Error() string {
+	return self.err.Error()
+}
@@ -0,0 +1,172 @@
+package importer_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/carp-cobain/referrals/database"
+	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/importer"
+	"github.com/carp-cobain/referrals/keeper"
+	"github.com/carp-cobain/referrals/keeper/memory"
+)
+
+const (
+	referer = "tp1importer0referer000000000000000000000000"
+	referee = "tp1importer0referee000000000000000000000000"
+	other   = "tp1importer0other00000000000000000000000000"
+)
+
+// Run a test against import keepers backed by memory and sqlite.
+func eachKeeper(t *testing.T, test func(t *testing.T, importKeeper keeper.ImportKeeper)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, memory.NewStore(time.Minute))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := database.Connect(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()), 1)
+		if err != nil {
+			t.Fatalf("unable to connect to database: %+v", err)
+		}
+		if err := database.RunMigrations(db); err != nil {
+			t.Fatalf("unable to migrate database: %+v", err)
+		}
+		t.Cleanup(func() { database.Close(db, db, false) })
+		test(t, repo.NewImportRepo(db))
+	})
+}
+
+// Join JSONL import lines.
+func jsonl(lines ...string) io.Reader {
+	return strings.NewReader(strings.Join(lines, "\n"))
+}
+
+// Check the lines of import errors.
+func checkErrorLines(t *testing.T, report domain.ImportReport, lines ...int) {
+	t.Helper()
+	if len(report.Errors) != len(lines) {
+		t.Fatalf("expected import errors on lines %v, got: %+v", lines, report.Errors)
+	}
+	for i, line := range lines {
+		if report.Errors[i].Line != line {
+			t.Fatalf("expected import errors on lines %v, got: %+v", lines, report.Errors)
+		}
+	}
+}
+
+func TestImportMalformedLines(t *testing.T) {
+	eachKeeper(t, func(t *testing.T, importKeeper keeper.ImportKeeper) {
+		bulkImporter := importer.NewImporter(importKeeper, 10)
+		report, err := bulkImporter.Import(jsonl(
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Imported"}`,
+			`{"kind":"signup",`,
+			``,
+			`{"kind":"signup","ref":"c1","address":"TP1INVALID"}`,
+			`{"kind":"refund","ref":"c1","address":"`+other+`"}`,
+			`{"kind":"signup","ref":"c1","address":"`+referee+`","status":"verified"}`,
+		), importer.FormatJSONL)
+		if err != nil || report.Campaigns != 1 || report.Signups != 1 {
+			t.Fatalf("got unexpected jsonl import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 2, 4, 5)
+
+		csv := strings.Join([]string{
+			"kind,ref,address,name,status",
+			"campaign,c2," + other + ",Imported CSV,",
+			`signup,c2,tp1"bad,,`,
+			"signup,c2,tp1importer0csv000000000000000000000000000,,pending",
+		}, "\n")
+		report, err = bulkImporter.Import(strings.NewReader(csv), importer.FormatCSV)
+		if err != nil || report.Campaigns != 1 || report.Signups != 1 {
+			t.Fatalf("got unexpected csv import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 3)
+
+		if _, err := bulkImporter.Import(strings.NewReader("ref,address\n"), importer.FormatCSV); err == nil {
+			t.Fatalf("expected missing csv column error")
+		}
+	})
+}
+
+func TestImportReadFailure(t *testing.T) {
+	eachKeeper(t, func(t *testing.T, importKeeper keeper.ImportKeeper) {
+		input := io.MultiReader(
+			jsonl(`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Imported"}`+"\n"),
+			iotest.ErrReader(errors.New("disk failed")),
+		)
+		report, err := importer.NewImporter(importKeeper, 10).Import(input, importer.FormatJSONL)
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Fatalf("expected read error on line 2, got: %+v", err)
+		}
+		if report.Campaigns != 1 {
+			t.Fatalf("expected records before the failure to be imported, got: %+v", report)
+		}
+	})
+}
+
+func TestImportDuplicateSignups(t *testing.T) {
+	eachKeeper(t, func(t *testing.T, importKeeper keeper.ImportKeeper) {
+		bulkImporter := importer.NewImporter(importKeeper, 2)
+		report, err := bulkImporter.Import(jsonl(
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Imported"}`,
+			`{"kind":"signup","ref":"c1","address":"`+referee+`"}`,
+			`{"kind":"signup","ref":"c1","address":"`+referee+`"}`,
+			`{"kind":"signup","ref":"c1","address":"`+other+`"}`,
+			`{"kind":"signup","ref":"c1","address":"`+other+`"}`,
+		), importer.FormatJSONL)
+		if err != nil || report.Campaigns != 1 || report.Signups != 2 {
+			t.Fatalf("got unexpected import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 3, 5)
+
+		// Addresses referred by an earlier import are skipped too.
+		report, err = bulkImporter.Import(jsonl(
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Imported"}`,
+			`{"kind":"signup","ref":"c1","address":"`+referee+`"}`,
+		), importer.FormatJSONL)
+		if err != nil || report.Campaigns != 0 || report.Signups != 0 {
+			t.Fatalf("got unexpected re-import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 2)
+	})
+}
+
+func TestImportUnknownRefs(t *testing.T) {
+	eachKeeper(t, func(t *testing.T, importKeeper keeper.ImportKeeper) {
+		report, err := importer.NewImporter(importKeeper, 10).Import(jsonl(
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Imported"}`,
+			`{"kind":"signup","ref":"c2","address":"`+referee+`"}`,
+			`{"kind":"signup","ref":"999","address":"`+referee+`"}`,
+			`{"kind":"signup","ref":"1","address":"`+referee+`"}`,
+		), importer.FormatJSONL)
+		if err != nil || report.Campaigns != 1 || report.Signups != 1 {
+			t.Fatalf("got unexpected import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 2, 3)
+		if !strings.Contains(report.Errors[0].Error, "unknown campaign ref: c2") {
+			t.Fatalf("expected unknown campaign ref error, got: %+v", report.Errors[0])
+		}
+	})
+}
+
+func TestImportChunkBoundary(t *testing.T) {
+	eachKeeper(t, func(t *testing.T, importKeeper keeper.ImportKeeper) {
+		// Refs from campaigns committed in one chunk resolve in later chunks.
+		report, err := importer.NewImporter(importKeeper, 2).Import(jsonl(
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"First"}`,
+			`{"kind":"campaign","ref":"c2","address":"`+referer+`","name":"Second"}`,
+			`{"kind":"signup","ref":"c1","address":"`+referee+`"}`,
+			`{"kind":"signup","ref":"c2","address":"`+other+`"}`,
+			`{"kind":"campaign","ref":"c1","address":"`+referer+`","name":"Third"}`,
+		), importer.FormatJSONL)
+		if err != nil || report.Campaigns != 2 || report.Signups != 2 {
+			t.Fatalf("got unexpected import: %+v %+v", report, err)
+		}
+		checkErrorLines(t, report, 5)
+	})
+}
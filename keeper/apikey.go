@@ -0,0 +1,16 @@
+package keeper
+
+import "github.com/carp-cobain/referrals/domain"
+
+// APIKeyKeeper manages API keys
+type APIKeyKeeper interface {
+	APIKeyReader
+	GetAPIKeys(cursor uint64, limit int) (uint64, []domain.APIKey)
+	CreateAPIKey(name string, scopes []string) (domain.APIKey, string, error)
+	RevokeAPIKey(id uint64) (domain.APIKey, error)
+}
+
+// APIKeyReader authenticates API keys
+type APIKeyReader interface {
+	Authenticate(key string) (domain.APIKey, error)
+}
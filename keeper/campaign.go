@@ -16,5 +16,5 @@ type CampaignReader interface {
 
 // CampaignWriter writes referral campaigns
 type CampaignWriter interface {
-	CreateCampaign(address, name string) (campaign domain.Campaign, err error)
+	CreateCampaign(address, name string, options domain.CampaignOptions) (campaign domain.Campaign, err error)
 }
@@ -0,0 +1,8 @@
+package keeper
+
+import "github.com/carp-cobain/referrals/domain"
+
+// ImportKeeper stores records from bulk imports
+type ImportKeeper interface {
+	ImportRecords(refs map[string]uint64, records []domain.ImportRecord) (int, int, []domain.ImportError)
+}
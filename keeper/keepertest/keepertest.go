@@ -0,0 +1,466 @@
+// Package keepertest is a conformance suite for keeper implementations. Every storage backend
+// must pass it so handlers behave the same whatever the backend.
+package keepertest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/importer"
+	"github.com/carp-cobain/referrals/keeper"
+)
+
+// Keepers are the keeper implementations of a storage backend under test.
+type Keepers struct {
+	Campaigns   keeper.CampaignKeeper
+	Signups     keeper.SignupKeeper
+	Risk        keeper.RiskReader
+	Touches     keeper.TouchKeeper
+	Reviews     keeper.ReviewKeeper
+	APIKeys     keeper.APIKeyKeeper
+	Sessions    keeper.SessionKeeper
+	SigningKeys keeper.SigningKeyKeeper
+	Nonces      keeper.NonceKeeper
+	Imports     keeper.ImportKeeper
+}
+
+// Run the conformance suite. newKeepers is called for each test and must return keepers
+// backed by empty storage, with review claims that last at least a minute.
+func Run(t *testing.T, newKeepers func(t *testing.T) Keepers) {
+	t.Run("Campaigns", func(t *testing.T) { testCampaigns(t, newKeepers(t)) })
+	t.Run("CampaignPaging", func(t *testing.T) { testCampaignPaging(t, newKeepers(t)) })
+	t.Run("Signups", func(t *testing.T) { testSignups(t, newKeepers(t)) })
+	t.Run("SignupPaging", func(t *testing.T) { testSignupPaging(t, newKeepers(t)) })
+	t.Run("UpdateSignup", func(t *testing.T) { testUpdateSignup(t, newKeepers(t)) })
+	t.Run("Risk", func(t *testing.T) { testRisk(t, newKeepers(t)) })
+	t.Run("Touches", func(t *testing.T) { testTouches(t, newKeepers(t)) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, newKeepers(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, newKeepers(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newKeepers(t)) })
+	t.Run("SigningKeys", func(t *testing.T) { testSigningKeys(t, newKeepers(t)) })
+	t.Run("Nonces", func(t *testing.T) { testNonces(t, newKeepers(t)) })
+	t.Run("Imports", func(t *testing.T) { testImports(t, newKeepers(t)) })
+}
+
+const (
+	referer = "tp1conformance0referer000000000000000000000"
+	referee = "tp1conformance0referee000000000000000000000"
+)
+
+func testCampaigns(t *testing.T, keepers Keepers) {
+	options := domain.CampaignOptions{
+		Attribution: domain.AttributionFirst,
+		UTM:         domain.Params{"utm_source": "flyer"},
+	}
+	options.Destination = "https://myapp.io/welcome"
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", options)
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	if campaign.ID == 0 || campaign.Address != referer || campaign.Name != "Conformance" {
+		t.Fatalf("got unexpected campaign: %+v", campaign)
+	}
+	got, err := keepers.Campaigns.GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("failed to get campaign: %+v", err)
+	}
+	if got.Attribution != domain.AttributionFirst || got.UTM["utm_source"] != "flyer" ||
+		got.Destination != options.Destination {
+		t.Fatalf("got unexpected campaign options: %+v", got)
+	}
+	if _, err := keepers.Campaigns.GetCampaign(campaign.ID + 1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected campaign not found error, got: %+v", err)
+	}
+}
+
+func testCampaignPaging(t *testing.T, keepers Keepers) {
+	for _, name := range []string{"First", "Second", "Third"} {
+		if _, err := keepers.Campaigns.CreateCampaign(referer, name, domain.CampaignOptions{}); err != nil {
+			t.Fatalf("failed to create campaign: %+v", err)
+		}
+	}
+	if _, err := keepers.Campaigns.CreateCampaign(referee, "Other", domain.CampaignOptions{}); err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	next, page := keepers.Campaigns.GetCampaigns(referer, 0, 2)
+	if len(page) != 2 || page[0].Name != "First" || page[1].Name != "Second" || next != page[1].ID {
+		t.Fatalf("got unexpected first page: %d %+v", next, page)
+	}
+	next, page = keepers.Campaigns.GetCampaigns(referer, next, 2)
+	if len(page) != 1 || page[0].Name != "Third" || next != page[0].ID {
+		t.Fatalf("got unexpected second page: %d %+v", next, page)
+	}
+	if next, page = keepers.Campaigns.GetCampaigns(referer, next, 2); len(page) != 0 || next != 0 {
+		t.Fatalf("got unexpected last page: %d %+v", next, page)
+	}
+}
+
+func testSignups(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	meta := domain.SignupMeta{VisitorID: "visitor", Params: domain.Params{"utm_medium": "print"}}
+	signup, err := keepers.Signups.CreateSignup(campaign.ID, referee, meta)
+	if err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	if signup.ID == 0 || signup.CampaignID != campaign.ID || signup.Address != referee ||
+		signup.Status != domain.SignupPending {
+		t.Fatalf("got unexpected signup: %+v", signup)
+	}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID, referer, domain.SignupMeta{}); !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("expected self referral error, got: %+v", err)
+	}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID, referee, domain.SignupMeta{}); !errors.Is(err, domain.ErrAlreadyReferred) ||
+		!errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected already referred error, got: %+v", err)
+	}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID+1000, referee+"x", domain.SignupMeta{}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected campaign not found error, got: %+v", err)
+	}
+	flagged := domain.SignupMeta{Risk: domain.Risk{Score: 90, Flagged: true}}
+	signup, err = keepers.Signups.CreateSignup(campaign.ID, referee+"x", flagged)
+	if err != nil {
+		t.Fatalf("failed to create flagged signup: %+v", err)
+	}
+	if signup.Status != domain.SignupFlagged {
+		t.Fatalf("expected high risk signup to be flagged, got: %s", signup.Status)
+	}
+}
+
+func testSignupPaging(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	for _, suffix := range []string{"a", "b", "c"} {
+		if _, err := keepers.Signups.CreateSignup(campaign.ID, referee+suffix, domain.SignupMeta{}); err != nil {
+			t.Fatalf("failed to create signup: %+v", err)
+		}
+	}
+	next, page := keepers.Signups.GetSignups(campaign.ID, 0, 2)
+	if len(page) != 2 || page[0].Address != referee+"a" || next != page[1].ID {
+		t.Fatalf("got unexpected first page: %d %+v", next, page)
+	}
+	if next, page = keepers.Signups.GetSignups(campaign.ID, next, 2); len(page) != 1 || next != page[0].ID {
+		t.Fatalf("got unexpected second page: %d %+v", next, page)
+	}
+	_, exports, err := keepers.Signups.ExportSignups(campaign.ID, domain.SignupPending, 0, 10)
+	if err != nil || len(exports) != 3 || exports[0].CampaignName != campaign.Name {
+		t.Fatalf("got unexpected exports: %+v", exports)
+	}
+	if _, exports, _ = keepers.Signups.ExportSignups(0, domain.SignupVerified, 0, 10); len(exports) != 0 {
+		t.Fatalf("got unexpected verified exports: %+v", exports)
+	}
+}
+
+func testUpdateSignup(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	signup, err := keepers.Signups.CreateSignup(campaign.ID, referee, domain.SignupMeta{})
+	if err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	if _, err := keepers.Signups.UpdateSignup(campaign.ID+1000, signup.ID, domain.SignupVerified, "test"); err == nil {
+		t.Fatalf("expected invalid campaign error")
+	}
+	signup, err = keepers.Signups.UpdateSignup(campaign.ID, signup.ID, domain.SignupVerified, "test")
+	if err != nil {
+		t.Fatalf("failed to update signup: %+v", err)
+	}
+	if signup.Status != domain.SignupVerified {
+		t.Fatalf("got unexpected signup status: %s", signup.Status)
+	}
+	if _, err := keepers.Signups.UpdateSignup(campaign.ID, signup.ID, domain.SignupFlagged, "test"); err == nil {
+		t.Fatalf("expected invalid transition error")
+	}
+}
+
+func testRisk(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	meta := domain.SignupMeta{Risk: domain.Risk{IPHash: "ip", Fingerprint: "fingerprint"}}
+	for _, suffix := range []string{"a", "b"} {
+		if _, err := keepers.Signups.CreateSignup(campaign.ID, referee+suffix, meta); err != nil {
+			t.Fatalf("failed to create signup: %+v", err)
+		}
+	}
+	if count := keepers.Risk.CountRecentSignups(campaign.ID, time.Now().Add(-time.Minute)); count != 2 {
+		t.Fatalf("got unexpected recent signup count: %d", count)
+	}
+	if count := keepers.Risk.CountSharedIP(campaign.ID, "ip"); count != 2 {
+		t.Fatalf("got unexpected shared ip count: %d", count)
+	}
+	if count := keepers.Risk.CountSharedFingerprint(campaign.ID, ""); count != 0 {
+		t.Fatalf("expected empty fingerprints not to match, got: %d", count)
+	}
+	if count := keepers.Risk.CountOwnedCampaigns(referer); count != 1 {
+		t.Fatalf("got unexpected owned campaign count: %d", count)
+	}
+}
+
+func testTouches(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	params := domain.Params{"utm_source": "flyer"}
+	if _, err := keepers.Touches.RecordTouch("visitor", campaign.ID, params); err != nil {
+		t.Fatalf("failed to record touch: %+v", err)
+	}
+	if _, err := keepers.Touches.RecordTouch("other", campaign.ID, nil); err != nil {
+		t.Fatalf("failed to record touch: %+v", err)
+	}
+	touches := keepers.Touches.GetTouches("visitor", time.Now().Add(-time.Minute))
+	if len(touches) != 1 || touches[0].CampaignID != campaign.ID || touches[0].Params["utm_source"] != "flyer" {
+		t.Fatalf("got unexpected touches: %+v", touches)
+	}
+	if touches = keepers.Touches.GetTouches("visitor", time.Now().Add(time.Minute)); len(touches) != 0 {
+		t.Fatalf("got unexpected future touches: %+v", touches)
+	}
+	if err := keepers.Touches.RecordFilteredHits(map[uint64]uint64{campaign.ID: 2}); err != nil {
+		t.Fatalf("failed to record filtered hits: %+v", err)
+	}
+	if err := keepers.Touches.RecordFilteredHits(map[uint64]uint64{campaign.ID: 1}); err != nil {
+		t.Fatalf("failed to record filtered hits: %+v", err)
+	}
+	if campaign, _ = keepers.Campaigns.GetCampaign(campaign.ID); campaign.FilteredHits != 3 {
+		t.Fatalf("got unexpected filtered hits: %d", campaign.FilteredHits)
+	}
+}
+
+func testReviews(t *testing.T, keepers Keepers) {
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Conformance", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	for i, score := range []int{70, 90} {
+		meta := domain.SignupMeta{Risk: domain.Risk{Score: score, Flagged: true}}
+		if _, err := keepers.Signups.CreateSignup(campaign.ID, referee+string(rune('a'+i)), meta); err != nil {
+			t.Fatalf("failed to create signup: %+v", err)
+		}
+	}
+	_, queue := keepers.Reviews.GetReviewQueue("alice", 0, 10)
+	if len(queue) != 2 || queue[0].RiskScore != 90 {
+		t.Fatalf("expected review queue highest risk first, got: %+v", queue)
+	}
+	next, first := keepers.Reviews.GetReviewQueue("alice", 0, 1)
+	if len(first) != 1 || first[0].ID != queue[0].ID || next != queue[0].ID {
+		t.Fatalf("got unexpected first review queue page: %d %+v", next, first)
+	}
+	if next, second := keepers.Reviews.GetReviewQueue("alice", next, 1); len(second) != 1 || second[0].ID != queue[1].ID {
+		t.Fatalf("got unexpected second review queue page: %d %+v", next, second)
+	}
+	signup := queue[0]
+	for _, status := range []string{domain.SignupVerified, domain.SignupPending, domain.SignupRejected} {
+		if _, err := keepers.Signups.UpdateSignup(campaign.ID, signup.ID, status, "test"); !errors.Is(err, domain.ErrValidation) {
+			t.Fatalf("expected invalid transition error for flagged signup update to %s, got: %+v", status, err)
+		}
+	}
+	if _, err := keepers.Reviews.ReviewSignup(signup.ID, "alice", domain.SignupVerified); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected unclaimed review error, got: %+v", err)
+	}
+	if signup, err = keepers.Reviews.ClaimSignup(signup.ID, "alice"); err != nil || signup.ClaimedBy != "alice" {
+		t.Fatalf("failed to claim signup: %+v %+v", signup, err)
+	}
+	if _, err := keepers.Reviews.ClaimSignup(signup.ID, "bob"); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected claimed signup error, got: %+v", err)
+	}
+	if _, queue := keepers.Reviews.GetReviewQueue("bob", 0, 10); len(queue) != 1 {
+		t.Fatalf("expected claimed signup to be hidden from other reviewers")
+	}
+	if _, err := keepers.Reviews.UnclaimSignup(signup.ID, "bob"); err == nil {
+		t.Fatalf("expected unclaim by other reviewer error")
+	}
+	if signup, err = keepers.Reviews.ReviewSignup(signup.ID, "alice", domain.SignupVerified); err != nil {
+		t.Fatalf("failed to approve signup: %+v", err)
+	}
+	if signup.Status != domain.SignupVerified || signup.ClaimedBy != "" {
+		t.Fatalf("got unexpected reviewed signup: %+v", signup)
+	}
+	if signup, err = keepers.Reviews.GetSignup(signup.ID); err != nil || signup.Status != domain.SignupVerified {
+		t.Fatalf("failed to get reviewed signup: %+v %+v", signup, err)
+	}
+	history := keepers.Reviews.GetSignupHistory(signup.ID)
+	if len(history) != 1 || history[0].Actor != "alice" || history[0].FromStatus != domain.SignupFlagged {
+		t.Fatalf("got unexpected signup history: %+v", history)
+	}
+	if _, err := keepers.Reviews.GetSignup(signup.ID + 1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected signup not found error, got: %+v", err)
+	}
+}
+
+func testAPIKeys(t *testing.T, keepers Keepers) {
+	apiKey, key, err := keepers.APIKeys.CreateAPIKey("Conformance", []string{domain.ScopeSignupsVerify})
+	if err != nil {
+		t.Fatalf("failed to create api key: %+v", err)
+	}
+	if authenticated, err := keepers.APIKeys.Authenticate(key); err != nil || authenticated.ID != apiKey.ID {
+		t.Fatalf("failed to authenticate api key: %+v %+v", authenticated, err)
+	}
+	if _, _, err := keepers.APIKeys.CreateAPIKey("Other", []string{domain.ScopeAdmin}); err != nil {
+		t.Fatalf("failed to create api key: %+v", err)
+	}
+	if next, keys := keepers.APIKeys.GetAPIKeys(0, 1); len(keys) != 1 || next != apiKey.ID {
+		t.Fatalf("got unexpected api keys page: %d %+v", next, keys)
+	}
+	if apiKey, err = keepers.APIKeys.RevokeAPIKey(apiKey.ID); err != nil || apiKey.RevokedAt == nil {
+		t.Fatalf("failed to revoke api key: %+v %+v", apiKey, err)
+	}
+	if _, err := keepers.APIKeys.Authenticate(key); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected revoked api key error, got: %+v", err)
+	}
+	if _, err := keepers.APIKeys.RevokeAPIKey(apiKey.ID + 1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected api key not found error, got: %+v", err)
+	}
+}
+
+func testSessions(t *testing.T, keepers Keepers) {
+	challenge, err := keepers.Sessions.CreateChallenge(referer, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create challenge: %+v", err)
+	}
+	if _, err := keepers.Sessions.UseChallenge(challenge.Nonce, referee); err == nil {
+		t.Fatalf("expected challenge address mismatch error")
+	}
+	used, err := keepers.Sessions.UseChallenge(challenge.Nonce, referer)
+	if err != nil || used.Message != challenge.Message {
+		t.Fatalf("failed to use challenge: %+v %+v", used, err)
+	}
+	if _, err := keepers.Sessions.UseChallenge(challenge.Nonce, referer); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected used challenge error, got: %+v", err)
+	}
+	token, _, err := keepers.Sessions.CreateRefreshToken(referer, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %+v", err)
+	}
+	other, _, _ := keepers.Sessions.CreateRefreshToken(referer, time.Hour)
+	if address, err := keepers.Sessions.RotateRefreshToken(token); err != nil || address != referer {
+		t.Fatalf("failed to rotate refresh token: %s %+v", address, err)
+	}
+	if _, err := keepers.Sessions.RotateRefreshToken(token); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected reused refresh token error, got: %+v", err)
+	}
+	if _, err := keepers.Sessions.RotateRefreshToken(other); err == nil {
+		t.Fatalf("expected refresh token reuse to revoke all sessions")
+	}
+	if err := keepers.Sessions.RevokeRefreshToken(referee, other); err == nil {
+		t.Fatalf("expected refresh token address mismatch error")
+	}
+	if err := keepers.Sessions.RevokeRefreshToken(referer, other); err != nil {
+		t.Fatalf("expected revoking a revoked refresh token to succeed, got: %+v", err)
+	}
+	if err := keepers.Sessions.RevokeAccessToken("jti", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to revoke access token: %+v", err)
+	}
+	if err := keepers.Sessions.RevokeAccessToken("jti", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to revoke access token twice: %+v", err)
+	}
+	if !keepers.Sessions.IsAccessTokenRevoked("jti") || keepers.Sessions.IsAccessTokenRevoked("other") {
+		t.Fatalf("got unexpected access token revocations")
+	}
+}
+
+func testSigningKeys(t *testing.T, keepers Keepers) {
+	first, err := keepers.SigningKeys.RotateSigningKey(0)
+	if err != nil {
+		t.Fatalf("failed to create signing key: %+v", err)
+	}
+	if keys := keepers.SigningKeys.GetSigningKeys(); len(keys) != 1 || keys[0].ID != first.ID {
+		t.Fatalf("got unexpected signing keys: %+v", keys)
+	}
+	if _, err := keepers.SigningKeys.RotateSigningKey(time.Hour); err != nil {
+		t.Fatalf("failed to rotate signing key: %+v", err)
+	}
+	keys := keepers.SigningKeys.GetSigningKeys()
+	if len(keys) != 2 || keys[0].RetiredAt == nil || keys[1].RetiredAt != nil {
+		t.Fatalf("expected the old key to retire after a grace period, got: %+v", keys)
+	}
+	if _, err := keepers.SigningKeys.RotateSigningKey(-time.Hour); err != nil {
+		t.Fatalf("failed to rotate signing key: %+v", err)
+	}
+	if keys := keepers.SigningKeys.GetSigningKeys(); len(keys) != 2 {
+		t.Fatalf("expected retired keys to be dropped, got: %+v", keys)
+	}
+}
+
+func testNonces(t *testing.T, keepers Keepers) {
+	expiresAt := time.Now().Add(time.Hour)
+	if err := keepers.Nonces.UseNonce("nonce", expiresAt); err != nil {
+		t.Fatalf("failed to use nonce: %+v", err)
+	}
+	if err := keepers.Nonces.UseNonce("nonce", expiresAt); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected replayed nonce error, got: %+v", err)
+	}
+	// Signups consume token nonces, unless the signup isn't recorded.
+	campaign, err := keepers.Campaigns.CreateCampaign(referer, "Nonces", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	meta := domain.SignupMeta{Nonce: &domain.Nonce{Value: "signup", ExpiresAt: expiresAt}}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID, referer, meta); err == nil {
+		t.Fatalf("expected self referral error")
+	}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID, referee, meta); err != nil {
+		t.Fatalf("failed to create signup with nonce: %+v", err)
+	}
+	if _, err := keepers.Signups.CreateSignup(campaign.ID, referee+"x", meta); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected replayed signup nonce error, got: %+v", err)
+	}
+	if err := keepers.Nonces.UseNonce("signup", expiresAt); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected signup nonce to be used, got: %+v", err)
+	}
+}
+
+func testImports(t *testing.T, keepers Keepers) {
+	input := strings.Join([]string{
+		`{"kind":"campaign","ref":"c1","address":"` + referer + `","name":"Imported"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referee + `","status":"verified"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referee + `"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referer + `"}`,
+		`{"kind":"signup","ref":"c2","address":"` + referee + `x"}`,
+	}, "\n")
+	report, err := importer.NewImporter(keepers.Imports, 2).Import(strings.NewReader(input), importer.FormatJSONL)
+	if err != nil {
+		t.Fatalf("failed to import records: %+v", err)
+	}
+	if report.Campaigns != 1 || report.Signups != 1 || len(report.Errors) != 3 {
+		t.Fatalf("got unexpected import report: %+v", report)
+	}
+	_, campaigns := keepers.Campaigns.GetCampaigns(referer, 0, 10)
+	if len(campaigns) != 1 || campaigns[0].Name != "Imported" {
+		t.Fatalf("got unexpected imported campaigns: %+v", campaigns)
+	}
+	_, signups := keepers.Signups.GetSignups(campaigns[0].ID, 0, 10)
+	if len(signups) != 1 || signups[0].Status != domain.SignupVerified {
+		t.Fatalf("got unexpected imported signups: %+v", signups)
+	}
+	// Re-imported campaigns are tracked instead of duplicated, and a record failing in the
+	// database, like an out of range campaign ID on PostgreSQL, only skips that record.
+	input = strings.Join([]string{
+		`{"kind":"campaign","ref":"c1","address":"` + referer + `","name":"Imported"}`,
+		`{"kind":"signup","ref":"18446744073709551615","address":"` + referee + `y"}`,
+		`{"kind":"signup","ref":"c1","address":"` + referee + `z"}`,
+	}, "\n")
+	report, err = importer.NewImporter(keepers.Imports, 10).Import(strings.NewReader(input), importer.FormatJSONL)
+	if err != nil {
+		t.Fatalf("failed to re-import records: %+v", err)
+	}
+	if report.Campaigns != 0 || report.Signups != 1 || len(report.Errors) != 1 || report.Errors[0].Line != 2 {
+		t.Fatalf("got unexpected re-import report: %+v", report)
+	}
+	if _, campaigns = keepers.Campaigns.GetCampaigns(referer, 0, 10); len(campaigns) != 1 {
+		t.Fatalf("expected re-imported campaign not to be duplicated: %+v", campaigns)
+	}
+	if _, signups = keepers.Signups.GetSignups(campaigns[0].ID, 0, 10); len(signups) != 2 {
+		t.Fatalf("got unexpected re-imported signups: %+v", signups)
+	}
+}
@@ -0,0 +1,10 @@
+package keeper
+
+import "github.com/carp-cobain/referrals/domain"
+
+// MaintenanceKeeper runs scheduled database maintenance tasks
+type MaintenanceKeeper interface {
+	GetMaintenanceTasks() []domain.MaintenanceTask
+	RunMaintenanceTask(name string) (domain.MaintenanceTask, error)
+	GetMaintenanceMetrics() map[string]int64
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// Authenticate gets the active API key matching a plaintext key.
+func (self *Store) Authenticate(key string) (domain.APIKey, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	hash := auth.HashAPIKey(key)
+	for _, apiKey := range self.apiKeys {
+		if apiKey.hash == hash && apiKey.RevokedAt == nil {
+			return apiKey.APIKey, nil
+		}
+	}
+	return domain.APIKey{}, domain.NewError(domain.ErrForbidden, "invalid api key")
+}
+
+// GetAPIKeys gets a page of API keys.
+func (self *Store) GetAPIKeys(cursor uint64, limit int) (next uint64, keys []domain.APIKey) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	records := page(self.apiKeys, cursor, limit, func(apiKeyRecord) bool { return true })
+	keys = make([]domain.APIKey, len(records))
+	for i, record := range records {
+		keys[i] = record.APIKey
+		next = max(next, record.ID)
+	}
+	return
+}
+
+// CreateAPIKey creates a new API key with scopes. The plaintext key is only
+// returned here; only its hash is stored.
+func (self *Store) CreateAPIKey(name string, scopes []string) (domain.APIKey, string, error) {
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return domain.APIKey{}, "", fmt.Errorf("CreateAPIKey: %s", err.Error())
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	apiKey := apiKeyRecord{
+		APIKey: domain.APIKey{
+			ID:        uint64(len(self.apiKeys) + 1),
+			Name:      name,
+			Prefix:    prefix,
+			Scopes:    append([]string{}, scopes...),
+			CreatedAt: now(),
+		},
+		hash: auth.HashAPIKey(key),
+	}
+	self.apiKeys = append(self.apiKeys, apiKey)
+	return apiKey.APIKey, key, nil
+}
+
+// RevokeAPIKey revokes an API key by ID.
+func (self *Store) RevokeAPIKey(id uint64) (domain.APIKey, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	apiKey, err := lookup(self.apiKeys, "api key", id)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	if apiKey.RevokedAt == nil {
+		revokedAt := now()
+		apiKey.RevokedAt = &revokedAt
+	}
+	return apiKey.APIKey, nil
+}
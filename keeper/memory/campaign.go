@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"maps"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// GetCampaign gets a campaign by ID
+func (self *Store) GetCampaign(id uint64) (domain.Campaign, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	campaign, err := lookup(self.campaigns, "campaign", id)
+	if err != nil {
+		return domain.Campaign{}, err
+	}
+	return cloneCampaign(*campaign), nil
+}
+
+// GetCampaigns gets a page of referral campaigns for a blockchain address
+func (self *Store) GetCampaigns(
+	address string, cursor uint64, limit int) (next uint64, campaigns []domain.Campaign) {
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	campaigns = page(self.campaigns, cursor, limit, func(campaign domain.Campaign) bool {
+		return campaign.Address == address
+	})
+	for i, campaign := range campaigns {
+		campaigns[i] = cloneCampaign(campaign)
+		next = max(next, campaign.ID)
+	}
+	if campaigns == nil {
+		campaigns = []domain.Campaign{}
+	}
+	return
+}
+
+// CreateCampaign creates a new named campaign
+func (self *Store) CreateCampaign(
+	address, name string, options domain.CampaignOptions) (domain.Campaign, error) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return cloneCampaign(self.insertCampaign(address, name, options)), nil
+}
+
+// RecordTouch records a click on a referral link by a visitor with tracking params.
+func (self *Store) RecordTouch(
+	visitorID string, campaignID uint64, params domain.Params) (domain.Touch, error) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	touch := domain.Touch{
+		ID:         uint64(len(self.touches) + 1),
+		VisitorID:  visitorID,
+		CampaignID: campaignID,
+		Params:     cloneParams(params),
+		CreatedAt:  now(),
+	}
+	self.touches = append(self.touches, touch)
+	return cloneTouch(touch), nil
+}
+
+// RecordFilteredHits counts bot hits per campaign on referral links that weren't recorded as
+// clicks.
+func (self *Store) RecordFilteredHits(hits map[uint64]uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for campaignID, count := range hits {
+		if campaign, err := lookup(self.campaigns, "campaign", campaignID); err == nil {
+			campaign.FilteredHits += count
+		}
+	}
+	return nil
+}
+
+// GetTouches gets referral link clicks by a visitor since a time, oldest first.
+func (self *Store) GetTouches(visitorID string, since time.Time) []domain.Touch {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	touches := []domain.Touch{}
+	for _, touch := range self.touches {
+		if touch.VisitorID == visitorID && touch.CreatedAt.Unix() >= since.Unix() {
+			touches = append(touches, cloneTouch(touch))
+		}
+	}
+	return touches
+}
+
+// Insert a new named campaign for an address.
+func (self *Store) insertCampaign(address, name string, options domain.CampaignOptions) domain.Campaign {
+	createdAt := now()
+	options.UTM = cloneParams(options.UTM)
+	campaign := domain.Campaign{
+		ID:              uint64(len(self.campaigns) + 1),
+		Address:         address,
+		Name:            name,
+		CampaignOptions: options,
+		CreatedAt:       createdAt,
+		UpdatedAt:       createdAt,
+	}
+	self.campaigns = append(self.campaigns, campaign)
+	return campaign
+}
+
+// Copy a campaign so callers can't change the stored record.
+func cloneCampaign(campaign domain.Campaign) domain.Campaign {
+	campaign.UTM = cloneParams(campaign.UTM)
+	return campaign
+}
+
+// Copy a touch so callers can't change the stored record.
+func cloneTouch(touch domain.Touch) domain.Touch {
+	touch.Params = cloneParams(touch.Params)
+	return touch
+}
+
+// Copy params so callers can't change stored records, storing empty params as nil like
+// databases do.
+func cloneParams(params domain.Params) domain.Params {
+	if len(params) == 0 {
+		return nil
+	}
+	return maps.Clone(params)
+}
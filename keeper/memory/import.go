@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// ImportRecords stores a chunk of import records. Campaign refs created in the chunk are
+// added to refs. Returns the number of campaigns and signups imported along with errors for
+// records that were skipped.
+func (self *Store) ImportRecords(
+	refs map[string]uint64, records []domain.ImportRecord) (campaigns, signups int, errs []domain.ImportError) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, record := range records {
+		var err error
+		switch record.Kind {
+		case domain.ImportCampaign:
+			var inserted bool
+			if inserted, err = self.importCampaign(refs, record); err == nil && inserted {
+				campaigns++
+			}
+		case domain.ImportSignup:
+			if err = self.importSignup(refs, record); err == nil {
+				signups++
+			}
+		default:
+			err = fmt.Errorf("invalid record kind: %s", record.Kind)
+		}
+		if err != nil {
+			errs = append(errs, domain.ImportError{Line: record.Line, Error: err.Error()})
+		}
+	}
+	return
+}
+
+// Insert an imported campaign, tracking its source system ref. Campaigns are keyed by address
+// and name, so re-imports track the existing campaign instead of inserting a duplicate.
+// Returns whether a campaign was inserted.
+func (self *Store) importCampaign(refs map[string]uint64, record domain.ImportRecord) (bool, error) {
+	if _, ok := refs[record.Ref]; ok && record.Ref != "" {
+		return false, fmt.Errorf("duplicate campaign ref: %s", record.Ref)
+	}
+	index := slices.IndexFunc(self.campaigns, func(campaign domain.Campaign) bool {
+		return campaign.Address == record.Address && campaign.Name == record.Name
+	})
+	var campaign domain.Campaign
+	if index >= 0 {
+		campaign = self.campaigns[index]
+	} else {
+		campaign = self.insertCampaign(record.Address, record.Name, domain.CampaignOptions{})
+	}
+	if record.Ref != "" {
+		refs[record.Ref] = campaign.ID
+	}
+	return index < 0, nil
+}
+
+// Insert an imported signup, skipping addresses that have already been referred.
+func (self *Store) importSignup(refs map[string]uint64, record domain.ImportRecord) error {
+	campaignID, ok := refs[record.Ref]
+	if !ok {
+		id, err := strconv.ParseUint(record.Ref, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unknown campaign ref: %s", record.Ref)
+		}
+		campaignID = id
+	}
+	campaign, err := lookup(self.campaigns, "campaign", campaignID)
+	if err != nil {
+		return err
+	}
+	if campaign.Address == record.Address {
+		return fmt.Errorf("self referral error: %s", record.Address)
+	}
+	if self.signupExists(record.Address) {
+		return fmt.Errorf("address already referred: %s", record.Address)
+	}
+	self.insertSignup(signupRecord{
+		Signup: domain.Signup{CampaignID: campaignID, Address: record.Address, Status: record.Status},
+	})
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package memory implements the keeper interfaces with thread-safe in-memory storage, for
+// tests and demos. Semantics match the database repos, including self referral rejection,
+// unique referee addresses and cursor paging.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// Store keeps referral data in memory as domain objects, with the few stored fields domain
+// objects don't expose kept alongside in records. IDs are assigned sequentially from 1, so
+// each record lives at index ID-1.
+type Store struct {
+	mu            sync.RWMutex
+	claimTTL      time.Duration
+	campaigns     []domain.Campaign
+	touches       []domain.Touch
+	signups       []signupRecord
+	signupEvents  []domain.SignupEvent
+	apiKeys       []apiKeyRecord
+	challenges    []challengeRecord
+	refreshTokens []refreshTokenRecord
+	revokedTokens map[string]time.Time
+	signingKeys   []domain.SigningKey
+	usedNonces    map[string]time.Time
+}
+
+// signupRecord is a signup with the hashed fraud signals used for risk counts.
+type signupRecord struct {
+	domain.Signup
+	ipHash      string
+	fingerprint string
+}
+
+// apiKeyRecord is an API key with the hash it's authenticated by.
+type apiKeyRecord struct {
+	domain.APIKey
+	hash string
+}
+
+// challengeRecord is a sign in challenge and whether it has been used.
+type challengeRecord struct {
+	domain.Challenge
+	used bool
+}
+
+// refreshTokenRecord is a hashed refresh token bound to an address.
+type refreshTokenRecord struct {
+	hash      string
+	address   string
+	expiresAt time.Time
+	revoked   bool
+}
+
+// NewStore creates an empty in-memory store. Review claims expire after a claim TTL.
+func NewStore(claimTTL time.Duration) *Store {
+	return &Store{
+		claimTTL:      claimTTL,
+		revokedTokens: make(map[string]time.Time),
+		usedNonces:    make(map[string]time.Time),
+	}
+}
+
+// The current time at the second precision databases store timestamps with.
+func now() time.Time {
+	return time.Unix(time.Now().Unix(), 0)
+}
+
+// Truncate a time to the second precision databases store timestamps with.
+func truncate(t time.Time) time.Time {
+	return time.Unix(t.Unix(), 0)
+}
+
+// Get a named record by ID from a slice indexed by ID-1.
+func lookup[T any](records []T, name string, id uint64) (*T, error) {
+	if id == 0 || id > uint64(len(records)) {
+		return nil, domain.NewError(domain.ErrNotFound, "%s %d not found", name, id)
+	}
+	return &records[id-1], nil
+}
+
+// Get a page of records after a cursor ID matching a filter, in ID order.
+func page[T any](records []T, cursor uint64, limit int, match func(T) bool) (matches []T) {
+	for i := min(cursor, uint64(len(records))); i < uint64(len(records)) && len(matches) < limit; i++ {
+		if match(records[i]) {
+			matches = append(matches, records[i])
+		}
+	}
+	return
+}
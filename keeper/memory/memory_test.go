@@ -0,0 +1,80 @@
+package memory_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/keeper/keepertest"
+	"github.com/carp-cobain/referrals/keeper/memory"
+)
+
+func TestConformance(t *testing.T) {
+	keepertest.Run(t, func(t *testing.T) keepertest.Keepers {
+		store := memory.NewStore(time.Minute)
+		return keepertest.Keepers{
+			Campaigns:   store,
+			Signups:     store,
+			Risk:        store,
+			Touches:     store,
+			Reviews:     store,
+			APIKeys:     store,
+			Sessions:    store,
+			SigningKeys: store,
+			Nonces:      store,
+			Imports:     store,
+		}
+	})
+}
+
+func TestConcurrentSignups(t *testing.T) {
+	store := memory.NewStore(time.Minute)
+	campaign, err := store.CreateCampaign("tp1memory0referer0000000000000000000000000", "Memory", domain.CampaignOptions{})
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.CreateSignup(campaign.ID, "tp1memory0referee", domain.SignupMeta{}); err == nil {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if created.Load() != 1 {
+		t.Fatalf("expected exactly one signup for an address, got: %d", created.Load())
+	}
+}
+
+func TestCopiedRecords(t *testing.T) {
+	store := memory.NewStore(time.Minute)
+	options := domain.CampaignOptions{UTM: domain.Params{"utm_source": "memory"}}
+	campaign, err := store.CreateCampaign("tp1memory0referer0000000000000000000000000", "Memory", options)
+	if err != nil {
+		t.Fatalf("failed to create campaign: %+v", err)
+	}
+	campaign.UTM["utm_source"] = "changed"
+	meta := domain.SignupMeta{Params: domain.Params{"ref": "memory"}}
+	signup, err := store.CreateSignup(campaign.ID, "tp1memory0referee", meta)
+	if err != nil {
+		t.Fatalf("failed to create signup: %+v", err)
+	}
+	signup.Params["ref"] = "changed"
+	// Changing records returned by reads doesn't change stored records either.
+	read, _ := store.GetCampaign(campaign.ID)
+	read.UTM["utm_source"] = "changed"
+	_, signups := store.GetSignups(campaign.ID, 0, 10)
+	signups[0].Params["ref"] = "changed"
+	if read, _ := store.GetCampaign(campaign.ID); read.UTM["utm_source"] != "memory" {
+		t.Fatalf("expected stored campaign to be unchanged, got: %+v", read.UTM)
+	}
+	if _, signups := store.GetSignups(campaign.ID, 0, 10); signups[0].Params["ref"] != "memory" {
+		t.Fatalf("expected stored signup to be unchanged, got: %+v", signups[0].Params)
+	}
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// GetSignup gets a signup by ID.
+func (self *Store) GetSignup(signupID uint64) (domain.Signup, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	signup, err := lookup(self.signups, "signup", signupID)
+	if err != nil {
+		return domain.Signup{}, err
+	}
+	return cloneSignup(signup.Signup), nil
+}
+
+// GetReviewQueue gets a page of flagged signups available to a reviewer, highest risk first,
+// after the signup with the cursor ID. The next cursor is the ID of the last signup.
+func (self *Store) GetReviewQueue(reviewer string, cursor uint64, limit int) (next uint64, signups []domain.Signup) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var after *signupRecord
+	if cursor > 0 {
+		var err error
+		if after, err = lookup(self.signups, "signup", cursor); err != nil {
+			return 0, []domain.Signup{}
+		}
+	}
+	signups = []domain.Signup{}
+	for _, signup := range self.signups {
+		if signup.Status != domain.SignupFlagged || !self.claimable(signup, reviewer) {
+			continue
+		}
+		if after != nil && (signup.RiskScore > after.RiskScore ||
+			(signup.RiskScore == after.RiskScore && signup.ID <= after.ID)) {
+			continue
+		}
+		signups = append(signups, cloneSignup(signup.Signup))
+	}
+	sort.SliceStable(signups, func(i, j int) bool { return signups[i].RiskScore > signups[j].RiskScore })
+	signups = signups[:min(limit, len(signups))]
+	if len(signups) > 0 {
+		next = signups[len(signups)-1].ID
+	}
+	return
+}
+
+// ClaimSignup claims a flagged signup for a reviewer, so other reviewers skip it.
+func (self *Store) ClaimSignup(signupID uint64, reviewer string) (domain.Signup, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	signup, err := lookup(self.signups, "signup", signupID)
+	if err != nil || signup.Status != domain.SignupFlagged || !self.claimable(*signup, reviewer) {
+		return domain.Signup{}, domain.NewError(domain.ErrConflict, "signup %d is not available for review", signupID)
+	}
+	claimedAt := now()
+	signup.ClaimedBy, signup.ClaimedAt, signup.UpdatedAt = reviewer, &claimedAt, claimedAt
+	return cloneSignup(signup.Signup), nil
+}
+
+// UnclaimSignup releases a reviewer's claim on a signup.
+func (self *Store) UnclaimSignup(signupID uint64, reviewer string) (domain.Signup, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	signup, err := lookup(self.signups, "signup", signupID)
+	if err != nil || signup.ClaimedBy != reviewer {
+		return domain.Signup{}, domain.NewError(domain.ErrConflict, "signup %d is not claimed by reviewer", signupID)
+	}
+	signup.ClaimedBy, signup.ClaimedAt, signup.UpdatedAt = "", nil, now()
+	return cloneSignup(signup.Signup), nil
+}
+
+// ReviewSignup approves or rejects a flagged signup claimed by a reviewer.
+func (self *Store) ReviewSignup(signupID uint64, reviewer, status string) (domain.Signup, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	signup, err := lookup(self.signups, "signup", signupID)
+	if err != nil {
+		return domain.Signup{}, err
+	}
+	if signup.Status != domain.SignupFlagged {
+		return domain.Signup{}, domain.NewError(domain.ErrConflict, "signup %d is not flagged for review", signupID)
+	}
+	if signup.ClaimedBy != reviewer || self.claimExpired(*signup) {
+		return domain.Signup{}, domain.NewError(domain.ErrConflict, "signup %d must be claimed before review", signupID)
+	}
+	if err := domain.ValidateReviewTransition(signup.Status, status); err != nil {
+		return domain.Signup{}, err
+	}
+	self.changeSignupStatus(signup, status, reviewer)
+	return cloneSignup(signup.Signup), nil
+}
+
+// GetSignupHistory gets the status history of a signup.
+func (self *Store) GetSignupHistory(signupID uint64) []domain.SignupEvent {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	events := []domain.SignupEvent{}
+	for _, event := range self.signupEvents {
+		if event.SignupID == signupID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Check whether a signup is unclaimed, claimed by a reviewer or has an expired claim.
+func (self *Store) claimable(signup signupRecord, reviewer string) bool {
+	return signup.ClaimedBy == "" || signup.ClaimedBy == reviewer || self.claimExpired(signup)
+}
+
+// Check whether a signup's review claim has expired.
+func (self *Store) claimExpired(signup signupRecord) bool {
+	return signup.ClaimedAt == nil || signup.ClaimedAt.Before(self.claimExpiry())
+}
+
+// Claims made before this time have expired.
+func (self *Store) claimExpiry() time.Time {
+	return time.Now().Add(-self.claimTTL)
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// CreateChallenge creates a one time sign in challenge for an address.
+func (self *Store) CreateChallenge(address string, ttl time.Duration) (domain.Challenge, error) {
+	nonce, err := auth.RandomToken(16)
+	if err != nil {
+		return domain.Challenge{}, fmt.Errorf("CreateChallenge: %s", err.Error())
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	expiresAt := truncate(time.Now().Add(ttl))
+	challenge := domain.Challenge{
+		Nonce:     nonce,
+		Address:   address,
+		Message:   auth.ChallengeMessage(address, nonce, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	self.challenges = append(self.challenges, challengeRecord{Challenge: challenge})
+	return challenge, nil
+}
+
+// UseChallenge consumes a sign in challenge, so it can only be used once.
+func (self *Store) UseChallenge(nonce, address string) (domain.Challenge, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for i := range self.challenges {
+		challenge := &self.challenges[i]
+		if challenge.Nonce != nonce || challenge.Address != address {
+			continue
+		}
+		if challenge.used || !challenge.ExpiresAt.After(now()) {
+			return domain.Challenge{}, domain.NewError(domain.ErrForbidden, "challenge expired or already used")
+		}
+		challenge.used = true
+		return challenge.Challenge, nil
+	}
+	return domain.Challenge{}, domain.NewError(domain.ErrForbidden, "invalid challenge")
+}
+
+// CreateRefreshToken creates a refresh token for an address. Only its hash is stored.
+func (self *Store) CreateRefreshToken(address string, ttl time.Duration) (string, time.Time, error) {
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("CreateRefreshToken: %s", err.Error())
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	expiresAt := time.Now().Add(ttl)
+	self.refreshTokens = append(self.refreshTokens, refreshTokenRecord{
+		hash:      auth.HashRefreshToken(token),
+		address:   address,
+		expiresAt: truncate(expiresAt),
+	})
+	return token, expiresAt, nil
+}
+
+// RotateRefreshToken revokes a refresh token and returns the address it was bound to.
+// Reusing a revoked refresh token revokes every refresh token for the address.
+func (self *Store) RotateRefreshToken(token string) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	refreshToken := self.refreshToken(token)
+	if refreshToken == nil {
+		return "", domain.NewError(domain.ErrForbidden, "invalid refresh token")
+	}
+	if refreshToken.expiresAt.Before(time.Now()) {
+		return "", domain.NewError(domain.ErrForbidden, "refresh token expired")
+	}
+	if refreshToken.revoked {
+		for i := range self.refreshTokens {
+			if self.refreshTokens[i].address == refreshToken.address {
+				self.refreshTokens[i].revoked = true
+			}
+		}
+		return "", domain.NewError(domain.ErrForbidden, "refresh token reused; all sessions revoked")
+	}
+	refreshToken.revoked = true
+	return refreshToken.address, nil
+}
+
+// RevokeRefreshToken revokes a refresh token for an address.
+func (self *Store) RevokeRefreshToken(address, token string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	refreshToken := self.refreshToken(token)
+	if refreshToken == nil || refreshToken.address != address {
+		return domain.NewError(domain.ErrValidation, "invalid refresh token")
+	}
+	refreshToken.revoked = true
+	return nil
+}
+
+// RevokeAccessToken denies an access token by ID until it expires.
+func (self *Store) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.revokedTokens[jti]; !ok {
+		self.revokedTokens[jti] = truncate(expiresAt)
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked checks whether an access token has been revoked.
+func (self *Store) IsAccessTokenRevoked(jti string) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	_, ok := self.revokedTokens[jti]
+	return ok
+}
+
+// GetSigningKeys gets all signing keys that haven't been retired.
+func (self *Store) GetSigningKeys() []domain.SigningKey {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	keys := []domain.SigningKey{}
+	for _, key := range self.signingKeys {
+		if key.RetiredAt == nil || key.RetiredAt.After(now()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RotateSigningKey creates a new signing key and schedules existing keys to retire
+// after a grace period, so tokens they signed can still be verified until they expire.
+func (self *Store) RotateSigningKey(grace time.Duration) (domain.SigningKey, error) {
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		return domain.SigningKey{}, fmt.Errorf("RotateSigningKey: %s", err.Error())
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	retireAt := truncate(time.Now().Add(grace))
+	for i := range self.signingKeys {
+		if self.signingKeys[i].RetiredAt == nil {
+			self.signingKeys[i].RetiredAt = &retireAt
+		}
+	}
+	key.CreatedAt = now()
+	self.signingKeys = append(self.signingKeys, key)
+	return key, nil
+}
+
+// UseNonce consumes a one time token nonce, so the token can't be replayed.
+func (self *Store) UseNonce(nonce string, expiresAt time.Time) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.usedNonces[nonce]; ok {
+		return domain.NewError(domain.ErrConflict, "token already used")
+	}
+	self.usedNonces[nonce] = truncate(expiresAt)
+	return nil
+}
+
+// Get a refresh token by its plaintext token.
+func (self *Store) refreshToken(token string) *refreshTokenRecord {
+	hash := auth.HashRefreshToken(token)
+	for i := range self.refreshTokens {
+		if self.refreshTokens[i].hash == hash {
+			return &self.refreshTokens[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// GetSignups gets a page of signups for a referral campaign.
+func (self *Store) GetSignups(
+	campaignID, cursor uint64, limit int) (next uint64, signups []domain.Signup) {
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	records := page(self.signups, cursor, limit, func(signup signupRecord) bool {
+		return signup.CampaignID == campaignID
+	})
+	signups = make([]domain.Signup, len(records))
+	for i, record := range records {
+		signups[i] = cloneSignup(record.Signup)
+		next = max(next, record.ID)
+	}
+	return
+}
+
+// CreateSignup creates a signup for a referral campaign, consuming any referral token nonce.
+// High risk signups are flagged for manual review. Returns domain.ErrAlreadyReferred if the
+// address has already signed up.
+func (self *Store) CreateSignup(
+	campaignID uint64, address string, meta domain.SignupMeta) (domain.Signup, error) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	campaign, err := lookup(self.campaigns, "campaign", campaignID)
+	if err != nil {
+		return domain.Signup{}, err
+	}
+	if campaign.Address == address {
+		return domain.Signup{}, domain.NewError(domain.ErrValidation, "self referral error: %s", address)
+	}
+	if self.signupExists(address) {
+		return domain.Signup{}, fmt.Errorf("%w: %s", domain.ErrAlreadyReferred, address)
+	}
+	if meta.Nonce != nil {
+		if _, ok := self.usedNonces[meta.Nonce.Value]; ok {
+			return domain.Signup{}, domain.NewError(domain.ErrConflict, "token already used")
+		}
+		self.usedNonces[meta.Nonce.Value] = truncate(meta.Nonce.ExpiresAt)
+	}
+	risk := meta.Risk
+	status := domain.SignupPending
+	if risk.Flagged {
+		status = domain.SignupFlagged
+	}
+	signup := self.insertSignup(signupRecord{
+		Signup: domain.Signup{
+			CampaignID:  campaignID,
+			Address:     address,
+			Status:      status,
+			RiskScore:   risk.Score,
+			RiskReasons: append([]string{}, risk.Reasons...),
+			VisitorID:   meta.VisitorID,
+			Params:      cloneParams(meta.Params),
+		},
+		ipHash:      risk.IPHash,
+		fingerprint: risk.Fingerprint,
+	})
+	return cloneSignup(signup.Signup), nil
+}
+
+// UpdateSignup updates the status of a signup for a referral campaign.
+func (self *Store) UpdateSignup(
+	campaignID, signupID uint64, status, actor string) (domain.Signup, error) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	signup, err := lookup(self.signups, "signup", signupID)
+	if err != nil {
+		return domain.Signup{}, err
+	}
+	if signup.CampaignID != campaignID {
+		return domain.Signup{}, domain.NewError(domain.ErrValidation, "invalid campaign: %d", campaignID)
+	}
+	if err := self.transitionSignup(signup, status, actor); err != nil {
+		return domain.Signup{}, err
+	}
+	return cloneSignup(signup.Signup), nil
+}
+
+// ExportSignups gets a page of signups with campaign details for exports. A zero campaign
+// ID exports signups for all campaigns and an empty status exports all statuses.
+func (self *Store) ExportSignups(
+	campaignID uint64, status string, cursor uint64, limit int) (next uint64, signups []domain.SignupExport, err error) {
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	records := page(self.signups, cursor, limit, func(signup signupRecord) bool {
+		return (campaignID == 0 || signup.CampaignID == campaignID) && (status == "" || signup.Status == status)
+	})
+	signups = make([]domain.SignupExport, len(records))
+	for i, record := range records {
+		campaign := self.campaigns[record.CampaignID-1]
+		signups[i] = domain.SignupExport{
+			Signup:          cloneSignup(record.Signup),
+			CampaignName:    campaign.Name,
+			CampaignAddress: campaign.Address,
+		}
+		next = max(next, record.ID)
+	}
+	return
+}
+
+// CountRecentSignups counts signups for a campaign created since a time.
+func (self *Store) CountRecentSignups(campaignID uint64, since time.Time) int64 {
+	return self.countSignups(func(signup signupRecord) bool {
+		return signup.CampaignID == campaignID && signup.CreatedAt.Unix() >= since.Unix()
+	})
+}
+
+// CountSharedIP counts signups for a campaign from the same hashed client IP.
+func (self *Store) CountSharedIP(campaignID uint64, ipHash string) int64 {
+	if ipHash == "" {
+		return 0
+	}
+	return self.countSignups(func(signup signupRecord) bool {
+		return signup.CampaignID == campaignID && signup.ipHash == ipHash
+	})
+}
+
+// CountSharedFingerprint counts signups for a campaign with the same client fingerprint.
+func (self *Store) CountSharedFingerprint(campaignID uint64, fingerprint string) int64 {
+	if fingerprint == "" {
+		return 0
+	}
+	return self.countSignups(func(signup signupRecord) bool {
+		return signup.CampaignID == campaignID && signup.fingerprint == fingerprint
+	})
+}
+
+// CountOwnedCampaigns counts campaigns owned by an address.
+func (self *Store) CountOwnedCampaigns(address string) (count int64) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for _, campaign := range self.campaigns {
+		if campaign.Address == address {
+			count++
+		}
+	}
+	return
+}
+
+// Count signups matching a filter.
+func (self *Store) countSignups(match func(signupRecord) bool) (count int64) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for _, signup := range self.signups {
+		if match(signup) {
+			count++
+		}
+	}
+	return
+}
+
+// Check whether an address has already signed up for any campaign.
+func (self *Store) signupExists(address string) bool {
+	for _, signup := range self.signups {
+		if signup.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy a signup so callers can't change the stored record.
+func cloneSignup(signup domain.Signup) domain.Signup {
+	signup.RiskReasons = slices.Clone(signup.RiskReasons)
+	signup.Params = cloneParams(signup.Params)
+	if signup.ClaimedAt != nil {
+		claimedAt := *signup.ClaimedAt
+		signup.ClaimedAt = &claimedAt
+	}
+	return signup
+}
+
+// Insert a signup, assigning its ID and timestamps.
+func (self *Store) insertSignup(signup signupRecord) signupRecord {
+	signup.ID = uint64(len(self.signups) + 1)
+	signup.CreatedAt = now()
+	signup.UpdatedAt = signup.CreatedAt
+	if signup.RiskReasons == nil {
+		signup.RiskReasons = []string{}
+	}
+	self.signups = append(self.signups, signup)
+	return signup
+}
+
+// Change the status of a signup when the transition is allowed, releasing any review claim
+// and recording the change and actor in the signup history.
+func (self *Store) transitionSignup(signup *signupRecord, status, actor string) error {
+	if err := domain.ValidateSignupTransition(signup.Status, status); err != nil {
+		return err
+	}
+	self.changeSignupStatus(signup, status, actor)
+	return nil
+}
+
+// Change the status of a signup without checking the transition, releasing any review claim
+// and recording the change and actor in the signup history.
+func (self *Store) changeSignupStatus(signup *signupRecord, status, actor string) {
+	from := signup.Status
+	if from == status {
+		return
+	}
+	signup.Status, signup.ClaimedBy, signup.ClaimedAt, signup.UpdatedAt = status, "", nil, now()
+	self.signupEvents = append(self.signupEvents, domain.SignupEvent{
+		ID:         uint64(len(self.signupEvents) + 1),
+		SignupID:   signup.ID,
+		FromStatus: from,
+		ToStatus:   status,
+		Actor:      actor,
+		CreatedAt:  now(),
+	})
+}
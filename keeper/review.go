@@ -0,0 +1,13 @@
+package keeper
+
+import "github.com/carp-cobain/referrals/domain"
+
+// ReviewKeeper manages the manual review queue for flagged signups
+type ReviewKeeper interface {
+	GetSignup(signupID uint64) (domain.Signup, error)
+	GetReviewQueue(reviewer string, cursor uint64, limit int) (uint64, []domain.Signup)
+	ClaimSignup(signupID uint64, reviewer string) (domain.Signup, error)
+	UnclaimSignup(signupID uint64, reviewer string) (domain.Signup, error)
+	ReviewSignup(signupID uint64, reviewer, status string) (domain.Signup, error)
+	GetSignupHistory(signupID uint64) []domain.SignupEvent
+}
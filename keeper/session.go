@@ -0,0 +1,34 @@
+package keeper
+
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
+
+// SessionKeeper manages sign in challenges and session tokens
+type SessionKeeper interface {
+	SessionReader
+	CreateChallenge(address string, ttl time.Duration) (domain.Challenge, error)
+	UseChallenge(nonce, address string) (domain.Challenge, error)
+	CreateRefreshToken(address string, ttl time.Duration) (string, time.Time, error)
+	RotateRefreshToken(token string) (string, error)
+	RevokeRefreshToken(address, token string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+}
+
+// SessionReader checks access token revocation
+type SessionReader interface {
+	IsAccessTokenRevoked(jti string) bool
+}
+
+// SigningKeyKeeper manages session token signing keys
+type SigningKeyKeeper interface {
+	GetSigningKeys() []domain.SigningKey
+	RotateSigningKey(grace time.Duration) (domain.SigningKey, error)
+}
+
+// NonceKeeper consumes one time token nonces
+type NonceKeeper interface {
+	UseNonce(nonce string, expiresAt time.Time) error
+}
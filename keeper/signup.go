@@ -1,10 +1,30 @@
 package keeper
 
-import "github.com/carp-cobain/referrals/domain"
+import (
+	"time"
+
+	"github.com/carp-cobain/referrals/domain"
+)
 
 // SignupKeeper manages referral campaign signups
 type SignupKeeper interface {
 	GetSignups(campaignID, cursor uint64, limit int) (uint64, []domain.Signup)
-	CreateSignup(campaignID uint64, address string) (domain.Signup, error)
-	UpdateSignup(campaignID, signupID uint64, status string) (domain.Signup, error)
+	CreateSignup(campaignID uint64, address string, meta domain.SignupMeta) (domain.Signup, error)
+	UpdateSignup(campaignID, signupID uint64, status, actor string) (domain.Signup, error)
+	ExportSignups(campaignID uint64, status string, cursor uint64, limit int) (uint64, []domain.SignupExport, error)
+}
+
+// RiskReader reads signup history used to score signup fraud risk
+type RiskReader interface {
+	CountRecentSignups(campaignID uint64, since time.Time) int64
+	CountSharedIP(campaignID uint64, ipHash string) int64
+	CountSharedFingerprint(campaignID uint64, fingerprint string) int64
+	CountOwnedCampaigns(address string) int64
+}
+
+// TouchKeeper records referral link clicks for attribution
+type TouchKeeper interface {
+	RecordTouch(visitorID string, campaignID uint64, params domain.Params) (domain.Touch, error)
+	RecordFilteredHits(hits map[uint64]uint64) error
+	GetTouches(visitorID string, since time.Time) []domain.Touch
 }
@@ -1,22 +1,55 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/bot"
+	"github.com/carp-cobain/referrals/config"
 	"github.com/carp-cobain/referrals/database"
 	"github.com/carp-cobain/referrals/database/repo"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/fraud"
 	"github.com/carp-cobain/referrals/handler"
+	"github.com/carp-cobain/referrals/importer"
+	"github.com/carp-cobain/referrals/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	if _, ok := os.LookupEnv("DISABLE_COLOR"); ok {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	// Config
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err = errors.Join(err, cfg.Validate()); err != nil {
+		log.Fatalf("invalid config:\n%s", err)
+	}
+	settings, err := newSettings(cfg)
+	if err != nil {
+		log.Fatalf("invalid config:\n%s", err)
+	}
+	if cfg.Server.DisableColor {
 		gin.DisableConsoleColor()
 	}
 
 	// DB
-	readDB, writeDB, err := database.ConnectAndMigrate()
+	readDB, writeDB, err := database.ConnectAndMigrate(cfg.Database)
 	if err != nil {
 		log.Panicf("unable to connnect to db: %+v", err)
 	}
@@ -24,31 +57,149 @@ func main() {
 	// Repos
 	campaignRepo := repo.NewCampaignRepo(readDB, writeDB)
 	signupRepo := repo.NewSignupRepo(readDB, writeDB)
+	importRepo := repo.NewImportRepo(writeDB)
+	apiKeyRepo := repo.NewAPIKeyRepo(readDB, writeDB)
+	keyCipher, err := auth.NewKeyCipher(cfg.Session.KeyEncryptionKey)
+	if err != nil {
+		log.Panicf("unable to create signing key cipher: %+v", err)
+	}
+	sessionRepo := repo.NewSessionRepo(readDB, writeDB, keyCipher)
+	reviewRepo := repo.NewReviewRepo(readDB, writeDB, cfg.Review.ClaimTTL)
+	touchRepo := repo.NewTouchRepo(readDB, writeDB)
+
+	// Session signing keys
+	if len(sessionRepo.GetSigningKeys()) == 0 {
+		if _, err := sessionRepo.RotateSigningKey(0); err != nil {
+			log.Panicf("unable to create session signing key: %+v", err)
+		}
+	}
+	keySet := auth.NewKeySet(sessionRepo.GetSigningKeys)
 
 	// Handlers
-	campaignHandler := handler.NewCampaignHandler(campaignRepo)
-	redirectHandler := handler.NewRedirectHandler(campaignRepo, signupRepo)
-	signupHandler := handler.NewSignupHandler(campaignRepo, signupRepo)
+	paging := handler.Paging{DefaultLimit: cfg.Paging.DefaultLimit, MaxLimit: cfg.Paging.MaxLimit}
+	sessionOptions := handler.SessionOptions{
+		ChallengeTTL:    cfg.Session.ChallengeTTL,
+		AccessTokenTTL:  cfg.Session.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Session.RefreshTokenTTL,
+	}
+	authHandler := handler.NewAuthHandler(apiKeyRepo, sessionRepo, sessionRepo, keySet)
+	sessionHandler := handler.NewSessionHandler(sessionRepo, sessionRepo, keySet, sessionOptions)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyRepo, paging)
+	liveSettings := handler.NewLive(settings)
+	configHandler := handler.NewConfigHandler(liveSettings)
+	campaignHandler := handler.NewCampaignHandler(campaignRepo, liveSettings, paging)
+	scorer := fraud.NewScorer(signupRepo, fraud.DefaultRules, []byte(cfg.Fraud.HashSecret))
+	hitCounter := bot.NewHitCounter(touchRepo.RecordFilteredHits, 10*time.Second)
+	redirectHandler := handler.NewRedirectHandler(
+		campaignRepo,
+		signupRepo,
+		touchRepo,
+		hitCounter,
+		scorer,
+		liveSettings,
+	)
+	signupHandler := handler.NewSignupHandler(campaignRepo, signupRepo, scorer, paging)
+	reviewHandler := handler.NewReviewHandler(reviewRepo, touchRepo, liveSettings, paging)
+	exportHandler := handler.NewExportHandler(campaignRepo, signupRepo)
+	qrHandler := handler.NewQRHandler(campaignRepo, cfg.Server.BaseURL)
+	importHandler := handler.NewImportHandler(importer.NewImporter(importRepo, 0))
+
+	// Database maintenance
+	maintainer := database.NewMaintainer(readDB, writeDB, cfg.Maintenance, cfg.Database.Replicated)
+	maintenanceHandler := handler.NewMaintenanceHandler(maintainer)
+	maintainer.Start()
+
+	// Rate limits
+	rateLimitStore := ratelimit.NewMemoryStore(10 * time.Minute)
+	rateLimiter := handler.NewRateLimiter(rateLimitStore, liveSettings)
+	redirectLimit := rateLimiter.Limit("redirect")
+	signupLimit := rateLimiter.Limit("signup")
+	writeLimit := rateLimiter.Limit("write")
+	signedLimit := rateLimiter.LimitSigned("signed")
+
+	// Config reloads
+	done := make(chan struct{})
+	go reloader{os.Args[1:], liveSettings}.watch(5*time.Second, done)
 
 	// Router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Logger(), handler.Recovery())
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Panicf("unable to set trusted proxies: %+v", err)
+	}
+	r.Use(handler.RequestID())
+	if cfg.Server.LegacyErrors {
+		r.Use(handler.LegacyErrors())
+	}
 
 	// Signup redirects
-	r.GET("/referrals", redirectHandler.Referrals)
-	r.GET("/referrals/:id/signup", redirectHandler.Signup)
+	r.GET("/referrals", redirectLimit, redirectHandler.Referrals)
+	r.GET("/referrals/:id/signup", redirectLimit, redirectHandler.Signup)
+	r.HEAD("/referrals/:id/signup", redirectLimit, redirectHandler.Signup)
+	r.POST("/referrals/claim", signupLimit, redirectHandler.Claim)
+
+	// Session key set
+	r.GET("/.well-known/jwks.json", sessionHandler.GetJWKS)
 
 	// API
-	v1 := r.Group("/referrals/api/v1")
+	scope := authHandler.RequireScope
+	v1 := r.Group("/referrals/api/v1", signedLimit, authHandler.Authenticate)
 	{
 		v1.GET("/campaigns", campaignHandler.GetCampaigns)
-		v1.POST("/campaigns", campaignHandler.CreateCampaign)
+		v1.POST("/campaigns", writeLimit, campaignHandler.CreateCampaign)
 		v1.GET("/campaigns/:id", campaignHandler.GetCampaign)
+		v1.GET("/campaigns/:id/qr.png", qrHandler.GetPNG)
+		v1.GET("/campaigns/:id/qr.svg", qrHandler.GetSVG)
 		v1.GET("/campaigns/:id/signups", signupHandler.GetSignups)
-		v1.POST("/campaigns/:id/signups", signupHandler.CreateSignup)
-		v1.PATCH("/campaigns/:id/signups/:sid", signupHandler.UpdateSignup)
+		v1.POST("/campaigns/:id/signups", signupLimit, scope(domain.ScopeSignupsWrite), signupHandler.CreateSignup)
+		v1.PATCH("/campaigns/:id/signups/:sid", writeLimit, scope(domain.ScopeSignupsVerify), signupHandler.UpdateSignup)
+		v1.GET("/campaigns/:id/signups/export", exportHandler.ExportSignups)
+		v1.GET("/signups/export", scope(domain.ScopeAdmin), exportHandler.ExportAllSignups)
+		v1.GET("/review/signups", scope(domain.ScopeSignupsVerify), reviewHandler.GetReviewQueue)
+		v1.POST("/review/signups/:sid/claim", scope(domain.ScopeSignupsVerify), reviewHandler.ClaimSignup)
+		v1.DELETE("/review/signups/:sid/claim", scope(domain.ScopeSignupsVerify), reviewHandler.UnclaimSignup)
+		v1.POST("/review/signups/:sid/approve", scope(domain.ScopeSignupsVerify), reviewHandler.ApproveSignup)
+		v1.POST("/review/signups/:sid/reject", scope(domain.ScopeSignupsVerify), reviewHandler.RejectSignup)
+		v1.GET("/review/signups/:sid/history", scope(domain.ScopeSignupsVerify), reviewHandler.GetSignupHistory)
+		v1.GET("/review/signups/:sid/touches", scope(domain.ScopeSignupsVerify), reviewHandler.GetSignupTouches)
+		v1.POST("/import", scope(domain.ScopeAdmin), importHandler.Import)
+		v1.POST("/auth/challenge", writeLimit, sessionHandler.CreateChallenge)
+		v1.POST("/auth/token", writeLimit, sessionHandler.CreateSession)
+		v1.POST("/auth/refresh", writeLimit, sessionHandler.RefreshSession)
+		v1.POST("/auth/revoke", sessionHandler.RevokeSession)
+		v1.POST("/auth/keys/rotate", scope(domain.ScopeAdmin), sessionHandler.RotateSigningKey)
+		v1.GET("/config", scope(domain.ScopeAdmin), configHandler.GetConfig)
+		v1.GET("/maintenance", scope(domain.ScopeAdmin), maintenanceHandler.GetMaintenanceTasks)
+		v1.POST("/maintenance/:task/run", scope(domain.ScopeAdmin), maintenanceHandler.RunMaintenanceTask)
+		v1.GET("/metrics", scope(domain.ScopeAdmin), maintenanceHandler.GetMetrics)
+		v1.GET("/keys", scope(domain.ScopeAdmin), apiKeyHandler.GetAPIKeys)
+		v1.POST("/keys", scope(domain.ScopeAdmin), apiKeyHandler.CreateAPIKey)
+		v1.DELETE("/keys/:kid", scope(domain.ScopeAdmin), apiKeyHandler.RevokeAPIKey)
 	}
 
-	if err := r.Run(); err != nil {
-		log.Panicf("unable to start referral server:  %+v", err)
+	// Serve until SIGTERM or SIGINT, then shut down background work and close the db
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.Port))
+	if err != nil {
+		log.Panicf("unable to listen: %+v", err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	serveErr := serve(&http.Server{Handler: r}, listener, stop, cfg.Server.ShutdownTimeout)
+	signal.Stop(stop)
+	if serveErr != nil {
+		log.Printf("referral server failed: %+v", serveErr)
+	}
+	close(done)
+	rateLimitStore.Close()
+	if err := hitCounter.Close(); err != nil {
+		log.Print(err.Error())
+	}
+	maintainer.Stop()
+	closeDatabase(serveErr, func() error {
+		return database.Close(readDB, writeDB, cfg.Database.Replicated)
+	})
+	log.Printf("referral server stopped")
+	if serveErr != nil {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+
+	"github.com/carp-cobain/referrals/auth"
+	"github.com/carp-cobain/referrals/bot"
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/domain"
+	"github.com/carp-cobain/referrals/handler"
+)
+
+// Build a snapshot of the reloadable settings from validated config. Returns every problem
+// found.
+func newSettings(cfg config.Config) (handler.Settings, error) {
+	options, err := newRedirectOptions(cfg)
+	if err != nil {
+		return handler.Settings{}, err
+	}
+	limits, err := cfg.Limits()
+	if err != nil {
+		return handler.Settings{}, err
+	}
+	return handler.Settings{Config: cfg, Redirect: options, Limits: limits}, nil
+}
+
+// Build referral redirect options from validated config, loading the preview template and
+// bot rules files. Returns every problem found.
+func newRedirectOptions(cfg config.Config) (handler.RedirectOptions, error) {
+	var errs []error
+	options := handler.RedirectOptions{
+		SignupURL:         cfg.Signup.URL,
+		CookiePath:        cfg.Signup.CookiePath,
+		CookieDomain:      cfg.Signup.CookieDomain,
+		CookieMaxAge:      cfg.Signup.CookieMaxAge,
+		Attribution:       cfg.Redirect.Attribution,
+		PassthroughParams: cfg.Redirect.PassthroughParams,
+		Allowlist:         redirectAllowlist(cfg),
+		DeepLinkSchemes:   cfg.Redirect.DeepLinkSchemes,
+		BaseURL:           cfg.Server.BaseURL,
+	}
+	if cfg.Redirect.TokenSecret != "" {
+		tokens, err := auth.NewReferralTokens(cfg.Redirect.TokenSecret, cfg.Redirect.TokenTTL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redirect.tokenSecret: %s", err.Error()))
+		}
+		options.Tokens = tokens
+	}
+	if path := cfg.Redirect.PreviewTemplate; path != "" {
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redirect.previewTemplate: %s", err.Error()))
+		}
+		options.Preview = tmpl
+	}
+	rules := bot.DefaultRules
+	if path := cfg.Redirect.BotRules; path != "" {
+		var err error
+		if rules, err = bot.LoadRules(path); err != nil {
+			errs = append(errs, fmt.Errorf("redirect.botRules: %s", err.Error()))
+		}
+	}
+	options.Bots = bot.NewClassifier(rules)
+	return options, errors.Join(errs...)
+}
+
+// Get the hosts referral redirects may send visitors to. The signup URL host is always allowed.
+func redirectAllowlist(cfg config.Config) domain.RedirectAllowlist {
+	var allowlist domain.RedirectAllowlist
+	if signupURL, err := url.Parse(cfg.Signup.URL); err == nil && signupURL.Hostname() != "" {
+		allowlist = append(allowlist, signupURL.Hostname())
+	}
+	return append(allowlist, cfg.Redirect.Allowlist...)
+}
@@ -0,0 +1,118 @@
+package qr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Bounds and defaults for rendering options
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+	DefaultLevel  = "M"
+)
+
+// levels maps error correction level names to encoder recovery levels
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options are QR code rendering options. Size is in pixels, margin is in modules.
+type Options struct {
+	Size   int
+	Margin int
+	Level  string
+}
+
+// DefaultOptions are the rendering options used when none are provided
+var DefaultOptions = Options{DefaultSize, DefaultMargin, DefaultLevel}
+
+// Validate ensures rendering options are in bounds.
+func (self Options) Validate() (Options, error) {
+	self.Level = strings.ToUpper(strings.TrimSpace(self.Level))
+	if self.Size < MinSize || self.Size > MaxSize {
+		return self, fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if self.Margin < 0 || self.Margin > MaxMargin {
+		return self, fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	if _, ok := levels[self.Level]; !ok {
+		return self, fmt.Errorf("level must be one of L, M, Q or H")
+	}
+	return self, nil
+}
+
+// Code is an encoded QR code ready for rendering.
+type Code struct {
+	modules [][]bool
+	options Options
+}
+
+// Encode content as a QR code with validated options.
+func Encode(content string, options Options) (Code, error) {
+	encoder, err := qrcode.New(content, levels[options.Level])
+	if err != nil {
+		return Code{}, err
+	}
+	encoder.DisableBorder = true
+	return Code{encoder.Bitmap(), options}, nil
+}
+
+// Width of the code in modules, including margins.
+func (self Code) width() int {
+	return len(self.modules) + 2*self.options.Margin
+}
+
+// Check whether the module at x, y (including margins) is dark.
+func (self Code) dark(x, y int) bool {
+	x, y = x-self.options.Margin, y-self.options.Margin
+	return y >= 0 && y < len(self.modules) && x >= 0 && x < len(self.modules[y]) && self.modules[y][x]
+}
+
+// PNG renders the code as a PNG image. Modules are scaled by a whole number of pixels, so
+// the image may be slightly smaller than the requested size.
+func (self Code) PNG(w io.Writer) error {
+	width := self.width()
+	scale := max(1, self.options.Size/width)
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, width*scale), palette)
+	for y := 0; y < width*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			if self.dark(x/scale, y/scale) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// SVG renders the code as an SVG image.
+func (self Code) SVG(w io.Writer) error {
+	width := self.width()
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		self.options.Size, self.options.Size, width, width)
+	fmt.Fprintf(out, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, width, width)
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			if self.dark(x, y) {
+				fmt.Fprintf(out, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	out.WriteString(`"/></svg>`)
+	return out.Flush()
+}
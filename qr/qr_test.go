@@ -0,0 +1,52 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/carp-cobain/referrals/qr"
+)
+
+func TestOptions(t *testing.T) {
+	if _, err := qr.DefaultOptions.Validate(); err != nil {
+		t.Fatalf("expected valid default options: %+v", err)
+	}
+	for _, options := range []qr.Options{
+		{Size: 10, Margin: 4, Level: "M"},
+		{Size: 256, Margin: -1, Level: "M"},
+		{Size: 256, Margin: 4, Level: "X"},
+	} {
+		if _, err := options.Validate(); err == nil {
+			t.Fatalf("expected invalid options: %+v", options)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	options := qr.Options{Size: 300, Margin: 2, Level: "h"}
+	options, _ = options.Validate()
+	code, err := qr.Encode("https://example.com/referrals/1/signup", options)
+	if err != nil {
+		t.Fatalf("failed to encode qr code: %+v", err)
+	}
+	var buf bytes.Buffer
+	if err := code.PNG(&buf); err != nil {
+		t.Fatalf("failed to render png: %+v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode png: %+v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() > 300 || bounds.Dx() < 150 {
+		t.Fatalf("got unexpected png size: %+v", bounds)
+	}
+	buf.Reset()
+	if err := code.SVG(&buf); err != nil {
+		t.Fatalf("failed to render svg: %+v", err)
+	}
+	if svg := buf.String(); !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `width="300"`) {
+		t.Fatalf("got unexpected svg: %s", svg)
+	}
+}
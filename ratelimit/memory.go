@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket for a single key.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore is an in-memory token bucket store for a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryStore creates an in-memory store that evicts buckets idle for longer than idle.
+func NewMemoryStore(idle time.Duration) *MemoryStore {
+	store := &MemoryStore{buckets: make(map[string]*bucket), done: make(chan struct{})}
+	go store.evict(idle)
+	return store
+}
+
+// Allow takes a token from the bucket for a key.
+func (self *MemoryStore) Allow(key string, limit Limit) (bool, time.Duration) {
+	now := time.Now()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	b, ok := self.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		self.buckets[key] = b
+	}
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Close stops evicting idle buckets.
+func (self *MemoryStore) Close() {
+	self.once.Do(func() { close(self.done) })
+}
+
+// Periodically remove buckets that haven't been used recently. An idle bucket has
+// refilled, so dropping it doesn't change rate limiting behavior.
+func (self *MemoryStore) evict(idle time.Duration) {
+	ticker := time.NewTicker(idle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case now := <-ticker.C:
+			self.mu.Lock()
+			for key, b := range self.buckets {
+				if now.Sub(b.updated) > idle {
+					delete(self.buckets, key)
+				}
+			}
+			self.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket refill rate in tokens per second with a max burst size.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store tracks token buckets by key.
+type Store interface {
+	// Allow takes a token from the bucket for a key, returning false and how long until
+	// a token is available when the bucket is empty.
+	Allow(key string, limit Limit) (bool, time.Duration)
+}
+
+// String formats a limit as rate/unit:burst
+func (self Limit) String() string {
+	return fmt.Sprintf("%s/s:%d", strconv.FormatFloat(self.Rate, 'f', -1, 64), self.Burst)
+}
+
+// ParseLimit parses a limit from a rate per unit with an optional burst, eg 10/s:20 or 100/m.
+// Burst defaults to the rate per unit rounded up.
+func ParseLimit(value string) (Limit, error) {
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(value), ":")
+	count, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected count/unit", value)
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: invalid count", value)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", value)
+	}
+	limit := Limit{Rate: n / per.Seconds(), Burst: int(math.Ceil(n))}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: invalid burst", value)
+		}
+	}
+	return limit, nil
+}
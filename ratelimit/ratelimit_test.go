@@ -0,0 +1,41 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carp-cobain/referrals/ratelimit"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("120/m:5")
+	if err != nil {
+		t.Fatalf("failed to parse limit: %+v", err)
+	}
+	if limit.Rate != 2 || limit.Burst != 5 {
+		t.Fatalf("got unexpected limit: %+v", limit)
+	}
+	for _, invalid := range []string{"10", "10/d", "x/s", "10/s:0", "NaN/s", "Inf/s", "-Inf/m"} {
+		if _, err := ratelimit.ParseLimit(invalid); err == nil {
+			t.Fatalf("expected invalid limit error: %s", invalid)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := ratelimit.NewMemoryStore(time.Minute)
+	defer store.Close()
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	for i := 0; i < limit.Burst; i++ {
+		if ok, _ := store.Allow("client", limit); !ok {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+	ok, retryAfter := store.Allow("client", limit)
+	if ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("expected request to be limited, retry after: %s", retryAfter)
+	}
+	if ok, _ := store.Allow("other", limit); !ok {
+		t.Fatalf("expected other client to be allowed")
+	}
+}
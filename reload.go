@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/carp-cobain/referrals/config"
+	"github.com/carp-cobain/referrals/handler"
+)
+
+// reloader reloads the runtime parts of config on SIGHUP or when the config file changes.
+type reloader struct {
+	args     []string
+	settings *handler.Live[handler.Settings]
+}
+
+// Reload config from the file, env vars and flags. Invalid config is rejected, leaving the
+// active config in place.
+func (self reloader) reload() error {
+	next, err := config.Load(self.args)
+	if err = errors.Join(err, next.Validate()); err != nil {
+		return err
+	}
+	active, ignored := self.settings.Load().Config.Reload(next)
+	settings, err := newSettings(active)
+	if err != nil {
+		return err
+	}
+	self.settings.Store(settings)
+	if len(ignored) > 0 {
+		log.Printf("config reloaded; changes to %s need a restart", strings.Join(ignored, ", "))
+	} else {
+		log.Printf("config reloaded")
+	}
+	return nil
+}
+
+// Watch for SIGHUP and config file changes, polling the file at an interval, until done.
+func (self reloader) watch(interval time.Duration, done <-chan struct{}) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	modified := self.modified()
+	for {
+		select {
+		case <-done:
+			return
+		case <-hangup:
+		case <-ticker.C:
+			latest := self.modified()
+			if latest.Equal(modified) {
+				continue
+			}
+			modified = latest
+		}
+		if err := self.reload(); err != nil {
+			log.Printf("config reload failed:\n%s", err)
+		}
+	}
+}
+
+// Get the modification time of the active config file, if any.
+func (self reloader) modified() time.Time {
+	path := self.settings.Load().Config.File
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
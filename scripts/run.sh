@@ -9,5 +9,7 @@ else
 	litestream restore -v -if-replica-exists -o "${DB_PATH}" "${REPLICA_URL}"
 fi
 
-# Run litestream with the app as the subprocess.
+# Run litestream with the app as the subprocess. Litestream forwards SIGTERM to the app and
+# keeps control of the WAL, so the app only runs passive checkpoints on shutdown.
+export DB_REPLICATED=true
 exec litestream replicate -exec "/usr/local/bin/referrals"
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Run an http server on a listener until a stop signal, then stop accepting connections and
+// wait up to a timeout for in-flight requests to finish. If requests are still running when
+// the timeout passes, the returned error wraps context.DeadlineExceeded.
+func serve(server *http.Server, listener net.Listener, stop <-chan os.Signal, timeout time.Duration) error {
+	failed := make(chan error, 1)
+	go func() {
+		log.Printf("referral server listening on %s", listener.Addr())
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-stop:
+		log.Printf("received %s; draining connections", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// Close the database once the server has stopped. If requests were still running when the
+// shutdown timed out, the database is left open: closing it under them would fail their
+// queries part way through, and the process exit cleans up after them instead.
+func closeDatabase(serveErr error, close func() error) {
+	if errors.Is(serveErr, context.DeadlineExceeded) {
+		log.Printf("requests still running after shutdown timeout; leaving db open")
+		return
+	}
+	if err := close(); err != nil {
+		log.Printf("unable to close db cleanly: %+v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Start serving a handler that blocks until released with a request in flight, returning the
+// channel serve's result is sent on.
+func startServer(
+	t *testing.T, release <-chan struct{}, stop <-chan os.Signal, timeout time.Duration) <-chan error {
+
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %+v", err)
+	}
+	started := make(chan struct{}, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	served := make(chan error, 1)
+	go func() { served <- serve(&http.Server{Handler: handler}, listener, stop, timeout) }()
+	go func() {
+		if resp, err := http.Get("http://" + listener.Addr().String()); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request never started")
+	}
+	return served
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	release, stop := make(chan struct{}), make(chan os.Signal, 1)
+	served := startServer(t, release, stop, 5*time.Second)
+	stop <- syscall.SIGTERM
+	// The in-flight request is drained before serve returns.
+	select {
+	case err := <-served:
+		t.Fatalf("expected serve to wait for the in-flight request, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	err := <-served
+	if err != nil {
+		t.Fatalf("expected clean shutdown, got: %+v", err)
+	}
+	closed := false
+	closeDatabase(err, func() error {
+		closed = true
+		return nil
+	})
+	if !closed {
+		t.Fatalf("expected db to be closed after a clean shutdown")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	release, stop := make(chan struct{}), make(chan os.Signal, 1)
+	defer close(release)
+	served := startServer(t, release, stop, 10*time.Millisecond)
+	stop <- syscall.SIGTERM
+	err := <-served
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected shutdown timeout, got: %+v", err)
+	}
+	// The db stays open while the request is still running.
+	closeDatabase(err, func() error {
+		t.Fatalf("expected db to be left open after a shutdown timeout")
+		return nil
+	})
+}